@@ -2,66 +2,194 @@ package app
 
 import (
 	"errors"
-	"log"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 )
 
+// Alien is a soldier of the invasion. Every alien lives in its own goroutine
+// (see Start) and waits for the city where it is to offer it the paths
+// leading out of the city.
 type Alien struct {
-	Name         string
-	maxMovements int64
-	paths        chan []Path
-	wg           *sync.WaitGroup
-}
-
-func New(n string, maxMov int64, wg *sync.WaitGroup) *Alien {
-	return &Alien{
-		Name:         n,
-		maxMovements: maxMov,
-		paths:        make(chan []Path),
-		wg:           wg,
+	ID         int
+	randomizer Randomizer
+	paths      chan []Path
+	chosen     chan choice
+	wg         *sync.WaitGroup
+	metrics    *Metrics
+}
+
+type choice struct {
+	path Path
+	err  error
+}
+
+// New creates an alien that uses the randomizer to choose which path to take.
+func New(id int, r Randomizer, wg *sync.WaitGroup) Alien {
+	return Alien{
+		ID:         id,
+		randomizer: r,
+		paths:      make(chan []Path),
+		chosen:     make(chan choice),
+		wg:         wg,
 	}
 }
 
-func (a Alien) ChoosePath(paths []Path) {
+// errRoadFull is returned by ChoosePath if the road of the chosen path is full.
+var errRoadFull = errors.New("the road is full. The alien waits")
+
+// ChoosePath offers the paths to the alien and blocks until the alien has chosen
+// one of them and has been sent along it. It returns the chosen path or an error
+// if there is no available path and the alien is stuck. If the road of the chosen
+// path is full, the alien isn't sent and the path is returned with errRoadFull.
+func (a Alien) ChoosePath(paths []Path) (Path, error) {
 	a.paths <- paths
+	c := <-a.chosen
+	return c.path, c.err
 }
 
+// Start runs the alien until it is killed.
 func (a Alien) Start() {
 	defer a.wg.Done()
-	for {
-		select {
-		case paths := <-a.paths:
-			a.maxMovements++
-			if a.maxMovements > a.maxMovements {
-				return
-			}
-			path, err := chooseRandomPath(paths)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-
-			path.OutgoingDirection <- a
+	a.metrics.alienStarted()
+	defer a.metrics.alienStopped()
+	for paths := range a.paths {
+		path, err := a.randomizer.ChoosePath(paths)
+		if err != nil {
+			a.chosen <- choice{err: err}
+			continue
+		}
+		if path.full() {
+			a.chosen <- choice{path: path, err: errRoadFull}
+			continue
 		}
+		path.OutgoingDirection <- a
+		a.metrics.alienMoved()
+		a.chosen <- choice{path: path}
 	}
 }
 
+// Kill stops the goroutine of the alien.
+func (a Alien) Kill() {
+	close(a.paths)
+}
+
+// Path is one of the roads leading out of a city as the city sees it during the
+// invasion. Every pair of connected cities is linked by two channels, one for
+// each direction of travel: an alien leaving the city is sent to OutgoingDirection
+// and an alien coming from the neighbour city is received from IncomingDirection.
+// When a city is destroyed it closes all its outgoing directions, so the
+// neighbours know that the path can't be used anymore.
 type Path struct {
+	Direction Direction
+	To        string
+	// Length is the number of iterations an alien travels to the city on the other side.
+	Length            int
 	OutgoingDirection chan<- Alien
 	IncomingDirection <-chan Alien
 	Closed            bool
+	// Capacity is the capacity of the road (see Road.Capacity) and Load the number
+	// of aliens on the road when the path is offered to an alien, so the randomizer
+	// can avoid the congested roads.
+	Capacity int
+	Load     int
+	// incomingLength is the length of the road back, on which the aliens come. It
+	// is 0 if the road is one-way and no alien comes.
+	incomingLength int
+	// oneWay is set if the road of the path is one-way (see Road.OneWay) and entry
+	// if the path is the end of a one-way road from the city on the other side: the
+	// aliens come on it, but can't leave on it.
+	oneWay bool
+	entry  bool
+	// outgoingLoad and incomingLoad count the aliens on the roads of the outgoing
+	// and the incoming direction. They are shared with the city on the other side.
+	outgoingLoad *int32
+	incomingLoad *int32
+}
+
+// road returns the road of the path as it is written in the world map file.
+func (p Path) road() Road {
+	return Road{Direction: p.Direction, To: p.To, Length: p.Length, OneWay: p.oneWay, Capacity: p.Capacity}
+}
+
+// full reports whether the road of the path has a capacity and as many aliens on
+// it as the capacity.
+func (p Path) full() bool {
+	return p.Capacity > 0 && p.Load >= p.Capacity
+}
+
+// withLoad returns the path with the number of aliens on its road now.
+func (p Path) withLoad() Path {
+	if p.outgoingLoad != nil {
+		p.Load = int(atomic.LoadInt32(p.outgoingLoad))
+	}
+	return p
 }
 
-var chooseRandomPath = NewDefaultRandomPath()
+// enter counts the alien that leaves the city on the road of the path.
+func (p Path) enter() {
+	if p.outgoingLoad != nil {
+		atomic.AddInt32(p.outgoingLoad, 1)
+	}
+}
+
+// arrive counts the alien that arrived from the road with the load.
+func arrive(load *int32) {
+	if load != nil {
+		atomic.AddInt32(load, -1)
+	}
+}
+
+// exits returns the paths on which the aliens can leave the city, which are all
+// paths except the entries of the one-way roads.
+func exits(paths []Path) []Path {
+	for i, p := range paths {
+		if !p.entry {
+			continue
+		}
+		// the paths are copied only if there is an entry
+		out := append([]Path(nil), paths[:i]...)
+		for _, p := range paths[i+1:] {
+			if !p.entry {
+				out = append(out, p)
+			}
+		}
+		return out
+	}
+	return paths
+}
 
+// Randomizer chooses which of the paths leading out of a city an alien takes.
+type Randomizer interface {
+	ChoosePath(paths []Path) (Path, error)
+}
+
+// RandomPath is an adapter that allows the use of ordinary functions as Randomizer.
 type RandomPath func(paths []Path) (Path, error)
 
+// ChoosePath calls f(paths).
+func (f RandomPath) ChoosePath(paths []Path) (Path, error) {
+	return f(paths)
+}
+
+// NewDefaultRandomPath returns a Randomizer that uses the global source of math/rand.
 func NewDefaultRandomPath() RandomPath {
-	return defaultRandomPath
+	return func(paths []Path) (Path, error) {
+		return randomPath(paths, rand.Intn)
+	}
+}
+
+// NewSeededRandomPath returns a Randomizer with its own source seeded with the seed.
+// Two invasions of the same world map with randomizers with the same seed are
+// identical. The returned Randomizer is not safe for concurrent use.
+func NewSeededRandomPath(seed int64) RandomPath {
+	rnd := rand.New(rand.NewSource(seed))
+	return func(paths []Path) (Path, error) {
+		return randomPath(paths, rnd.Intn)
+	}
 }
 
-func defaultRandomPath(paths []Path) (Path, error) {
+func randomPath(paths []Path, intn func(int) int) (Path, error) {
 	var availablePaths []Path
 	for _, p := range paths {
 		if p.Closed {
@@ -73,6 +201,6 @@ func defaultRandomPath(paths []Path) (Path, error) {
 		return Path{}, errors.New("no available paths. The alien is stuck")
 	}
 
-	i := rand.Intn(len(availablePaths))
+	i := intn(len(availablePaths))
 	return availablePaths[i], nil
 }
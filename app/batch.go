@@ -0,0 +1,211 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// BatchOptions configures a batch of invasions of the same world map.
+type BatchOptions struct {
+	// Runs is the number of independent invasions.
+	Runs int
+	// Aliens is the number of aliens in every invasion.
+	Aliens int
+	// MaxIterations is the maximum number of iterations of every invasion.
+	MaxIterations int
+	// Seed is the seed of the first invasion. The invasion number i uses the seed Seed+i,
+	// so the result of a batch depends only on the options and not on the number of workers.
+	Seed int64
+	// Workers is the number of invasions that run in parallel. If it is zero the number of CPUs is used.
+	Workers int
+	// Placement describes how the aliens are placed. Every invasion creates its
+	// strategy with its own seed. The zero value is SequentialPlacement.
+	Placement PlacementSpec
+	// Termination is the condition that ends every invasion. If it is nil
+	// DefaultTermination with MaxIterations is used.
+	Termination TerminationCondition
+	// Metrics counts what happens in the invasions. It can be nil.
+	Metrics *Metrics
+	// Watchdog stops the invasions that don't make progress. The zero value checks nothing.
+	Watchdog Watchdog
+	// HeadOn makes the aliens that meet on a road destroy it (see WithHeadOnCollisions).
+	HeadOn bool
+}
+
+// CityStats describes how often a city was destroyed in a batch of invasions.
+type CityStats struct {
+	Name        string  `json:"name"`
+	Destroyed   int     `json:"destroyed"`
+	Probability float64 `json:"probability"`
+}
+
+// Bucket is one bar of a histogram: the number of runs in which the value was observed.
+type Bucket struct {
+	Value       int     `json:"value"`
+	Runs        int     `json:"runs"`
+	Probability float64 `json:"probability"`
+}
+
+// BatchResult aggregates the results of all invasions in a batch.
+type BatchResult struct {
+	Runs   int         `json:"runs"`
+	Aliens int         `json:"aliens"`
+	Seed   int64       `json:"seed"`
+	Cities []CityStats `json:"cities"`
+	// SurvivingAliens is the distribution of the number of aliens alive after an invasion.
+	SurvivingAliens []Bucket `json:"surviving_aliens"`
+	// SurvivingCities is the distribution of the number of cities that are not destroyed after an invasion.
+	SurvivingCities []Bucket `json:"surviving_cities"`
+	// Iterations is the distribution of the number of iterations of an invasion.
+	Iterations []Bucket `json:"iterations"`
+}
+
+// RunBatch runs opts.Runs independent seeded invasions of the world map in parallel
+// and aggregates their results. It returns an error if the aliens of an invasion
+// can't be placed.
+func RunBatch(wm *WorldMap, opts BatchOptions) (BatchResult, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	termination := opts.Termination
+	if termination == nil {
+		termination = DefaultTermination(opts.MaxIterations)
+	}
+
+	runs := make(chan int)
+	results := make(chan InvasionResult)
+	errs := make(chan error, workers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range runs {
+				seed := opts.Seed + int64(run)
+				r := NewSeededRandomPath(seed)
+				options := []Option{WithPlacement(opts.Placement.Strategy(seed)), WithTermination(termination), WithMetrics(opts.Metrics), WithWatchdog(opts.Watchdog)}
+				if opts.HeadOn {
+					options = append(options, WithHeadOnCollisions())
+				}
+				ac := NewAlienCommander(wm, opts.Aliens, r, io.Discard, opts.MaxIterations, options...)
+				if err := ac.StartInvasion(); err != nil {
+					errs <- fmt.Errorf("invasion number %d: %w", run, err)
+					// drain the runs, so the goroutine that sends them is not blocked
+					for range runs {
+					}
+					return
+				}
+				results <- ac.Result()
+			}
+		}()
+	}
+
+	go func() {
+		for i := 0; i < opts.Runs; i++ {
+			runs <- i
+		}
+		close(runs)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// the engines destroy only cities of the world map, so the counts are keyed by name
+	destroyed := map[string]int{}
+	survivingAliens := map[int]int{}
+	survivingCities := map[int]int{}
+	iterations := map[int]int{}
+	for res := range results {
+		for _, name := range res.DestroyedCities {
+			destroyed[name]++
+		}
+		survivingAliens[len(res.SurvivingAliens)]++
+		survivingCities[len(wm.Cities)-len(res.DestroyedCities)]++
+		iterations[res.Iterations]++
+	}
+
+	br := BatchResult{
+		Runs:            opts.Runs,
+		Aliens:          opts.Aliens,
+		Seed:            opts.Seed,
+		Cities:          make([]CityStats, len(wm.Cities)),
+		SurvivingAliens: histogram(survivingAliens, opts.Runs),
+		SurvivingCities: histogram(survivingCities, opts.Runs),
+		Iterations:      histogram(iterations, opts.Runs),
+	}
+	for i, c := range wm.Cities {
+		br.Cities[i] = CityStats{Name: c.Name, Destroyed: destroyed[c.Name], Probability: ratio(destroyed[c.Name], opts.Runs)}
+	}
+
+	select {
+	case err := <-errs:
+		return BatchResult{}, err
+	default:
+	}
+	return br, nil
+}
+
+// WriteJSON writes the result as an indented JSON document.
+func (br BatchResult) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(br)
+}
+
+// WriteCSV writes the result as CSV with the columns metric, key, runs and probability.
+// The metric is one of city_destroyed, surviving_aliens, surviving_cities and iterations.
+func (br BatchResult) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	records := [][]string{{"metric", "key", "runs", "probability"}}
+	for _, c := range br.Cities {
+		records = append(records, []string{"city_destroyed", c.Name, strconv.Itoa(c.Destroyed), formatProbability(c.Probability)})
+	}
+	for _, h := range []struct {
+		metric  string
+		buckets []Bucket
+	}{
+		{"surviving_aliens", br.SurvivingAliens},
+		{"surviving_cities", br.SurvivingCities},
+		{"iterations", br.Iterations},
+	} {
+		for _, b := range h.buckets {
+			records = append(records, []string{h.metric, strconv.Itoa(b.Value), strconv.Itoa(b.Runs), formatProbability(b.Probability)})
+		}
+	}
+
+	if err := cw.WriteAll(records); err != nil {
+		return fmt.Errorf("writing batch result as CSV: %w", err)
+	}
+	return nil
+}
+
+func histogram(counts map[int]int, runs int) []Bucket {
+	buckets := make([]Bucket, 0, len(counts))
+	for v, n := range counts {
+		buckets = append(buckets, Bucket{Value: v, Runs: n, Probability: ratio(n, runs)})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Value < buckets[j].Value
+	})
+	return buckets
+}
+
+func ratio(n, runs int) float64 {
+	if runs == 0 {
+		return 0
+	}
+	return float64(n) / float64(runs)
+}
+
+func formatProbability(p float64) string {
+	return strconv.FormatFloat(p, 'f', 6, 64)
+}
@@ -0,0 +1,112 @@
+package app_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunBatch(t *testing.T) {
+	// SETUP
+	wm := createWorldMap()
+	opts := app.BatchOptions{Runs: 200, Aliens: 4, MaxIterations: 100, Seed: 42, Workers: 4}
+
+	// ACTION
+	actual, err := app.RunBatch(wm, opts)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, 200, actual.Runs)
+	assert.Len(t, actual.Cities, 9)
+	assert.Equal(t, 200, sumOfRuns(actual.SurvivingAliens))
+	assert.Equal(t, 200, sumOfRuns(actual.SurvivingCities))
+	assert.Equal(t, 200, sumOfRuns(actual.Iterations))
+	for _, c := range actual.Cities {
+		assert.InDelta(t, float64(c.Destroyed)/200, c.Probability, 1e-9)
+	}
+	for _, b := range actual.SurvivingAliens {
+		assert.LessOrEqual(t, b.Value, 4)
+	}
+}
+
+func TestRunBatchDoesNotDependOnTheNumberOfWorkers(t *testing.T) {
+	// SETUP
+	wm := createWorldMap()
+	opts := app.BatchOptions{Runs: 50, Aliens: 5, MaxIterations: 100, Seed: 7, Workers: 1}
+
+	// ACTION
+	sequential, err := app.RunBatch(wm, opts)
+	opts.Workers = 8
+	parallel, parallelErr := app.RunBatch(wm, opts)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.NoError(t, parallelErr)
+	assert.Equal(t, sequential, parallel)
+}
+
+func TestRunBatchWithWrongPlacement(t *testing.T) {
+	// SETUP
+	opts := app.BatchOptions{Runs: 5, Aliens: 3, MaxIterations: 10, Workers: 2, Placement: app.PlacementSpec{Kind: "clustered", Clusters: 20}}
+
+	// ACTION
+	_, err := app.RunBatch(createWorldMap(), opts)
+
+	// ASSERTIONS
+	assert.ErrorContains(t, err, "the number of clusters must be between 1 and 9, got 20")
+}
+
+func TestBatchResultWriteCSV(t *testing.T) {
+	// SETUP
+	res := app.BatchResult{
+		Runs:            4,
+		Cities:          []app.CityStats{{Name: "X1", Destroyed: 1, Probability: 0.25}},
+		SurvivingAliens: []app.Bucket{{Value: 0, Runs: 4, Probability: 1}},
+		SurvivingCities: []app.Bucket{{Value: 2, Runs: 4, Probability: 1}},
+		Iterations:      []app.Bucket{{Value: 3, Runs: 1, Probability: 0.25}, {Value: 5, Runs: 3, Probability: 0.75}},
+	}
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := res.WriteCSV(buf)
+
+	// ASSERTIONS
+	expected := strings.Join([]string{
+		"metric,key,runs,probability",
+		"city_destroyed,X1,1,0.250000",
+		"surviving_aliens,0,4,1.000000",
+		"surviving_cities,2,4,1.000000",
+		"iterations,3,1,0.250000",
+		"iterations,5,3,0.750000",
+	}, "\n") + "\n"
+	assert.NoError(t, err)
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestBatchResultWriteJSON(t *testing.T) {
+	// SETUP
+	res, _ := app.RunBatch(createWorldMap(), app.BatchOptions{Runs: 10, Aliens: 3, MaxIterations: 10, Seed: 1})
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := res.WriteJSON(buf)
+	var actual app.BatchResult
+	decodeErr := json.Unmarshal(buf.Bytes(), &actual)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.NoError(t, decodeErr)
+	assert.Equal(t, res, actual)
+}
+
+func sumOfRuns(buckets []app.Bucket) int {
+	var sum int
+	for _, b := range buckets {
+		sum += b.Runs
+	}
+	return sum
+}
@@ -0,0 +1,176 @@
+package app_test
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+)
+
+// The benchmarks use generated grids of about 1k, 100k and 1M cities. The grids
+// of 1M cities need a few GB of memory, so they are skipped with -short:
+//
+//	go test ./app -run '^$' -bench . -short
+
+var benchSizes = []struct {
+	name          string
+	width, height int
+}{
+	{name: "1k", width: 32, height: 32},
+	{name: "100k", width: 317, height: 316},
+	{name: "1M", width: 1000, height: 1000},
+}
+
+var benchDensities = []int{1, 10, 50, 100}
+
+var benchWorkers = []int{1, 2, 4, 8}
+
+var benchMaps = map[string]*app.WorldMap{}
+
+// benchMap returns the grid of the size. The grids are generated once, so the
+// generation is not measured.
+func benchMap(b *testing.B, name string, width, height int) *app.WorldMap {
+	b.Helper()
+	if name == "1M" && testing.Short() {
+		b.Skip("the grid of 1M cities is skipped in short mode")
+	}
+	wm, ok := benchMaps[name]
+	if !ok {
+		wm = app.GenerateGrid(width, height)
+		benchMaps[name] = wm
+	}
+	return wm
+}
+
+func BenchmarkParseWorldMap(b *testing.B) {
+	for _, size := range benchSizes {
+		for _, workers := range benchWorkers {
+			b.Run(fmt.Sprintf("cities=%s/workers=%d", size.name, workers), func(b *testing.B) {
+				text := benchMap(b, size.name, size.width, size.height).String()
+				lines := strings.Count(text, "\n")
+				b.SetBytes(int64(len(text)))
+				b.ResetTimer()
+				start := time.Now()
+				for i := 0; i < b.N; i++ {
+					if _, errs := app.ParseWorldMap(strings.NewReader(text), workers); len(errs) > 0 {
+						b.Fatal(errs)
+					}
+				}
+				b.ReportMetric(float64(lines*b.N)/time.Since(start).Seconds(), "lines/s")
+			})
+		}
+	}
+}
+
+func BenchmarkNewWorldMap(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run("cities="+size.name, func(b *testing.B) {
+			cities := benchMap(b, size.name, size.width, size.height).Cities
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				app.NewWorldMap(cities)
+			}
+		})
+	}
+}
+
+// BenchmarkNewAlienCommander measures the construction of the cities of an invasion
+// with the channels of all roads.
+func BenchmarkNewAlienCommander(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run("cities="+size.name, func(b *testing.B) {
+			wm := benchMap(b, size.name, size.width, size.height)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				app.NewAlienCommander(wm, 1, app.NewSeededRandomPath(1), io.Discard, 1)
+			}
+		})
+	}
+}
+
+func BenchmarkNewCompactGraph(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run("cities="+size.name, func(b *testing.B) {
+			wm := benchMap(b, size.name, size.width, size.height)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				app.NewCompactGraph(wm)
+			}
+		})
+	}
+}
+
+// BenchmarkInvasion measures whole invasions of at most 10 iterations. The density
+// is the percentage of the cities that have an alien at the beginning. The moves
+// are counted by an event handler, because the event log of the big grids doesn't
+// fit in memory.
+func BenchmarkInvasion(b *testing.B) {
+	engines := []struct {
+		name string
+		new  func(wm *app.WorldMap, aliens int, seed int64, opts ...app.Option) app.Invasion
+	}{
+		{name: "concurrent", new: func(wm *app.WorldMap, aliens int, seed int64, opts ...app.Option) app.Invasion {
+			return app.NewAlienCommander(wm, aliens, app.NewSeededRandomPath(seed), io.Discard, 10, opts...)
+		}},
+		{name: "sequential", new: func(wm *app.WorldMap, aliens int, seed int64, opts ...app.Option) app.Invasion {
+			return app.NewSequentialCommander(wm, aliens, app.NewSeededRandomPath(seed), io.Discard, 10, opts...)
+		}},
+		{name: "compact", new: func(wm *app.WorldMap, aliens int, seed int64, opts ...app.Option) app.Invasion {
+			return app.NewCompactCommander(benchGraph(wm), aliens, seed, 0, io.Discard, 10, opts...)
+		}},
+		{name: "sharded", new: func(wm *app.WorldMap, aliens int, seed int64, opts ...app.Option) app.Invasion {
+			g := benchGraph(wm)
+			return app.NewShardedCommander(g, app.PartitionGraph(g, runtime.NumCPU()), aliens, seed, io.Discard, 10, opts...)
+		}},
+	}
+	for _, size := range benchSizes {
+		for _, density := range benchDensities {
+			for _, engine := range engines {
+				b.Run(fmt.Sprintf("cities=%s/density=%d%%/engine=%s", size.name, density, engine.name), func(b *testing.B) {
+					wm := benchMap(b, size.name, size.width, size.height)
+					if (engine.name == "concurrent" || engine.name == "sequential") && size.name == "1M" {
+						b.Skip("only the compact and the sharded engines run on the grid of 1M cities")
+					}
+					aliens := len(wm.Cities) * density / 100
+					var iterations, moves int
+					countMoves := app.WithEventHandler(func(e app.Event) {
+						if e.Type == app.AlienMoved {
+							moves++
+						}
+					})
+					benchGraph(wm)
+					b.ResetTimer()
+					start := time.Now()
+					for i := 0; i < b.N; i++ {
+						invasion := engine.new(wm, aliens, int64(i),
+							app.WithPlacement(app.NewUniformPlacement(int64(i), false)), app.WithoutEventLog(), countMoves)
+						if err := invasion.StartInvasion(); err != nil {
+							b.Fatal(err)
+						}
+						iterations += invasion.Result().Iterations
+					}
+					elapsed := time.Since(start).Seconds()
+					b.ReportMetric(float64(iterations)/elapsed, "iterations/s")
+					b.ReportMetric(float64(moves)/elapsed, "moves/s")
+				})
+			}
+		}
+	}
+}
+
+var benchGraphs = map[*app.WorldMap]*app.CompactGraph{}
+
+// benchGraph returns the compact graph of the grid. Like the grids the graphs are
+// built once.
+func benchGraph(wm *app.WorldMap) *app.CompactGraph {
+	g, ok := benchGraphs[wm]
+	if !ok {
+		g = app.NewCompactGraph(wm)
+		benchGraphs[wm] = g
+	}
+	return g
+}
@@ -1,65 +1,300 @@
 package app
 
 import (
+	"errors"
 	"fmt"
-	"io"
-	"log"
+	"sort"
 )
 
-type City struct {
-	Name        string
-	Log         io.StringWriter
-	paths       []Path
-	aliens      []*Alien
-	isDestroyed bool
-	stop        chan struct{}
+type command int
+
+const (
+	// surveyRoads removes the paths to destroyed cities.
+	surveyRoads command = iota
+	// releaseAlien offers the paths of the city to the alien in it.
+	releaseAlien
+	// countAliens receives the incoming aliens and destroys the city if it has more
+	// than one alien. The aliens on long roads arrive after the length of the road.
+	countAliens
+)
+
+func (c command) String() string {
+	switch c {
+	case surveyRoads:
+		return "surveyRoads"
+	case releaseAlien:
+		return "releaseAlien"
+	case countAliens:
+		return "countAliens"
+	}
+	return fmt.Sprintf("command(%d)", int(c))
 }
 
-func NewCity(name string, paths []Path) City {
-	return City{Name: name, paths: paths}
+// Sitrep is the situation report that a city sends to the commander after every command.
+type Sitrep struct {
+	CityID    int
+	CityName  string
+	Aliens    []Alien
+	OpenPaths int
+	Destroyed bool
+	// Transit are the aliens on the roads to the city. If the city is destroyed they
+	// are lost.
+	Transit []Transit
+	// Move is set in the reply to releaseAlien if the alien left the city and Queued
+	// if the alien started to wait for room on the full road it chose.
+	Move   *Move
+	Queued *Move
+	// HeadOn is set in the reply to countAliens if the alien that left the city met
+	// an alien that came from the other end of the road.
+	HeadOn *HeadOn
 }
 
-func (c *City) AddAlien(a *Alien) {
+// HeadOn describes two aliens that met on a road and destroyed it.
+type HeadOn struct {
+	// To is the city on the other end of the road.
+	To string
+	// Aliens are the IDs of both aliens in increasing order.
+	Aliens []int
+}
+
+// Transit is an alien travelling on a road that is longer than one iteration.
+type Transit struct {
+	Alien Alien
+	From  string
+	// Remaining is the number of iterations until the alien arrives.
+	Remaining int
+	// load counts the aliens on the road.
+	load *int32
+}
+
+// Move describes an alien travelling from one city to another.
+type Move struct {
+	AlienID int
+	From    string
+	To      string
+}
+
+// City lives in its own goroutine during the invasion (see Live). It executes the
+// commands of the commander and replies with a Sitrep to each of them.
+type City struct {
+	ID    int
+	Name  string
+	paths []Path
+	// incoming contains the incoming directions of all paths. Unlike paths it
+	// doesn't change during the invasion, so the metrics can read it.
+	incoming []<-chan Alien
+	// roads contains all paths the city has at the beginning of the invasion. Unlike
+	// paths it changes only when a road is destroyed, so the invariant checks can
+	// find the roads to the destroyed cities.
+	roads  []Path
+	aliens []Alien
+	// transit are the aliens that are received from the long roads and arrive in
+	// the next iterations, sorted by alien ID.
+	transit     []Transit
+	isDestroyed bool
+	// headOn enables the collisions on the roads (see WithHeadOnCollisions).
+	headOn bool
+	// departed is the move of the alien that left the city in the iteration and
+	// collision the road it destroyed.
+	departed  *Move
+	collision *HeadOn
+	commands  chan command
+	sitreps   chan<- Sitrep
+	metrics   *Metrics
+	// waiting is the city at the end of the full road the alien of the city waits
+	// for, empty if the alien doesn't wait.
+	waiting string
+}
+
+// AddAlien puts the alien in the city. It must be called before Live.
+func (c *City) AddAlien(a Alien) {
 	c.aliens = append(c.aliens, a)
 }
 
+// Live executes the commands until the city is destroyed or the commands channel is closed.
 func (c *City) Live() {
-	for {
-		for i := 0; i < len(c.paths); {
-			alien, isPathOpened := c.checkPathForIncomingAlien(c.paths[i])
-			if !isPathOpened {
-				// Remove the element by appending the slice before and after the current index
-				c.paths = append(c.paths[:i], c.paths[i+1:]...)
-				continue
+	for cmd := range c.commands {
+		var move, queued *Move
+		switch cmd {
+		case surveyRoads:
+			c.checkPaths()
+		case releaseAlien:
+			move, queued = c.releaseAlien()
+		case countAliens:
+			c.advanceTransit()
+			c.checkPaths()
+			if len(c.aliens) > 1 {
+				c.destroy()
+				c.metrics.cityDestroyed()
 			}
-			if alien != nil {
-				c.aliens = append(c.aliens, alien)
-			}
-			i++
 		}
-		if len(c.aliens) > 1 {
-			c.destroy()
+		collision := c.collision
+		if cmd == countAliens {
+			c.departed = nil
+			c.collision = nil
+		}
+
+		c.sitreps <- Sitrep{
+			CityID:    c.ID,
+			CityName:  c.Name,
+			Aliens:    append([]Alien(nil), c.aliens...),
+			OpenPaths: len(exits(c.paths)),
+			Destroyed: c.isDestroyed,
+			Transit:   append([]Transit(nil), c.transit...),
+			Move:      move,
+			Queued:    queued,
+			HeadOn:    collision,
+		}
+		if c.isDestroyed {
 			return
 		}
+	}
+}
+
+// checkPaths receives the aliens coming from the neighbour cities and removes
+// the paths that are closed because the city on the other side is destroyed.
+func (c *City) checkPaths() {
+	for i := 0; i < len(c.paths); {
+		alien, isPathOpened := c.checkPathForIncomingAlien(c.paths[i])
+		if !isPathOpened {
+			// Remove the element by appending the slice before and after the current index
+			c.paths = append(c.paths[:i], c.paths[i+1:]...)
+			continue
+		}
+		if alien != nil && c.headOn && c.departed != nil && c.departed.To == c.paths[i].To {
+			c.collide(i, *alien)
+			continue
+		}
+		if alien != nil && c.paths[i].incomingLength > 1 {
+			c.transit = append(c.transit, Transit{Alien: *alien, From: c.paths[i].To, Remaining: c.paths[i].incomingLength - 1, load: c.paths[i].incomingLoad})
+		} else if alien != nil {
+			c.aliens = append(c.aliens, *alien)
+			arrive(c.paths[i].incomingLoad)
+		}
+		i++
+	}
+	sort.Slice(c.aliens, func(i, j int) bool {
+		return c.aliens[i].ID < c.aliens[j].ID
+	})
+	sort.Slice(c.transit, func(i, j int) bool {
+		return c.transit[i].Alien.ID < c.transit[j].Alien.ID
+	})
+}
 
-		if len(c.aliens) == 0 {
+// advanceTransit moves the aliens on the long roads one iteration closer to the
+// city. The aliens that arrive join the aliens in the city.
+func (c *City) advanceTransit() {
+	travelling := c.transit[:0]
+	for _, t := range c.transit {
+		t.Remaining--
+		if t.Remaining == 0 {
+			c.aliens = append(c.aliens, t.Alien)
+			arrive(t.load)
 			continue
 		}
+		travelling = append(travelling, t)
+	}
+	c.transit = travelling
+}
 
-		alien := c.aliens[0]
-		c.aliens = []*Alien{}
-		alien.ChoosePath(c.paths)
+// releaseAlien lets the alien of the city choose a path and returns its move. If
+// the road of the chosen path is full, the alien waits in the city and takes the
+// road as soon as there is room on it without choosing again, unless the road is
+// closed in the meantime.
+func (c *City) releaseAlien() (move, queued *Move) {
+	if len(c.aliens) != 1 {
+		return nil, nil
 	}
+
+	alien := c.aliens[0]
+	path, ok := c.waitingPath()
+	switch {
+	case ok && path.full():
+		return nil, nil
+	case ok:
+		c.waiting = ""
+		path.OutgoingDirection <- alien
+		c.metrics.alienMoved()
+	default:
+		c.waiting = ""
+		var err error
+		path, err = alien.ChoosePath(c.offer())
+		if errors.Is(err, errRoadFull) {
+			c.waiting = path.To
+			return nil, &Move{AlienID: alien.ID, From: c.Name, To: path.To}
+		}
+		if err != nil {
+			// the alien is trapped and stays in the city
+			return nil, nil
+		}
+	}
+	path.enter()
+	c.aliens = nil
+	c.departed = &Move{AlienID: alien.ID, From: c.Name, To: path.To}
+	return c.departed, nil
+}
+
+// waitingPath returns the path the alien of the city waits for with the number of
+// aliens on its road. ok is false if the alien doesn't wait or the road is closed.
+func (c *City) waitingPath() (Path, bool) {
+	if c.waiting == "" {
+		return Path{}, false
+	}
+	for _, p := range c.paths {
+		if p.To == c.waiting {
+			return p.withLoad(), true
+		}
+	}
+	return Path{}, false
+}
+
+// offer returns the paths on which the alien of the city can leave with the number
+// of aliens on their roads.
+func (c *City) offer() []Path {
+	paths := exits(c.paths)
+	offered := make([]Path, len(paths))
+	for i, p := range paths {
+		offered[i] = p.withLoad()
+	}
+	return offered
+}
+
+// collide kills the alien that came on the path with the index i while the alien
+// of the city left on it and destroys the road. The city on the other end does
+// the same with the alien of this city, so the road is closed on both ends.
+func (c *City) collide(i int, a Alien) {
+	p := c.paths[i]
+	a.Kill()
+	close(p.OutgoingDirection)
+	c.paths = append(c.paths[:i], c.paths[i+1:]...)
+	// the road is closed, so it is not closed again if the city is destroyed
+	roads := make([]Path, 0, len(c.roads)-1)
+	for _, r := range c.roads {
+		if r.To != p.To {
+			roads = append(roads, r)
+		}
+	}
+	c.roads = roads
+	aliens := []int{c.departed.AlienID, a.ID}
+	sort.Ints(aliens)
+	c.collision = &HeadOn{To: p.To, Aliens: aliens}
 }
 
 func (c *City) destroy() {
-	for _, path := range c.paths {
+	// all roads are closed, also the ones already removed from the paths because the
+	// city on the other side was destroyed first, so every road to a destroyed city
+	// is closed on both ends
+	for _, path := range c.roads {
 		close(path.OutgoingDirection)
 	}
+	c.paths = nil
 	c.isDestroyed = true
-	_, _ = c.Log.WriteString(fmt.Sprintf("%s has been destroyed by alien %s and alien %s!", c.Name, c.aliens[0].Name, c.aliens[1].Name))
-	for _, a := range c.aliens[2:] {
-		log.Println(fmt.Sprintf("Alien %s is in the same city and it is killed too.", a.Name))
+	for _, a := range c.aliens {
+		a.Kill()
+	}
+	// the aliens on the roads to the city are lost with the roads
+	for _, t := range c.transit {
+		t.Alien.Kill()
 	}
 }
 
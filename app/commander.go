@@ -0,0 +1,553 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EmilGeorgiev/alvasion/trace"
+)
+
+// AlienCommander serves as the strategic leader and coordinator of the alien forces
+// during an invasion. It distributes the aliens across the cities, triggers every
+// iteration of the invasion and decides when the invasion is over.
+//
+// Every city and every alien lives in its own goroutine. An iteration contains
+// three steps that the commander orders to the cities:
+//  1. the cities remove the paths to the cities destroyed in the previous iteration.
+//  2. the cities, one by one in the order of the IDs of the aliens in them, release
+//     their aliens along a randomly chosen path.
+//  3. the cities receive the incoming aliens and the cities with more than one alien
+//     are destroyed together with the aliens in them.
+type AlienCommander struct {
+	worldMap       *WorldMap
+	cities         []*City
+	numberOfAliens int
+	aliens         []Alien
+	positions      map[int]int // alien ID -> city ID
+	randomizer     Randomizer
+	placement      PlacementStrategy
+	out            io.Writer
+	maxIterations  int
+	termination    TerminationCondition
+	eventHandlers  []func(Event)
+	discardEvents  bool
+	metrics        *Metrics
+	span           *trace.Span
+	watchdog       Watchdog
+	// checkInvariants enables the checks of WithInvariantChecks.
+	checkInvariants bool
+	stopReason      string
+	iterations      int
+	destroyed       []string
+	events          []Event
+	sitreps         chan Sitrep
+	wg              *sync.WaitGroup
+
+	// the collisions on the roads of WithHeadOnCollisions
+	headOn  bool
+	crashed map[int]bool // IDs of the aliens killed on the roads
+
+	// the state the watchdog needs to detect no progress and to describe the invasion
+	command     command
+	pending     map[int]bool
+	lastSitreps map[int]Sitrep
+	onTheRoad   map[int]string // alien ID -> name of the city it is going to
+	inTransit   map[int]int    // alien ID -> ID of the city at the end of the long road it is on
+	progressed  bool           // an alien moved or a city was destroyed in the iteration
+	stalled     int
+}
+
+// Option configures an AlienCommander.
+type Option func(ac *AlienCommander)
+
+// WithPlacement sets the strategy that decides in which city every alien starts.
+// The default is SequentialPlacement.
+func WithPlacement(ps PlacementStrategy) Option {
+	return func(ac *AlienCommander) {
+		ac.placement = ps
+	}
+}
+
+// WithTermination sets the condition that ends the invasion. The default is
+// DefaultTermination with the maximum number of iterations of the commander. The
+// maximum number of iterations is a hard limit that stops the invasion even if the
+// condition is never met.
+func WithTermination(tc TerminationCondition) Option {
+	return func(ac *AlienCommander) {
+		ac.termination = tc
+	}
+}
+
+// WithEventHandler adds a function that is called with every event of the invasion
+// as soon as it happens. The function is called by the goroutine of the commander
+// while the cities wait for the next command, so it must not block.
+func WithEventHandler(h func(Event)) Option {
+	return func(ac *AlienCommander) {
+		ac.eventHandlers = append(ac.eventHandlers, h)
+	}
+}
+
+// WithoutEventLog doesn't store the events, so Events returns nothing. The events
+// are still passed to the event handlers. Big invasions use it to save memory.
+func WithoutEventLog() Option {
+	return func(ac *AlienCommander) {
+		ac.discardEvents = true
+	}
+}
+
+// WithHeadOnCollisions makes the aliens that leave the cities on both ends of a
+// road in the same iteration meet on it. They fight like in a city: the road is
+// destroyed together with both aliens, and the cities stay. Without it the aliens
+// pass each other. An alien that is already on a long road doesn't meet the
+// aliens that enter the road after it.
+func WithHeadOnCollisions() Option {
+	return func(ac *AlienCommander) {
+		ac.headOn = true
+	}
+}
+
+// WithMetrics counts the aliens, moves, iterations and destroyed cities of the
+// invasion in the metrics.
+func WithMetrics(m *Metrics) Option {
+	return func(ac *AlienCommander) {
+		ac.metrics = m
+	}
+}
+
+// WithSpan traces the invasion: the span of the invasion with the spans of the
+// distribution of the aliens and of every iteration, and the span of the report
+// generation are children of the span.
+func WithSpan(s *trace.Span) Option {
+	return func(ac *AlienCommander) {
+		ac.span = s
+	}
+}
+
+// NewAlienCommander creates a commander of numberOfAliens aliens that will invade the
+// world. By default the aliens are distributed one per city in the order of the
+// city IDs. If there are more aliens than cities, the remaining aliens are not
+// assigned to any city and don't take part in the invasion. The destruction of
+// every city is written to out.
+func NewAlienCommander(wm *WorldMap, numberOfAliens int, r Randomizer, out io.Writer, maxIterations int, opts ...Option) *AlienCommander {
+	ac := &AlienCommander{
+		worldMap:       wm,
+		cities:         wm.buildCities(),
+		numberOfAliens: numberOfAliens,
+		positions:      map[int]int{},
+		randomizer:     r,
+		out:            out,
+		maxIterations:  maxIterations,
+		placement:      SequentialPlacement{},
+		termination:    DefaultTermination(maxIterations),
+		sitreps:        make(chan Sitrep, len(wm.Cities)),
+		wg:             &sync.WaitGroup{},
+		inTransit:      map[int]int{},
+		crashed:        map[int]bool{},
+		pending:        map[int]bool{},
+		lastSitreps:    map[int]Sitrep{},
+	}
+	for _, opt := range opts {
+		opt(ac)
+	}
+	return ac
+}
+
+// distributeAliens places the aliens in the cities according to the placement strategy.
+func (ac *AlienCommander) distributeAliens() error {
+	placement, err := ac.placement.Place(ac.worldMap, ac.numberOfAliens)
+	if err != nil {
+		return fmt.Errorf("placing the aliens: %w", err)
+	}
+
+	for i, cityID := range placement {
+		a := New(i, ac.randomizer, ac.wg)
+		a.metrics = ac.metrics
+		ac.aliens = append(ac.aliens, a)
+		ac.cities[cityID].AddAlien(a)
+		ac.positions[a.ID] = cityID
+		ac.record(Event{Type: AlienPlaced, City: ac.cities[cityID].Name, Aliens: []int{a.ID}})
+	}
+	return nil
+}
+
+// StartInvasion runs the invasion until the termination condition is met (by default
+// until there is zero or one alien left, none of the aliens can move or the maximum
+// number of iterations is reached). If the placement puts more than one alien in a
+// city, the city is destroyed before the first iteration. It returns an error if
+// the aliens can't be placed or the watchdog stops the invasion (see WithWatchdog).
+func (ac *AlienCommander) StartInvasion() error {
+	start := time.Now()
+	span := ac.span.Child("invasion")
+	defer span.End()
+	distribution := span.Child("distribute aliens")
+	distribution.Set("aliens", ac.numberOfAliens)
+	err := ac.distributeAliens()
+	distribution.End()
+	if err != nil {
+		return err
+	}
+
+	ac.metrics.start(ac.cities)
+	defer ac.metrics.stop(ac.cities)
+	for _, c := range ac.cities {
+		c.commands = make(chan command)
+		c.sitreps = ac.sitreps
+		c.metrics = ac.metrics
+		c.headOn = ac.headOn
+		ac.wg.Add(1)
+		go func(c *City) {
+			defer ac.wg.Done()
+			c.Live()
+		}(c)
+	}
+	for _, a := range ac.aliens {
+		ac.wg.Add(1)
+		go a.Start()
+	}
+
+	// fail stops the invasion when the watchdog detects that it makes no progress or
+	// an invariant is violated
+	fail := func(err error) error {
+		ac.diagnose(err)
+		span.Set("error", err.Error())
+		return err
+	}
+	if len(ac.positions) > 1 && ac.hasCollisions() {
+		sitreps, err := ac.broadcast(countAliens)
+		if err != nil {
+			return fail(err)
+		}
+		ac.evaluate(sitreps, 0)
+	}
+	for {
+		// the survey removes the paths to the destroyed cities, so it is done before
+		// the check, otherwise the report would contain roads to destroyed cities.
+		sitreps, err := ac.broadcast(surveyRoads)
+		if err != nil {
+			return fail(err)
+		}
+		canMove := ac.canMove(sitreps)
+		state := ac.state(canMove, time.Since(start))
+		if reason, ok := ac.termination.Met(state); ok {
+			ac.stopReason = reason
+			break
+		}
+		if ac.iterations >= ac.maxIterations {
+			ac.stopReason = IterationsAtLeast(ac.maxIterations).String()
+			break
+		}
+
+		iteration := span.Child("iteration")
+		iteration.Set("iteration", ac.iterations+1)
+		// the aliens on the long roads get closer to their cities
+		ac.progressed = len(ac.inTransit) > 0
+		if err = ac.iterate(); err != nil {
+			iteration.End()
+			if errors.Is(err, ErrInvariant) {
+				// the cities and aliens wait for the next command, so they can be stopped
+				ac.stop()
+			}
+			return fail(err)
+		}
+		ac.iterations++
+		ac.metrics.iterationFinished()
+		ac.record(Event{Iteration: ac.iterations, Type: IterationFinished})
+		iteration.Set("aliens", len(ac.positions))
+		iteration.End()
+		if err = ac.checkProgress(canMove); err != nil {
+			ac.stop()
+			return fail(err)
+		}
+	}
+	ac.stop()
+	span.Set("iterations", ac.iterations)
+	span.Set("stop_reason", ac.stopReason)
+	return nil
+}
+
+// iterate releases the aliens and then destroys the cities where they meet.
+func (ac *AlienCommander) iterate() error {
+	var before map[int]int
+	destroyedBefore := len(ac.destroyed)
+	if ac.checkInvariants {
+		before = make(map[int]int, len(ac.positions))
+		for id, cityID := range ac.positions {
+			before[id] = cityID
+		}
+	}
+	ac.onTheRoad = map[int]string{}
+	if err := ac.giveOrders(); err != nil {
+		return err
+	}
+	sitreps, err := ac.broadcast(countAliens)
+	if err != nil {
+		return err
+	}
+	ac.evaluate(sitreps, ac.iterations+1)
+	if ac.checkInvariants {
+		if err = ac.verify(ac.iterations+1, before, destroyedBefore); err != nil {
+			return err
+		}
+	}
+	ac.onTheRoad = nil
+	return nil
+}
+
+func (ac *AlienCommander) state(canMove bool, elapsed time.Duration) InvasionState {
+	return InvasionState{
+		Iterations: ac.iterations,
+		Aliens:     len(ac.positions) + len(ac.inTransit),
+		Cities:     len(ac.cities),
+		Destroyed:  ac.destroyed,
+		CanMove:    canMove,
+		Elapsed:    elapsed,
+	}
+}
+
+// record adds the event to the event log and passes it to the event handlers.
+func (ac *AlienCommander) record(e Event) {
+	if !ac.discardEvents {
+		ac.events = append(ac.events, e)
+	}
+	if e.Type == AlienMoved || e.Type == CityDestroyed || e.Type == RoadDestroyed {
+		ac.progressed = true
+	}
+	for _, h := range ac.eventHandlers {
+		h(e)
+	}
+}
+
+// hasCollisions reports whether there is a city with more than one alien.
+func (ac *AlienCommander) hasCollisions() bool {
+	aliensInCity := map[int]int{}
+	for _, cityID := range ac.positions {
+		aliensInCity[cityID]++
+		if aliensInCity[cityID] > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// giveOrders orders the cities to release their aliens in the order of the alien IDs.
+func (ac *AlienCommander) giveOrders() error {
+	for _, a := range ac.aliens {
+		cityID, ok := ac.positions[a.ID]
+		if !ok {
+			continue
+		}
+		if err := ac.send(ac.cities[cityID], releaseAlien); err != nil {
+			return err
+		}
+		sr, err := ac.receive()
+		if err != nil {
+			return err
+		}
+		if sr.Move != nil {
+			delete(ac.positions, a.ID)
+			ac.onTheRoad[a.ID] = sr.Move.To
+			ac.record(Event{
+				Iteration: ac.iterations + 1,
+				Type:      AlienMoved,
+				From:      sr.Move.From,
+				To:        sr.Move.To,
+				Aliens:    []int{a.ID},
+			})
+		}
+		if sr.Queued != nil {
+			ac.record(Event{
+				Iteration: ac.iterations + 1,
+				Type:      AlienQueued,
+				From:      sr.Queued.From,
+				To:        sr.Queued.To,
+				Aliens:    []int{a.ID},
+			})
+		}
+	}
+	return nil
+}
+
+// evaluate updates the positions of the aliens and writes the destroyed roads and
+// cities. Both cities of a destroyed road report it, the road is recorded with the
+// city with the lower ID.
+func (ac *AlienCommander) evaluate(sitreps []Sitrep, iteration int) {
+	for _, sr := range sitreps {
+		if sr.HeadOn == nil {
+			continue
+		}
+		for _, id := range sr.HeadOn.Aliens {
+			ac.crashed[id] = true
+		}
+		if to, _ := ac.worldMap.CityID(sr.HeadOn.To); to < sr.CityID {
+			continue
+		}
+		ac.record(Event{Iteration: iteration, Type: RoadDestroyed, From: sr.CityName, To: sr.HeadOn.To, Aliens: sr.HeadOn.Aliens})
+		_, _ = fmt.Fprintln(ac.out, roadDestructionMessage(sr.CityName, sr.HeadOn.To, sr.HeadOn.Aliens))
+	}
+	for _, sr := range sitreps {
+		for _, a := range sr.Aliens {
+			delete(ac.inTransit, a.ID)
+			if sr.Destroyed {
+				delete(ac.positions, a.ID)
+				continue
+			}
+			ac.positions[a.ID] = sr.CityID
+		}
+		for _, t := range sr.Transit {
+			ac.inTransit[t.Alien.ID] = sr.CityID
+		}
+		if !sr.Destroyed {
+			continue
+		}
+
+		ac.destroyed = append(ac.destroyed, sr.CityName)
+		ids := make([]int, len(sr.Aliens))
+		for i, a := range sr.Aliens {
+			ids[i] = a.ID
+		}
+		ac.record(Event{Iteration: iteration, Type: CityDestroyed, City: sr.CityName, Aliens: ids})
+		_, _ = fmt.Fprintln(ac.out, destructionMessage(sr.CityName, ids))
+		for _, t := range sr.Transit {
+			delete(ac.inTransit, t.Alien.ID)
+			ac.record(Event{Iteration: iteration, Type: AlienLost, City: sr.CityName, Aliens: []int{t.Alien.ID}})
+		}
+	}
+}
+
+// canMove reports whether at least one alien is in a city with an open path or
+// travels on a long road.
+func (ac *AlienCommander) canMove(sitreps []Sitrep) bool {
+	if len(ac.inTransit) > 0 {
+		return true
+	}
+	for _, sr := range sitreps {
+		if len(sr.Aliens) > 0 && sr.OpenPaths > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcast sends the command to all cities that are not destroyed and returns
+// their sitreps sorted by city ID.
+func (ac *AlienCommander) broadcast(cmd command) ([]Sitrep, error) {
+	var n int
+	for _, c := range ac.cities {
+		if c.commands == nil {
+			continue
+		}
+		if err := ac.send(c, cmd); err != nil {
+			return nil, err
+		}
+		n++
+	}
+
+	sitreps := make([]Sitrep, len(ac.cities))
+	for i := 0; i < n; i++ {
+		sr, err := ac.receive()
+		if err != nil {
+			return nil, err
+		}
+		sitreps[sr.CityID] = sr
+		if sr.Destroyed {
+			// the city stopped living, don't send it commands anymore
+			ac.cities[sr.CityID].commands = nil
+		}
+	}
+
+	result := sitreps[:0]
+	for _, sr := range sitreps {
+		if sr.CityName != "" {
+			result = append(result, sr)
+		}
+	}
+	return result, nil
+}
+
+// stop stops the goroutines of all cities and aliens that are still alive.
+func (ac *AlienCommander) stop() {
+	for _, c := range ac.cities {
+		if c.commands != nil {
+			close(c.commands)
+		}
+	}
+	for _, a := range ac.aliens {
+		_, inCity := ac.positions[a.ID]
+		_, inTransit := ac.inTransit[a.ID]
+		if inCity || inTransit {
+			a.Kill()
+		}
+	}
+	ac.wg.Wait()
+}
+
+// GenerateReportForInvasion returns what is left of the world after the invasion
+// in the format of the world map file. Like WorldMap.String it leaves out the
+// cities without open roads, because a line of the file must contain a road. It
+// must be called after StartInvasion.
+func (ac *AlienCommander) GenerateReportForInvasion() string {
+	span := ac.span.Child("generate report")
+	defer span.End()
+	var sb strings.Builder
+	for _, c := range ac.cities {
+		paths := exits(c.paths)
+		if c.isDestroyed || len(paths) == 0 {
+			continue
+		}
+		sb.WriteString(c.Name)
+		for _, p := range paths {
+			sb.WriteString(" " + p.road().String())
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Events returns the event log of the invasion. It must be called after StartInvasion.
+func (ac *AlienCommander) Events() []Event {
+	return append([]Event(nil), ac.events...)
+}
+
+// InvasionResult summarizes how an invasion ended.
+type InvasionResult struct {
+	Iterations int
+	// DestroyedCities are the names of the destroyed cities in the order of destruction.
+	DestroyedCities []string
+	// SurvivingAliens are the IDs of the aliens that are alive after the invasion.
+	SurvivingAliens []int
+	// Positions maps the ID of every surviving alien to the name of the city where it is.
+	Positions map[int]string
+	// InTransit maps the ID of every surviving alien that travels on a long road to
+	// the name of the city it travels to. It is nil if there are no such aliens.
+	InTransit map[int]string
+	// StopReason is the termination condition that ended the invasion.
+	StopReason string
+}
+
+// Result returns the result of the invasion. It must be called after StartInvasion.
+func (ac *AlienCommander) Result() InvasionResult {
+	res := InvasionResult{
+		Iterations:      ac.iterations,
+		DestroyedCities: append([]string(nil), ac.destroyed...),
+		Positions:       map[int]string{},
+		StopReason:      ac.stopReason,
+	}
+	for _, a := range ac.aliens {
+		if cityID, ok := ac.positions[a.ID]; ok {
+			res.SurvivingAliens = append(res.SurvivingAliens, a.ID)
+			res.Positions[a.ID] = ac.cities[cityID].Name
+		}
+		if cityID, ok := ac.inTransit[a.ID]; ok {
+			if res.InTransit == nil {
+				res.InTransit = map[int]string{}
+			}
+			res.SurvivingAliens = append(res.SurvivingAliens, a.ID)
+			res.InTransit[a.ID] = ac.cities[cityID].Name
+		}
+	}
+	return res
+}
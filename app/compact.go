@@ -0,0 +1,666 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CompactGraph is an immutable adjacency graph of a world map in the compressed
+// sparse row format: the paths of the city with ID i are the entries from
+// offsets[i] to offsets[i+1] of targets, directions, lengths and oneWay. A road
+// takes 10 bytes instead of two channels, so the graph of a map with millions of
+// cities fits in memory and can be shared by many invasions. The one-way roads
+// have only the path from the city where they start. The capacities of the roads
+// take 4 bytes more, but only if at least one road has a capacity.
+type CompactGraph struct {
+	worldMap   *WorldMap
+	offsets    []int32
+	targets    []int32
+	directions []uint8
+	lengths    []int32
+	oneWay     []bool
+	capacities []int32
+}
+
+// NewCompactGraph creates the graph of the world map. The paths of every city are
+// in the same order as the paths of the cities of AlienCommander.
+func NewCompactGraph(wm *WorldMap) *CompactGraph {
+	n := len(wm.Cities)
+	g := &CompactGraph{worldMap: wm, offsets: make([]int32, n+1)}
+	var hasCapacities bool
+	wm.links(func(from, to int, out Road, back *Road) {
+		g.offsets[from+1]++
+		if back != nil {
+			g.offsets[to+1]++
+		}
+		hasCapacities = hasCapacities || out.Capacity > 0 || back != nil && back.Capacity > 0
+	})
+	for i := 1; i <= n; i++ {
+		g.offsets[i] += g.offsets[i-1]
+	}
+
+	g.targets = make([]int32, g.offsets[n])
+	g.directions = make([]uint8, g.offsets[n])
+	g.lengths = make([]int32, g.offsets[n])
+	g.oneWay = make([]bool, g.offsets[n])
+	if hasCapacities {
+		g.capacities = make([]int32, g.offsets[n])
+	}
+	next := append([]int32(nil), g.offsets[:n]...)
+	add := func(from, to int, r Road) {
+		g.targets[next[from]] = int32(to)
+		g.directions[next[from]] = uint8(r.Direction)
+		g.lengths[next[from]] = int32(r.travelTime())
+		g.oneWay[next[from]] = r.OneWay
+		if hasCapacities {
+			g.capacities[next[from]] = int32(r.Capacity)
+		}
+		next[from]++
+	}
+	wm.links(func(from, to int, out Road, back *Road) {
+		add(from, to, out)
+		if back != nil {
+			add(to, from, *back)
+		}
+	})
+
+	// sort the paths of every city by direction with a stable insertion sort like
+	// buildCities does, the cities have only a few paths
+	for i := 0; i < n; i++ {
+		for j := g.offsets[i] + 1; j < g.offsets[i+1]; j++ {
+			for k := j; k > g.offsets[i] && g.directions[k] < g.directions[k-1]; k-- {
+				g.directions[k], g.directions[k-1] = g.directions[k-1], g.directions[k]
+				g.targets[k], g.targets[k-1] = g.targets[k-1], g.targets[k]
+				g.lengths[k], g.lengths[k-1] = g.lengths[k-1], g.lengths[k]
+				g.oneWay[k], g.oneWay[k-1] = g.oneWay[k-1], g.oneWay[k]
+				if hasCapacities {
+					g.capacities[k], g.capacities[k-1] = g.capacities[k-1], g.capacities[k]
+				}
+			}
+		}
+	}
+	return g
+}
+
+// CompactCommander runs the invasion on a CompactGraph. The state of the
+// invasion is a few arrays indexed by the IDs of the aliens and the cities, and
+// every phase of an iteration processes the aliens in parallel shards, so it can
+// simulate a million aliens on a map of a million cities.
+//
+// The rules are the rules of SequentialCommander, but the aliens don't use a
+// Randomizer: the path of an alien in an iteration depends only on the seed, the
+// iteration and the ID of the alien, so the invasion is the same with any number
+// of shards.
+type CompactCommander struct {
+	graph          *CompactGraph
+	numberOfAliens int
+	seed           int64
+	shards         int
+	placement      PlacementStrategy
+	out            io.Writer
+	maxIterations  int
+	termination    TerminationCondition
+	eventHandlers  []func(Event)
+	discardEvents  bool
+	headOn         bool
+
+	positions []int32 // alien ID -> city ID, -1 if the alien is dead
+	// remaining is the number of iterations until the alien arrives in the city of
+	// its position if it is on a long road, otherwise 0.
+	remaining   []int32
+	occupants   []int32 // city ID -> number of aliens in the city
+	isDestroyed []bool
+	alive       int
+	stopReason  string
+	iterations  int
+	destroyed   []string
+	events      []Event
+
+	// closed marks the destroyed roads, it is indexed like the paths of the graph.
+	// departed is the ID of the alien that left every city in the iteration, -1 if
+	// none. Both are nil without head-on collisions.
+	closed   []bool
+	departed []int32
+
+	// traffic is nil if no road of the graph has a capacity.
+	traffic *traffic
+}
+
+// traffic is the state of the roads with capacities: the number of aliens on
+// every road indexed like the paths of the graph and for every alien the path of
+// the long road it travels and the path of the full road it waits for, -1 if none.
+type traffic struct {
+	load    []int32
+	onPath  []int32
+	waiting []int32
+}
+
+// newTraffic returns the state of the roads of the graph before the invasion of the
+// number of aliens, nil if no road of the graph has a capacity.
+func newTraffic(g *CompactGraph, aliens int) *traffic {
+	if g.capacities == nil {
+		return nil
+	}
+	t := &traffic{load: make([]int32, len(g.targets)), onPath: make([]int32, aliens), waiting: make([]int32, aliens)}
+	for a := 0; a < aliens; a++ {
+		t.onPath[a] = -1
+		t.waiting[a] = -1
+	}
+	return t
+}
+
+// full reports whether the road of the path with the index j has a capacity and as
+// many aliens on it as the capacity.
+func (t *traffic) full(g *CompactGraph, j int32) bool {
+	return g.capacities[j] > 0 && t.load[j] >= g.capacities[j]
+}
+
+// enter puts the alien on the road of the path with the index j if the road is
+// long. On an ordinary road the alien arrives in the iteration it leaves.
+func (t *traffic) enter(g *CompactGraph, a, j int32) {
+	if g.lengths[j] > 1 {
+		t.load[j]++
+		t.onPath[a] = j
+	}
+}
+
+// arrive takes the aliens that arrived in the iteration off their roads. The
+// roads are released after all aliens of the iteration left, like the roads of
+// SequentialCommander.
+func (t *traffic) arrive(arrived [][]int32) {
+	for _, aliens := range arrived {
+		for _, a := range aliens {
+			t.load[t.onPath[a]]--
+			t.onPath[a] = -1
+		}
+	}
+}
+
+// departure is an alien that left the city from in the current iteration.
+type departure struct {
+	alien, from int32
+}
+
+// NewCompactCommander creates a compact commander of numberOfAliens aliens that
+// choose their paths with the seed. The aliens are processed in the number of
+// shards (0 means the number of CPUs). Like NewSequentialCommander only the
+// options of the placement, the termination, the event handlers, the event log
+// and the head-on collisions apply.
+func NewCompactCommander(g *CompactGraph, numberOfAliens int, seed int64, shards int, out io.Writer, maxIterations int, opts ...Option) *CompactCommander {
+	settings := &AlienCommander{placement: SequentialPlacement{}, termination: DefaultTermination(maxIterations)}
+	for _, opt := range opts {
+		opt(settings)
+	}
+	if shards <= 0 {
+		shards = runtime.NumCPU()
+	}
+
+	n := len(g.worldMap.Cities)
+	cc := &CompactCommander{
+		graph:          g,
+		numberOfAliens: numberOfAliens,
+		seed:           seed,
+		shards:         shards,
+		placement:      settings.placement,
+		out:            out,
+		maxIterations:  maxIterations,
+		termination:    settings.termination,
+		eventHandlers:  settings.eventHandlers,
+		discardEvents:  settings.discardEvents,
+		headOn:         settings.headOn,
+		occupants:      make([]int32, n),
+		isDestroyed:    make([]bool, n),
+	}
+	if cc.headOn {
+		cc.closed, cc.departed = noCollisions(g)
+	}
+	return cc
+}
+
+// noCollisions returns the state of the head-on collisions before the invasion:
+// no road is closed and no alien left any city.
+func noCollisions(g *CompactGraph) ([]bool, []int32) {
+	departed := make([]int32, len(g.worldMap.Cities))
+	for i := range departed {
+		departed[i] = -1
+	}
+	return make([]bool, len(g.targets)), departed
+}
+
+// StartInvasion runs the invasion like SequentialCommander.StartInvasion.
+func (cc *CompactCommander) StartInvasion() error {
+	start := time.Now()
+	placement, err := cc.placement.Place(cc.graph.worldMap, cc.numberOfAliens)
+	if err != nil {
+		return fmt.Errorf("placing the aliens: %w", err)
+	}
+	cc.positions = make([]int32, len(placement))
+	cc.remaining = make([]int32, len(placement))
+	cc.traffic = newTraffic(cc.graph, len(placement))
+	for id, cityID := range placement {
+		cc.positions[id] = int32(cityID)
+		cc.occupants[cityID]++
+		if cc.recording() {
+			cc.record(Event{Type: AlienPlaced, City: cc.graph.name(int32(cityID)), Aliens: []int{id}})
+		}
+	}
+	cc.alive = len(placement)
+
+	if cc.alive > 1 {
+		cc.countAliens(0)
+	}
+	for {
+		canMove := cc.surveyRoads()
+		state := InvasionState{
+			Iterations: cc.iterations,
+			Aliens:     cc.alive,
+			Cities:     len(cc.occupants),
+			Destroyed:  cc.destroyed,
+			CanMove:    canMove,
+			Elapsed:    time.Since(start),
+		}
+		if reason, ok := cc.termination.Met(state); ok {
+			cc.stopReason = reason
+			break
+		}
+		if cc.iterations >= cc.maxIterations {
+			cc.stopReason = IterationsAtLeast(cc.maxIterations).String()
+			break
+		}
+
+		cc.releaseAliens(cc.iterations + 1)
+		cc.countAliens(cc.iterations + 1)
+		cc.iterations++
+		cc.record(Event{Iteration: cc.iterations, Type: IterationFinished})
+	}
+	return nil
+}
+
+// surveyRoads reports whether at least one alien is in a city with a path to a
+// city that is not destroyed or travels on a long road.
+func (cc *CompactCommander) surveyRoads() bool {
+	var canMove int32
+	cc.parallel(len(cc.positions), func(_, lo, hi int) {
+		for a := lo; a < hi && atomic.LoadInt32(&canMove) == 0; a++ {
+			if c := cc.positions[a]; c >= 0 && (cc.remaining[a] > 0 || cc.graph.openPaths(c, cc.isDestroyed, cc.closed) > 0) {
+				atomic.StoreInt32(&canMove, 1)
+			}
+		}
+	})
+	return canMove == 1
+}
+
+// releaseAliens moves every alien along a path chosen by choosePath. The aliens on
+// the long roads get one iteration closer to their cities instead. The shards
+// move the aliens of consecutive IDs, so the moves of the shards joined in the
+// order of the shards are in the order of the IDs of the aliens.
+func (cc *CompactCommander) releaseAliens(iteration int) {
+	moves := make([][]Event, cc.shards)
+	departures := make([][]departure, cc.shards)
+	arrived := make([][]int32, cc.shards)
+	cc.parallel(len(cc.positions), func(shard, lo, hi int) {
+		for a := lo; a < hi; a++ {
+			from := cc.positions[a]
+			if from < 0 {
+				continue
+			}
+			if cc.remaining[a] > 0 {
+				if cc.remaining[a]--; cc.remaining[a] == 0 {
+					atomic.AddInt32(&cc.occupants[from], 1)
+					if cc.traffic != nil {
+						arrived[shard] = append(arrived[shard], int32(a))
+					}
+				}
+				continue
+			}
+			j, now := cc.graph.choose(cc.traffic, cc.seed, iteration, int32(a), from, cc.isDestroyed, cc.closed)
+			if j < 0 {
+				continue
+			}
+			if !now {
+				if cc.recording() {
+					moves[shard] = append(moves[shard], Event{Iteration: iteration, Type: AlienQueued, From: cc.graph.name(from), To: cc.graph.name(cc.graph.targets[j]), Aliens: []int{a}})
+				}
+				continue
+			}
+			to, length := cc.graph.targets[j], cc.graph.lengths[j]
+			if cc.traffic != nil {
+				cc.traffic.enter(cc.graph, int32(a), j)
+			}
+			cc.positions[a] = to
+			cc.remaining[a] = length - 1
+			atomic.AddInt32(&cc.occupants[from], -1)
+			if length == 1 {
+				atomic.AddInt32(&cc.occupants[to], 1)
+			}
+			if cc.headOn {
+				// only the alien of a city with one alien leaves it
+				cc.departed[from] = int32(a)
+				departures[shard] = append(departures[shard], departure{alien: int32(a), from: from})
+			}
+			if cc.recording() {
+				moves[shard] = append(moves[shard], Event{Iteration: iteration, Type: AlienMoved, From: cc.graph.name(from), To: cc.graph.name(to), Aliens: []int{a}})
+			}
+		}
+	})
+	if cc.traffic != nil {
+		cc.traffic.arrive(arrived)
+	}
+	for _, events := range moves {
+		for _, e := range events {
+			cc.record(e)
+		}
+	}
+	if cc.headOn {
+		cc.collide(iteration, departures)
+	}
+}
+
+// collide destroys the roads on which two aliens met, because they left the cities
+// on both ends in the iteration, in the order of the lower IDs of the cities.
+func (cc *CompactCommander) collide(iteration int, departures [][]departure) {
+	var crashes []departure
+	for _, ds := range departures {
+		for _, d := range ds {
+			to := cc.positions[d.alien]
+			if other := cc.departed[to]; d.from < to && other >= 0 && cc.positions[other] == d.from {
+				crashes = append(crashes, d)
+			}
+		}
+	}
+	sort.Slice(crashes, func(i, j int) bool {
+		return crashes[i].from < crashes[j].from
+	})
+	for _, d := range crashes {
+		to := cc.positions[d.alien]
+		other := cc.departed[to]
+		cc.closed[cc.graph.path(d.from, to)] = true
+		cc.closed[cc.graph.path(to, d.from)] = true
+		cc.crash(d.alien)
+		cc.crash(other)
+		aliens := []int{int(d.alien), int(other)}
+		sort.Ints(aliens)
+		from, toName := cc.graph.name(d.from), cc.graph.name(to)
+		cc.record(Event{Iteration: iteration, Type: RoadDestroyed, From: from, To: toName, Aliens: aliens})
+		_, _ = fmt.Fprintln(cc.out, roadDestructionMessage(from, toName, aliens))
+	}
+	for _, ds := range departures {
+		for _, d := range ds {
+			cc.departed[d.from] = -1
+		}
+	}
+}
+
+// crash kills the alien on the road it travels.
+func (cc *CompactCommander) crash(a int32) {
+	if cc.remaining[a] == 0 {
+		cc.occupants[cc.positions[a]]--
+	}
+	cc.positions[a] = -1
+	cc.remaining[a] = 0
+	cc.alive--
+}
+
+// countAliens destroys the cities with more than one alien in the order of the
+// city IDs. The aliens on the long roads to the destroyed cities are lost.
+func (cc *CompactCommander) countAliens(iteration int) {
+	victims := make([][]int32, cc.shards)
+	cc.parallel(len(cc.positions), func(shard, lo, hi int) {
+		for a := lo; a < hi; a++ {
+			if c := cc.positions[a]; c >= 0 && cc.occupants[c] > 1 {
+				victims[shard] = append(victims[shard], int32(a))
+			}
+		}
+	})
+	var dead []int32
+	for _, v := range victims {
+		dead = append(dead, v...)
+	}
+	// the victims of every shard are sorted by ID and the sort is stable, so the
+	// aliens of every city stay sorted by ID
+	sort.SliceStable(dead, func(i, j int) bool {
+		return cc.positions[dead[i]] < cc.positions[dead[j]]
+	})
+
+	for i := 0; i < len(dead); {
+		c := cc.positions[dead[i]]
+		var aliens, lost []int
+		for ; i < len(dead) && cc.positions[dead[i]] == c; i++ {
+			if cc.remaining[dead[i]] > 0 {
+				lost = append(lost, int(dead[i]))
+				continue
+			}
+			aliens = append(aliens, int(dead[i]))
+		}
+		cc.isDestroyed[c] = true
+		cc.occupants[c] = 0
+		cc.alive -= len(aliens) + len(lost)
+		name := cc.graph.name(c)
+		cc.destroyed = append(cc.destroyed, name)
+		cc.record(Event{Iteration: iteration, Type: CityDestroyed, City: name, Aliens: aliens})
+		_, _ = fmt.Fprintln(cc.out, destructionMessage(name, aliens))
+		for _, a := range lost {
+			cc.record(Event{Iteration: iteration, Type: AlienLost, City: name, Aliens: []int{a}})
+		}
+	}
+	for _, a := range dead {
+		cc.positions[a] = -1
+		cc.remaining[a] = 0
+	}
+}
+
+// openPaths returns the number of open paths of the city (see isOpen).
+func (g *CompactGraph) openPaths(c int32, isDestroyed, closed []bool) int {
+	var n int
+	for j := g.offsets[c]; j < g.offsets[c+1]; j++ {
+		if g.isOpen(j, isDestroyed, closed) {
+			n++
+		}
+	}
+	return n
+}
+
+// openPath returns the index of the i-th open path of the city.
+func (g *CompactGraph) openPath(c int32, i int, isDestroyed, closed []bool) int32 {
+	skip := i
+	for j := g.offsets[c]; j < g.offsets[c+1]; j++ {
+		if !g.isOpen(j, isDestroyed, closed) {
+			continue
+		}
+		if skip == 0 {
+			return j
+		}
+		skip--
+	}
+	panic(fmt.Sprintf("the city %s doesn't have %d open paths", g.name(c), i+1))
+}
+
+// choose returns the index of the path the alien in the city from takes in the
+// iteration and whether it takes the path now. It doesn't if the road of the path
+// is full (see traffic), then the alien waits for room on the road and takes it
+// without choosing again unless the road is closed. The index is -1 if the alien
+// is trapped in the city or still waits. t is nil if no road has a capacity.
+func (g *CompactGraph) choose(t *traffic, seed int64, iteration int, a, from int32, isDestroyed, closed []bool) (int32, bool) {
+	if t != nil && t.waiting[a] >= 0 {
+		j := t.waiting[a]
+		if !g.isOpen(j, isDestroyed, closed) {
+			t.waiting[a] = -1
+		} else if t.full(g, j) {
+			return -1, false
+		} else {
+			t.waiting[a] = -1
+			return j, true
+		}
+	}
+	n := g.openPaths(from, isDestroyed, closed)
+	if n == 0 {
+		// the alien is trapped and stays in the city
+		return -1, false
+	}
+	j := g.openPath(from, choosePath(seed, iteration, int(a), n), isDestroyed, closed)
+	if t != nil && t.full(g, j) {
+		t.waiting[a] = j
+		return j, false
+	}
+	return j, true
+}
+
+// isOpen reports whether the path with the index j leads to a city that is not
+// destroyed over a road that is not destroyed. closed is indexed like targets and
+// is nil if no road can be destroyed.
+func (g *CompactGraph) isOpen(j int32, isDestroyed, closed []bool) bool {
+	return !isDestroyed[g.targets[j]] && (closed == nil || !closed[j])
+}
+
+// path returns the index of the path from the city to the city to.
+func (g *CompactGraph) path(from, to int32) int32 {
+	for j := g.offsets[from]; j < g.offsets[from+1]; j++ {
+		if g.targets[j] == to {
+			return j
+		}
+	}
+	panic(fmt.Sprintf("the city %s doesn't have a path to %s", g.name(from), g.name(to)))
+}
+
+// hasPath reports whether the city from has a path to the city to.
+func (g *CompactGraph) hasPath(from, to int32) bool {
+	for _, t := range g.targets[g.offsets[from]:g.offsets[from+1]] {
+		if t == to {
+			return true
+		}
+	}
+	return false
+}
+
+// capacity returns the capacity of the road of the path with the index j.
+func (g *CompactGraph) capacity(j int32) int {
+	if g.capacities == nil {
+		return 0
+	}
+	return int(g.capacities[j])
+}
+
+func (g *CompactGraph) name(c int32) string {
+	return g.worldMap.Cities[c].Name
+}
+
+// report returns the cities that are not destroyed with their open paths in the
+// format of the world map file. The cities without open paths are left out.
+func (g *CompactGraph) report(isDestroyed, closed []bool) string {
+	var sb strings.Builder
+	for c := range isDestroyed {
+		if isDestroyed[c] {
+			continue
+		}
+		var line strings.Builder
+		for i := g.offsets[c]; i < g.offsets[c+1]; i++ {
+			if !g.isOpen(i, isDestroyed, closed) {
+				continue
+			}
+			r := Road{Direction: Direction(g.directions[i]), To: g.name(g.targets[i]), Length: int(g.lengths[i]), OneWay: g.oneWay[i], Capacity: g.capacity(i)}
+			line.WriteString(" " + r.String())
+		}
+		if line.Len() > 0 {
+			sb.WriteString(g.name(int32(c)) + line.String() + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// parallel splits the n aliens in consecutive ranges, one for every shard, and
+// calls f for every range in its own goroutine.
+func (cc *CompactCommander) parallel(n int, f func(shard, lo, hi int)) {
+	if cc.shards == 1 {
+		f(0, 0, n)
+		return
+	}
+	size := (n + cc.shards - 1) / cc.shards
+	var wg sync.WaitGroup
+	for shard, lo := 0, 0; lo < n; shard, lo = shard+1, lo+size {
+		hi := lo + size
+		if hi > n {
+			hi = n
+		}
+		wg.Add(1)
+		go func(shard, lo, hi int) {
+			defer wg.Done()
+			f(shard, lo, hi)
+		}(shard, lo, hi)
+	}
+	wg.Wait()
+}
+
+// choosePath returns the index of the open path the alien takes in the iteration
+// if there are n open paths.
+func choosePath(seed int64, iteration, alien, n int) int {
+	x := mix(uint64(seed))
+	x = mix(x ^ uint64(iteration))
+	x = mix(x ^ uint64(alien))
+	return int(x % uint64(n))
+}
+
+// mix is the finalizer of the SplitMix64 generator.
+func mix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// recording reports whether the events are needed. A million aliens make a
+// million events in every iteration, so they are not created without an event log
+// or event handlers.
+func (cc *CompactCommander) recording() bool {
+	return !cc.discardEvents || len(cc.eventHandlers) > 0
+}
+
+func (cc *CompactCommander) record(e Event) {
+	if !cc.discardEvents {
+		cc.events = append(cc.events, e)
+	}
+	for _, h := range cc.eventHandlers {
+		h(e)
+	}
+}
+
+// GenerateReportForInvasion returns what is left of the world after the invasion
+// like SequentialCommander.GenerateReportForInvasion.
+func (cc *CompactCommander) GenerateReportForInvasion() string {
+	return cc.graph.report(cc.isDestroyed, cc.closed)
+}
+
+// Events returns the event log of the invasion. It must be called after StartInvasion.
+func (cc *CompactCommander) Events() []Event {
+	return append([]Event(nil), cc.events...)
+}
+
+// Result returns the result of the invasion. It must be called after StartInvasion.
+func (cc *CompactCommander) Result() InvasionResult {
+	res := InvasionResult{
+		Iterations:      cc.iterations,
+		DestroyedCities: append([]string(nil), cc.destroyed...),
+		Positions:       map[int]string{},
+		StopReason:      cc.stopReason,
+	}
+	for id, c := range cc.positions {
+		switch {
+		case c < 0:
+		case cc.remaining[id] > 0:
+			if res.InTransit == nil {
+				res.InTransit = map[int]string{}
+			}
+			res.SurvivingAliens = append(res.SurvivingAliens, id)
+			res.InTransit[id] = cc.graph.name(c)
+		default:
+			res.SurvivingAliens = append(res.SurvivingAliens, id)
+			res.Positions[id] = cc.graph.name(c)
+		}
+	}
+	return res
+}
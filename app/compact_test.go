@@ -0,0 +1,147 @@
+package app_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCompactCommanderAgreesWithSequentialCommander compares the compact engine
+// with the reference engine. The compact engine doesn't use a Randomizer, so the
+// sequential engine replays its moves: both engines choose the paths in the order
+// of the iterations and the IDs of the aliens, which is checked by the paths
+// offered to the replaying randomizer.
+func TestCompactCommanderAgreesWithSequentialCommander(t *testing.T) {
+	terminations := []string{"", "aliens<=0", "iterations>=5", "destroyed>=20% or no_movement"}
+	for seed := int64(0); seed < 200; seed++ {
+		rnd := rand.New(rand.NewSource(seed))
+		wm := randomWorldMap(rnd)
+		aliens := rnd.Intn(2*len(wm.Cities) + 1)
+		maxIterations := rnd.Intn(50)
+		multiple := rnd.Intn(2) == 0
+		expr := terminations[rnd.Intn(len(terminations))]
+		headOn := rnd.Intn(2) == 0
+
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			// SETUP
+			opts := func() []app.Option {
+				opts := []app.Option{app.WithPlacement(app.NewUniformPlacement(seed, multiple))}
+				if expr != "" {
+					tc, err := app.ParseTermination(expr)
+					assert.NoError(t, err)
+					opts = append(opts, app.WithTermination(tc))
+				}
+				if headOn {
+					opts = append(opts, app.WithHeadOnCollisions())
+				}
+				return opts
+			}
+			compactOut := bytes.NewBufferString("")
+			compact := app.NewCompactCommander(app.NewCompactGraph(wm), aliens, seed, 3, compactOut, maxIterations, opts()...)
+			compactErr := compact.StartInvasion()
+			sequentialOut := bytes.NewBufferString("")
+			sequential := app.NewSequentialCommander(wm, aliens, replayMoves(t, compact.Events()), sequentialOut, maxIterations, opts()...)
+
+			// ACTION
+			sequentialErr := sequential.StartInvasion()
+
+			// ASSERTIONS
+			assert.Equal(t, sequentialErr, compactErr)
+			if compactErr != nil {
+				return
+			}
+			assert.Equal(t, sequentialOut.String(), compactOut.String())
+			assert.Equal(t, sequential.Events(), compact.Events())
+			assert.Equal(t, sequential.GenerateReportForInvasion(), compact.GenerateReportForInvasion())
+			assert.Equal(t, sequential.Result(), compact.Result())
+		})
+	}
+}
+
+func TestCompactCommanderIsTheSameWithAnyNumberOfShards(t *testing.T) {
+	// SETUP
+	g := app.NewCompactGraph(app.GenerateGrid(20, 15))
+	run := func(shards int) (string, []app.Event, app.InvasionResult) {
+		out := bytes.NewBufferString("")
+		cc := app.NewCompactCommander(g, 200, 7, shards, out, 30, app.WithPlacement(app.NewUniformPlacement(7, false)))
+		assert.NoError(t, cc.StartInvasion())
+		return out.String(), cc.Events(), cc.Result()
+	}
+
+	// ACTION
+	expectedOut, expectedEvents, expectedResult := run(1)
+
+	// ASSERTIONS
+	assert.NotEmpty(t, expectedOut)
+	for _, shards := range []int{2, 3, 8, 1000} {
+		out, events, res := run(shards)
+		assert.Equal(t, expectedOut, out, "shards %d", shards)
+		assert.Equal(t, expectedEvents, events, "shards %d", shards)
+		assert.Equal(t, expectedResult, res, "shards %d", shards)
+	}
+}
+
+func TestCompactCommanderWithoutEventLog(t *testing.T) {
+	// SETUP
+	var moves int
+	cc := app.NewCompactCommander(app.NewCompactGraph(app.GenerateGrid(10, 10)), 50, 1, 2, io.Discard, 10,
+		app.WithoutEventLog(),
+		app.WithEventHandler(func(e app.Event) {
+			if e.Type == app.AlienMoved {
+				moves++
+			}
+		}))
+
+	// ACTION
+	err := cc.StartInvasion()
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Empty(t, cc.Events())
+	assert.Greater(t, moves, 0)
+}
+
+// replayMoves returns a randomizer that chooses the paths to the cities of the
+// AlienMoved and AlienQueued events in their order. It fails the test if the path
+// is not offered. An alien that waited for a road takes it without choosing again,
+// so its move on the road is skipped.
+func replayMoves(t *testing.T, events []app.Event) app.RandomPath {
+	var moves []app.Event
+	waiting := map[int]string{}
+	for _, e := range events {
+		switch e.Type {
+		case app.AlienQueued:
+			waiting[e.Aliens[0]] = e.To
+			moves = append(moves, e)
+		case app.AlienMoved:
+			to, ok := waiting[e.Aliens[0]]
+			delete(waiting, e.Aliens[0])
+			if !ok || to != e.To {
+				moves = append(moves, e)
+			}
+		}
+	}
+	return func(paths []app.Path) (app.Path, error) {
+		if len(paths) == 0 {
+			return app.Path{}, errors.New("no available paths. The alien is stuck")
+		}
+		if !assert.NotEmpty(t, moves, "the sequential engine moves more aliens") {
+			return paths[0], nil
+		}
+		move := moves[0]
+		moves = moves[1:]
+		for _, p := range paths {
+			if p.To == move.To {
+				return p, nil
+			}
+		}
+		t.Errorf("the move %s is not possible, the paths are %v", move, paths)
+		return paths[0], nil
+	}
+}
@@ -0,0 +1,108 @@
+package app
+
+import "sort"
+
+// AvoidCongestion returns a Randomizer that offers r only the paths with room on
+// their roads (see Road.Capacity), so an alien doesn't wait for a full road if
+// another road is free. If all roads are full, r chooses from all paths and the
+// alien waits.
+func AvoidCongestion(r Randomizer) RandomPath {
+	return func(paths []Path) (Path, error) {
+		var free []Path
+		for _, p := range paths {
+			if !p.Closed && !p.full() {
+				free = append(free, p)
+			}
+		}
+		if len(free) == 0 {
+			return r.ChoosePath(paths)
+		}
+		return r.ChoosePath(free)
+	}
+}
+
+// RoadWait is the statistics of the aliens that waited for room on a full road.
+type RoadWait struct {
+	From string
+	To   string
+	// Queued is the number of aliens that waited for the road and Departed the
+	// number of them that took it. The others were destroyed, chose another road
+	// because the road was closed or still waited at the end of the invasion.
+	Queued   int
+	Departed int
+	// Iterations is the sum of the iterations the departed aliens waited and Longest
+	// the longest of them.
+	Iterations int
+	Longest    int
+}
+
+// Average returns the average number of iterations the departed aliens waited.
+func (w RoadWait) Average() float64 {
+	if w.Departed == 0 {
+		return 0
+	}
+	return float64(w.Iterations) / float64(w.Departed)
+}
+
+// Congestion collects the waiting times of the aliens on every road from the
+// events of an invasion. Add can be passed to WithEventHandler, so the event log
+// isn't needed.
+type Congestion struct {
+	roads   map[[2]string]*RoadWait
+	waiting map[int]Event // alien ID -> the AlienQueued event of the road it waits for
+}
+
+// NewCongestion creates an empty Congestion.
+func NewCongestion() *Congestion {
+	return &Congestion{roads: map[[2]string]*RoadWait{}, waiting: map[int]Event{}}
+}
+
+// Add counts the event if an alien started to wait for a road or left a city.
+func (c *Congestion) Add(e Event) {
+	switch e.Type {
+	case AlienQueued:
+		c.road(e.From, e.To).Queued++
+		c.waiting[e.Aliens[0]] = e
+	case AlienMoved:
+		q, ok := c.waiting[e.Aliens[0]]
+		if !ok {
+			return
+		}
+		delete(c.waiting, e.Aliens[0])
+		if q.To != e.To {
+			return
+		}
+		w := c.road(q.From, q.To)
+		w.Departed++
+		iterations := e.Iteration - q.Iteration
+		w.Iterations += iterations
+		if iterations > w.Longest {
+			w.Longest = iterations
+		}
+	}
+}
+
+func (c *Congestion) road(from, to string) *RoadWait {
+	w, ok := c.roads[[2]string{from, to}]
+	if !ok {
+		w = &RoadWait{From: from, To: to}
+		c.roads[[2]string{from, to}] = w
+	}
+	return w
+}
+
+// Roads returns the statistics of the roads on which at least one alien waited,
+// sorted by the names of the cities where they start and end.
+func (c *Congestion) Roads() []RoadWait {
+	roads := make([]RoadWait, 0, len(c.roads))
+	for _, w := range c.roads {
+		roads = append(roads, *w)
+	}
+	sort.Slice(roads, func(i, j int) bool {
+		if roads[i].From != roads[j].From {
+			return roads[i].From < roads[j].From
+		}
+		return roads[i].To < roads[j].To
+	})
+	return roads
+}
@@ -0,0 +1,121 @@
+package app_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAvoidCongestion(t *testing.T) {
+	// SETUP
+	var offered []app.Path
+	first := app.RandomPath(func(paths []app.Path) (app.Path, error) {
+		offered = paths
+		return paths[0], nil
+	})
+	full := app.Path{To: "X2", Length: 3, Capacity: 1, Load: 1}
+	free := app.Path{To: "X3", Length: 3, Capacity: 2, Load: 1}
+	unlimited := app.Path{To: "X4", Length: 3, Load: 5}
+
+	// ACTION
+	path, err := app.AvoidCongestion(first).ChoosePath([]app.Path{full, free, unlimited})
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, free, path)
+	assert.Equal(t, []app.Path{free, unlimited}, offered)
+
+	// ACTION
+	path, err = app.AvoidCongestion(first).ChoosePath([]app.Path{full})
+
+	// ASSERTIONS
+	// all roads are full, so the alien chooses one and waits for it
+	assert.NoError(t, err)
+	assert.Equal(t, full, path)
+}
+
+func TestAvoidCongestionInInvasion(t *testing.T) {
+	// SETUP
+	// the alien in X1 chooses between the full road to X2 and the road to X3
+	wm, errs := app.ParseWorldMap(strings.NewReader("X0 east=X1\nX1 east=X2:2:1 south=X3\n"), 1)
+	assert.Empty(t, errs)
+	placement := app.ExplicitPlacement{Cities: map[int]string{0: "X1", 1: "X0"}}
+	// the aliens go east if they can
+	r := app.RandomPath(func(paths []app.Path) (app.Path, error) {
+		for _, p := range paths {
+			if p.Direction == app.East {
+				return p, nil
+			}
+		}
+		return paths[0], nil
+	})
+	ac := app.NewAlienCommander(wm, 2, app.AvoidCongestion(r), io.Discard, 3, app.WithPlacement(placement))
+
+	// ACTION
+	err := ac.StartInvasion()
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	var moves []string
+	for _, e := range ac.Events() {
+		assert.NotEqual(t, app.AlienQueued, e.Type)
+		if e.Type == app.AlienMoved && e.Iteration == 2 {
+			moves = append(moves, e.String())
+		}
+	}
+	assert.Equal(t, []string{"alien 1 moved from X1 to X3"}, moves)
+}
+
+func TestCongestion(t *testing.T) {
+	// SETUP
+	c := app.NewCongestion()
+	events := []app.Event{
+		{Iteration: 1, Type: app.AlienQueued, From: "X1", To: "X2", Aliens: []int{0}},
+		{Iteration: 2, Type: app.AlienQueued, From: "X3", To: "X2", Aliens: []int{1}},
+		{Iteration: 3, Type: app.AlienMoved, From: "X3", To: "X2", Aliens: []int{1}},
+		{Iteration: 4, Type: app.AlienMoved, From: "X1", To: "X2", Aliens: []int{0}},
+		{Iteration: 5, Type: app.AlienQueued, From: "X2", To: "X3", Aliens: []int{0}},
+		{Iteration: 6, Type: app.AlienMoved, From: "X2", To: "X3", Aliens: []int{0}},
+		{Iteration: 6, Type: app.AlienQueued, From: "X1", To: "X2", Aliens: []int{2}},
+		// the road to X2 is closed, so alien 2 chooses another road
+		{Iteration: 8, Type: app.AlienMoved, From: "X1", To: "X4", Aliens: []int{2}},
+		{Iteration: 8, Type: app.AlienMoved, From: "X3", To: "X4", Aliens: []int{1}},
+	}
+
+	// ACTION
+	for _, e := range events {
+		c.Add(e)
+	}
+
+	// ASSERTIONS
+	expected := []app.RoadWait{
+		{From: "X1", To: "X2", Queued: 2, Departed: 1, Iterations: 3, Longest: 3},
+		{From: "X2", To: "X3", Queued: 1, Departed: 1, Iterations: 1, Longest: 1},
+		{From: "X3", To: "X2", Queued: 1, Departed: 1, Iterations: 1, Longest: 1},
+	}
+	assert.Equal(t, expected, c.Roads())
+	assert.Equal(t, 3.0, c.Roads()[0].Average())
+}
+
+func TestCongestionOfScenario(t *testing.T) {
+	// SETUP
+	f, err := os.Open(filepath.Join("testdata", "scenarios", "full-road", "events.golden"))
+	assert.NoError(t, err)
+	defer f.Close()
+	events, err := app.ReadEvents(f)
+	assert.NoError(t, err)
+	c := app.NewCongestion()
+
+	// ACTION
+	for _, e := range events {
+		c.Add(e)
+	}
+
+	// ASSERTION
+	assert.Equal(t, []app.RoadWait{{From: "X1", To: "X2", Queued: 1, Departed: 1, Iterations: 1, Longest: 1}}, c.Roads())
+}
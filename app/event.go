@@ -0,0 +1,182 @@
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EventType is the type of something that happened during the invasion.
+type EventType string
+
+const (
+	// AlienPlaced is recorded when the commander puts an alien in a city at the beginning of the invasion.
+	AlienPlaced EventType = "alien_placed"
+	// AlienMoved is recorded when an alien travels from one city to another.
+	AlienMoved EventType = "alien_moved"
+	// CityDestroyed is recorded when a city is destroyed together with the aliens in it.
+	CityDestroyed EventType = "city_destroyed"
+	// AlienLost is recorded when a city is destroyed while an alien travels on a long
+	// road to it. The alien is lost with the road.
+	AlienLost EventType = "alien_lost"
+	// RoadDestroyed is recorded when two aliens meet on a road, because they left the
+	// cities on its ends in the same iteration (see WithHeadOnCollisions). The road is
+	// destroyed together with the aliens.
+	RoadDestroyed EventType = "road_destroyed"
+	// AlienQueued is recorded when an alien chooses a road that is full (see
+	// Road.Capacity). The alien waits in the city and takes the road as soon as there
+	// is room on it.
+	AlienQueued EventType = "alien_queued"
+	// IterationFinished is recorded at the end of every iteration of the invasion.
+	IterationFinished EventType = "iteration_finished"
+)
+
+// Event is something that happened during the invasion. The events of an invasion
+// form its event log, which is enough to replay the invasion.
+type Event struct {
+	// Iteration is the number of the iteration, starting from 1. The AlienPlaced
+	// events happen before the first iteration and have iteration 0.
+	Iteration int       `json:"iteration"`
+	Type      EventType `json:"type"`
+	// City is the city where the alien is placed, the destroyed city or the city
+	// the lost alien travelled to.
+	City string `json:"city,omitempty"`
+	// From and To are the cities of an AlienMoved or AlienQueued event and the ends
+	// of the road of a RoadDestroyed event.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// Aliens are the IDs of the aliens that take part in the event.
+	Aliens []int `json:"aliens,omitempty"`
+}
+
+func (e Event) String() string {
+	switch e.Type {
+	case AlienPlaced:
+		return fmt.Sprintf("alien %d is placed in %s", e.Aliens[0], e.City)
+	case AlienMoved:
+		return fmt.Sprintf("alien %d moved from %s to %s", e.Aliens[0], e.From, e.To)
+	case CityDestroyed:
+		return destructionMessage(e.City, e.Aliens)
+	case AlienLost:
+		return fmt.Sprintf("alien %d is lost on the road to %s", e.Aliens[0], e.City)
+	case RoadDestroyed:
+		return roadDestructionMessage(e.From, e.To, e.Aliens)
+	case AlienQueued:
+		return fmt.Sprintf("alien %d waits in %s for room on the road to %s", e.Aliens[0], e.From, e.To)
+	default:
+		return fmt.Sprintf("iteration %d finished", e.Iteration)
+	}
+}
+
+// destructionMessage returns the message written when a city is destroyed, for
+// example "X5 is destroyed from alien 0 and alien 1!".
+func destructionMessage(city string, aliens []int) string {
+	names := make([]string, len(aliens))
+	for i, id := range aliens {
+		names[i] = fmt.Sprintf("alien %d", id)
+	}
+	return fmt.Sprintf("%s is destroyed from %s!", city, strings.Join(names, " and "))
+}
+
+// roadDestructionMessage returns the message written when a road is destroyed,
+// for example "The road between X1 and X2 is destroyed from alien 0 and alien 1!".
+func roadDestructionMessage(from, to string, aliens []int) string {
+	return destructionMessage(fmt.Sprintf("The road between %s and %s", from, to), aliens)
+}
+
+// WriteEvents writes the events as JSON lines, one event per line.
+func WriteEvents(w io.Writer, events []Event) error {
+	enc := json.NewEncoder(w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("writing event log: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadEvents reads an event log written by WriteEvents.
+func ReadEvents(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	var lineNumber int
+	for scanner.Scan() {
+		lineNumber++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line number: %d of the event log has wrong format: %w", lineNumber, err)
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading event log: %w", err)
+	}
+	return events, nil
+}
+
+// Replay applies the event log to the world map. It writes the destruction of every
+// city and road to out and returns what is left of the world in the same format as
+// AlienCommander.GenerateReportForInvasion.
+func Replay(wm *WorldMap, events []Event, out io.Writer) (string, error) {
+	destroyed := map[string]bool{}
+	roads := map[[2]string]bool{}
+	for _, e := range events {
+		switch e.Type {
+		case CityDestroyed:
+			if _, ok := wm.CityID(e.City); !ok {
+				return "", fmt.Errorf("the event log destroys the city %s that is not in the world map", e.City)
+			}
+			destroyed[e.City] = true
+		case RoadDestroyed:
+			for _, name := range []string{e.From, e.To} {
+				if _, ok := wm.CityID(name); !ok {
+					return "", fmt.Errorf("the event log destroys a road of the city %s that is not in the world map", name)
+				}
+			}
+			roads[[2]string{e.From, e.To}] = true
+			roads[[2]string{e.To, e.From}] = true
+		default:
+			continue
+		}
+		if _, err := fmt.Fprintln(out, e.String()); err != nil {
+			return "", err
+		}
+	}
+	return reportWithout(wm, destroyed, roads), nil
+}
+
+// ReportWithoutCities returns the world map without the destroyed cities and the
+// roads leading to them in the format of the world map file.
+func ReportWithoutCities(wm *WorldMap, destroyed map[string]bool) string {
+	return reportWithout(wm, destroyed, nil)
+}
+
+// reportWithout returns the world map without the destroyed cities, the roads
+// leading to them and the destroyed roads, which are keyed by the names of the
+// cities on both ends in both orders. The cities without open roads are left out.
+func reportWithout(wm *WorldMap, destroyed map[string]bool, roads map[[2]string]bool) string {
+	var sb strings.Builder
+	for _, c := range wm.Cities {
+		if destroyed[c.Name] {
+			continue
+		}
+		var line strings.Builder
+		seen := map[string]bool{}
+		for _, r := range c.Roads {
+			if destroyed[r.To] || seen[r.To] || roads[[2]string{c.Name, r.To}] {
+				continue
+			}
+			seen[r.To] = true
+			line.WriteString(" " + r.String())
+		}
+		if line.Len() > 0 {
+			sb.WriteString(c.Name + line.String() + "\n")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,117 @@
+package app_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayProducesTheSameReportAsTheInvasion(t *testing.T) {
+	// SETUP
+	wm := createWorldMap()
+	commander := app.NewAlienCommander(wm, 6, app.NewSeededRandomPath(3), bytes.NewBufferString(""), 100)
+	commander.StartInvasion()
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := app.WriteEvents(buf, commander.Events())
+	events, readErr := app.ReadEvents(buf)
+	out := bytes.NewBufferString("")
+	report, replayErr := app.Replay(wm, events, out)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.NoError(t, readErr)
+	assert.NoError(t, replayErr)
+	assert.Equal(t, commander.Events(), events)
+	assert.Equal(t, commander.GenerateReportForInvasion(), report)
+	for _, city := range commander.Result().DestroyedCities {
+		assert.Contains(t, out.String(), city+" is destroyed from alien")
+	}
+}
+
+func TestReplayWithDestroyedRoads(t *testing.T) {
+	var roads int
+	for seed := int64(0); seed < 20; seed++ {
+		// SETUP
+		wm := app.GenerateGrid(4, 4)
+		commanderOut := bytes.NewBufferString("")
+		commander := app.NewAlienCommander(wm, 8, app.NewSeededRandomPath(seed), commanderOut, 100,
+			app.WithPlacement(app.NewUniformPlacement(seed, false)), app.WithHeadOnCollisions())
+		assert.NoError(t, commander.StartInvasion())
+		for _, e := range commander.Events() {
+			if e.Type == app.RoadDestroyed {
+				roads++
+			}
+		}
+
+		// ACTION
+		out := bytes.NewBufferString("")
+		report, err := app.Replay(wm, commander.Events(), out)
+
+		// ASSERTIONS
+		assert.NoError(t, err)
+		assert.Equal(t, commander.GenerateReportForInvasion(), report, "seed %d", seed)
+		assert.Equal(t, commanderOut.String(), out.String(), "seed %d", seed)
+	}
+	assert.Greater(t, roads, 0)
+}
+
+func TestInvasionEvents(t *testing.T) {
+	// SETUP
+	wm := createWorldMap()
+	mockRand := new(MockRandomizer)
+	mockMovementsOfThe9Aliens(mockRand)
+	commander := app.NewAlienCommander(wm, 9, mockRand, bytes.NewBufferString(""), 10000)
+
+	// ACTION
+	commander.StartInvasion()
+	events := commander.Events()
+
+	// ASSERTIONS
+	assert.Len(t, events, 9+9+4+1)
+	assert.Equal(t, app.Event{Type: app.AlienPlaced, City: "C0", Aliens: []int{0}}, events[0])
+	assert.Equal(t, app.Event{Iteration: 1, Type: app.AlienMoved, From: "C0", To: "C1", Aliens: []int{0}}, events[9])
+	assert.Equal(t, app.Event{Iteration: 1, Type: app.CityDestroyed, City: "C1", Aliens: []int{0, 2}}, events[18])
+	assert.Equal(t, app.Event{Iteration: 1, Type: app.IterationFinished}, events[22])
+}
+
+func TestReadEventsWithWrongFormat(t *testing.T) {
+	// SETUP
+	buf := bytes.NewBufferString("{\"iteration\":1,\"type\":\"city_destroyed\",\"city\":\"X1\"}\nnot json\n")
+
+	// ACTION
+	_, err := app.ReadEvents(buf)
+
+	// ASSERTIONS
+	assert.ErrorContains(t, err, "line number: 2 of the event log has wrong format")
+}
+
+func TestReplayWithUnknownCity(t *testing.T) {
+	// SETUP
+	events := []app.Event{{Iteration: 1, Type: app.CityDestroyed, City: "Foo", Aliens: []int{0, 1}}}
+
+	// ACTION
+	_, err := app.Replay(createWorldMap(), events, bytes.NewBufferString(""))
+
+	// ASSERTIONS
+	assert.EqualError(t, err, "the event log destroys the city Foo that is not in the world map")
+}
+
+func TestEventHandlerReceivesEveryEvent(t *testing.T) {
+	// SETUP
+	var received []app.Event
+	handler := func(e app.Event) {
+		received = append(received, e)
+	}
+	commander := app.NewAlienCommander(createWorldMap(), 6, app.NewSeededRandomPath(3), bytes.NewBufferString(""), 100, app.WithEventHandler(handler))
+
+	// ACTION
+	err := commander.StartInvasion()
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, commander.Events(), received)
+}
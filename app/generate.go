@@ -0,0 +1,35 @@
+package app
+
+import (
+	"fmt"
+)
+
+// GenerateGrid generates a world map of width*height cities arranged in a grid like
+// the one in cmd/world-map.txt. The cities are named X1, X2, ... row by row and
+// every city is connected with its neighbours on north, south, east and west.
+func GenerateGrid(width, height int) *WorldMap {
+	name := func(row, col int) string {
+		return fmt.Sprintf("X%d", row*width+col+1)
+	}
+
+	cities := make([]CityInfo, 0, width*height)
+	for row := 0; row < height; row++ {
+		for col := 0; col < width; col++ {
+			c := CityInfo{Name: name(row, col)}
+			if row > 0 {
+				c.Roads = append(c.Roads, Road{Direction: North, To: name(row-1, col)})
+			}
+			if row < height-1 {
+				c.Roads = append(c.Roads, Road{Direction: South, To: name(row+1, col)})
+			}
+			if col < width-1 {
+				c.Roads = append(c.Roads, Road{Direction: East, To: name(row, col+1)})
+			}
+			if col > 0 {
+				c.Roads = append(c.Roads, Road{Direction: West, To: name(row, col-1)})
+			}
+			cities = append(cities, c)
+		}
+	}
+	return NewWorldMap(cities)
+}
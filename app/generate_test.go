@@ -0,0 +1,149 @@
+package app_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateGrid(t *testing.T) {
+	// ACTION
+	wm := app.GenerateGrid(3, 3)
+
+	// ASSERTIONS
+	expected := "" +
+		"X1 south=X4 east=X2\n" +
+		"X2 south=X5 east=X3 west=X1\n" +
+		"X3 south=X6 west=X2\n" +
+		"X4 north=X1 south=X7 east=X5\n" +
+		"X5 north=X2 south=X8 east=X6 west=X4\n" +
+		"X6 north=X3 south=X9 west=X5\n" +
+		"X7 north=X4 east=X8\n" +
+		"X8 north=X5 east=X9 west=X7\n" +
+		"X9 north=X6 west=X8\n"
+	assert.Equal(t, expected, wm.String())
+}
+
+func TestWorldMapJSON(t *testing.T) {
+	// SETUP
+	wm := app.GenerateGrid(4, 2)
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := wm.WriteJSON(buf)
+	actual, readErr := app.ReadWorldMapJSON(buf)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.NoError(t, readErr)
+	assert.Equal(t, wm, actual)
+}
+
+func TestReadWorldMapJSONWithWrongDirection(t *testing.T) {
+	// SETUP
+	buf := bytes.NewBufferString(`{"cities":[{"name":"X1","roads":[{"direction":"up","to":"X2"}]}]}`)
+
+	// ACTION
+	_, err := app.ReadWorldMapJSON(buf)
+
+	// ASSERTIONS
+	assert.ErrorContains(t, err, "unknown direction \"up\"")
+}
+
+func TestReadWorldMapJSONWithWrongRoad(t *testing.T) {
+	cases := []struct {
+		name     string
+		road     string
+		expected string
+	}{
+		{name: "road to the city itself", road: `{"direction":"north","to":"X1"}`, expected: "the road north=X1 of the city X1 leads to the city itself"},
+		{name: "road without destination", road: `{"direction":"north","to":""}`, expected: "the road north of the city X1 has no destination"},
+		{name: "negative length", road: `{"direction":"north","to":"X2","length":-2}`, expected: "the road north=X2 of the city X1 has the negative length -2"},
+		{name: "negative capacity", road: `{"direction":"north","to":"X2","capacity":-1}`, expected: "the road north=X2 of the city X1 has the negative capacity -1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// SETUP
+			buf := bytes.NewBufferString(`{"cities":[{"name":"X1","roads":[` + c.road + `]}]}`)
+
+			// ACTION
+			_, err := app.ReadWorldMapJSON(buf)
+
+			// ASSERTIONS
+			assert.EqualError(t, err, "reading world map as JSON: "+c.expected)
+		})
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	// SETUP
+	wm := app.GenerateGrid(2, 1)
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := wm.WriteDOT(buf, map[string]bool{"X2": true}, nil)
+
+	// ASSERTIONS
+	expected := "graph world {\n" +
+		"  \"X1\" [shape=box];\n" +
+		"  \"X2\" [shape=box, style=dashed, label=\"X2 (destroyed)\"];\n" +
+		"  \"X1\" -- \"X2\" [style=dashed];\n" +
+		"}\n"
+	assert.NoError(t, err)
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestWriteDOTWithQuoteInTheNameOfADestroyedCity(t *testing.T) {
+	// SETUP
+	wm := app.NewWorldMap([]app.CityInfo{{Name: `X"1`, Roads: []app.Road{{Direction: app.East, To: "X2"}}}})
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := wm.WriteDOT(buf, map[string]bool{`X"1`: true}, nil)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `  "X\"1" [shape=box, style=dashed, label="X\"1 (destroyed)"];`+"\n")
+}
+
+func TestWriteDOTWithOneWayRoad(t *testing.T) {
+	// SETUP
+	// only X2 has a road, so the edge starts in X2
+	wm := app.NewWorldMap([]app.CityInfo{{Name: "X2", Roads: []app.Road{{Direction: app.West, To: "X1", OneWay: true}}}})
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := wm.WriteDOT(buf, map[string]bool{"X1": true}, nil)
+
+	// ASSERTIONS
+	expected := "graph world {\n" +
+		"  \"X1\" [shape=box, style=dashed, label=\"X1 (destroyed)\"];\n" +
+		"  \"X2\" [shape=box];\n" +
+		"  \"X2\" -- \"X1\" [style=dashed, dir=forward];\n" +
+		"}\n"
+	assert.NoError(t, err)
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestWriteDOTWithLayout(t *testing.T) {
+	// SETUP
+	wm := app.GenerateGrid(1, 2)
+	layout := app.NewLayout(wm)
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := wm.WriteDOT(buf, nil, &layout)
+
+	// ASSERTIONS
+	expected := "graph world {\n" +
+		"  layout=neato;\n" +
+		"  \"X1\" [shape=box, pos=\"0,0!\"];\n" +
+		"  \"X2\" [shape=box, pos=\"0,-2!\"];\n" +
+		"  \"X1\" -- \"X2\";\n" +
+		"}\n"
+	assert.NoError(t, err)
+	assert.Equal(t, expected, buf.String())
+}
@@ -0,0 +1,195 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvariant is returned by StartInvasion when the checks of the invariants find
+// a violation (see WithInvariantChecks).
+var ErrInvariant = errors.New("invariant violated")
+
+// WithInvariantChecks is a debug mode in which the commander verifies after every
+// iteration that:
+//   - no city that is not destroyed holds more than one alien.
+//   - no alien is in two cities and every alien is where the commander expects it.
+//   - the number of aliens is conserved: every placed alien is alive (in a city or
+//     on a long road) or killed in a city or on a road.
+//   - the destroyed cities have no paths and the roads to them are closed.
+//   - every open path has a reverse path in the city on the other side.
+//
+// The first violations stop the invasion with ErrInvariant and the difference of
+// the expected and the actual state. The checks read the state of all cities, so
+// they make the invasion slower.
+func WithInvariantChecks() Option {
+	return func(ac *AlienCommander) {
+		ac.checkInvariants = true
+	}
+}
+
+// verify checks the invariants after the iteration. before contains the positions
+// of the aliens at the beginning of the iteration and destroyedBefore the number
+// of the cities destroyed before it.
+func (ac *AlienCommander) verify(iteration int, before map[int]int, destroyedBefore int) error {
+	var diff []string
+	mismatch := func(subject, expected, actual string) {
+		diff = append(diff, fmt.Sprintf("  %s: expected %s, actual %s", subject, expected, actual))
+	}
+
+	destroyedNow := map[string]bool{}
+	for _, name := range ac.destroyed[destroyedBefore:] {
+		destroyedNow[name] = true
+	}
+	killed := len(ac.crashed)
+	actual := map[int][]string{}
+	for _, sr := range ac.lastSitreps {
+		if sr.Destroyed {
+			killed += len(sr.Aliens) + len(sr.Transit)
+		}
+		if sr.Destroyed && !destroyedNow[sr.CityName] {
+			continue
+		}
+		if !sr.Destroyed && len(sr.Aliens) > 1 {
+			mismatch(fmt.Sprintf("city %s aliens", sr.CityName), "at most 1", fmt.Sprint(alienIDs(sr.Aliens)))
+		}
+		for _, a := range sr.Aliens {
+			actual[a.ID] = append(actual[a.ID], sr.CityName)
+		}
+		// an alien on a long road is where it goes to
+		for _, t := range sr.Transit {
+			actual[t.Alien.ID] = append(actual[t.Alien.ID], sr.CityName)
+		}
+	}
+
+	ids := make([]int, 0, len(before))
+	for id := range before {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if ac.crashed[id] {
+			continue
+		}
+		expected := ac.cities[before[id]].Name
+		if to, ok := ac.onTheRoad[id]; ok {
+			expected = to
+		}
+		cities := actual[id]
+		sort.Strings(cities)
+		switch {
+		case len(cities) == 0:
+			mismatch(fmt.Sprintf("alien %d city", id), expected, "none")
+		case len(cities) > 1:
+			mismatch(fmt.Sprintf("alien %d city", id), expected, strings.Join(cities, " and "))
+		case cities[0] != expected:
+			mismatch(fmt.Sprintf("alien %d city", id), expected, cities[0])
+		}
+	}
+
+	alive := len(ac.positions) + len(ac.inTransit)
+	if alive+killed != len(ac.aliens) {
+		mismatch("aliens", fmt.Sprintf("%d placed = alive + killed", len(ac.aliens)),
+			fmt.Sprintf("%d alive + %d killed", alive, killed))
+	}
+
+	for _, c := range ac.cities {
+		if sr, ok := ac.lastSitreps[c.ID]; ok && sr.Destroyed {
+			diff = append(diff, ac.verifyDestroyed(c)...)
+		} else {
+			diff = append(diff, ac.verifyPaths(c)...)
+		}
+	}
+
+	if len(diff) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w after iteration %d:\n%s", ErrInvariant, iteration, strings.Join(diff, "\n"))
+}
+
+// verifyDestroyed checks that the destroyed city has no paths and that the roads of
+// its neighbours to it are closed.
+func (ac *AlienCommander) verifyDestroyed(c *City) []string {
+	var diff []string
+	if len(c.paths) > 0 {
+		diff = append(diff, fmt.Sprintf("  city %s paths: expected none because it is destroyed, actual %s", c.Name, pathsString(c.paths)))
+	}
+	for _, p := range c.roads {
+		id, _ := ac.worldMap.CityID(p.To)
+		neighbour := ac.cities[id]
+		for _, back := range neighbour.roads {
+			if back.To != c.Name {
+				continue
+			}
+			if closed, alien := isClosed(back.IncomingDirection); !closed {
+				actual := "open"
+				if alien != nil {
+					actual = fmt.Sprintf("open with alien %d on it", alien.ID)
+				}
+				diff = append(diff, fmt.Sprintf("  road %s %s=%s: expected closed because %s is destroyed, actual %s",
+					neighbour.Name, back.Direction, back.To, c.Name, actual))
+			}
+		}
+	}
+	return diff
+}
+
+// verifyPaths checks that every open path of the city leads to a city with a path back.
+func (ac *AlienCommander) verifyPaths(c *City) []string {
+	var diff []string
+	for _, p := range c.paths {
+		closed, alien := isClosed(p.IncomingDirection)
+		if alien != nil {
+			diff = append(diff, fmt.Sprintf("  road %s %s=%s: expected no alien on it, actual alien %d", c.Name, p.Direction, p.To, alien.ID))
+		}
+		if closed {
+			// the city on the other side is destroyed, the path is removed in the next survey
+			continue
+		}
+		id, _ := ac.worldMap.CityID(p.To)
+		var reverse bool
+		for _, back := range ac.cities[id].paths {
+			reverse = reverse || back.To == c.Name
+		}
+		if !reverse {
+			diff = append(diff, fmt.Sprintf("  road %s %s=%s: expected a path back from %s, actual %s",
+				c.Name, p.Direction, p.To, p.To, pathsString(ac.cities[id].paths)))
+		}
+	}
+	return diff
+}
+
+// isClosed reports whether the channel is closed without blocking. At the end of
+// an iteration all aliens are received, so an alien found on the channel is
+// returned as a violation too.
+func isClosed(ch <-chan Alien) (bool, *Alien) {
+	select {
+	case a, ok := <-ch:
+		if !ok {
+			return true, nil
+		}
+		return false, &a
+	default:
+		return false, nil
+	}
+}
+
+func alienIDs(aliens []Alien) []int {
+	ids := make([]int, len(aliens))
+	for i, a := range aliens {
+		ids[i] = a.ID
+	}
+	return ids
+}
+
+func pathsString(paths []Path) string {
+	if len(paths) == 0 {
+		return "none"
+	}
+	s := make([]string, len(paths))
+	for i, p := range paths {
+		s[i] = fmt.Sprintf("%s=%s", p.Direction, p.To)
+	}
+	return strings.Join(s, " ")
+}
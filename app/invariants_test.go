@@ -0,0 +1,72 @@
+package app_test
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvariantChecksPassForCorrectInvasions(t *testing.T) {
+	for seed := int64(0); seed < 50; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			// SETUP
+			rnd := rand.New(rand.NewSource(seed))
+			wm := randomWorldMap(rnd)
+			aliens := rnd.Intn(2*len(wm.Cities) + 1)
+			opts := []app.Option{app.WithPlacement(app.NewUniformPlacement(seed, true)), app.WithInvariantChecks()}
+			if seed%2 == 0 {
+				opts = append(opts, app.WithHeadOnCollisions())
+			}
+			ac := app.NewAlienCommander(wm, aliens, app.NewSeededRandomPath(seed), io.Discard, 100, opts...)
+
+			// ACTION
+			err := ac.StartInvasion()
+
+			// ASSERTION
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestInvariantChecksStopTheInvasionWhenAnAlienIsNotWhereExpected(t *testing.T) {
+	// SETUP
+	// the alien takes the first path, but tells the commander that it went to X4
+	liar := app.RandomPath(func(paths []app.Path) (app.Path, error) {
+		p := paths[0]
+		p.To = "X4"
+		return p, nil
+	})
+	ac := app.NewAlienCommander(app.GenerateGrid(2, 2), 1, liar, io.Discard, 100,
+		app.WithTermination(app.IterationsAtLeast(5)), app.WithInvariantChecks())
+
+	// ACTION
+	err := ac.StartInvasion()
+
+	// ASSERTIONS
+	assert.ErrorIs(t, err, app.ErrInvariant)
+	assert.EqualError(t, err, "invariant violated after iteration 1:\n"+
+		"  alien 0 city: expected X4, actual X3")
+	assert.Equal(t, 0, ac.Result().Iterations)
+}
+
+func TestInvasionWithoutInvariantChecksIgnoresTheViolation(t *testing.T) {
+	// SETUP
+	liar := app.RandomPath(func(paths []app.Path) (app.Path, error) {
+		p := paths[0]
+		p.To = "X4"
+		return p, nil
+	})
+	ac := app.NewAlienCommander(app.GenerateGrid(2, 2), 1, liar, io.Discard, 100,
+		app.WithTermination(app.IterationsAtLeast(5)))
+
+	// ACTION
+	err := ac.StartInvasion()
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, 5, ac.Result().Iterations)
+}
@@ -0,0 +1,201 @@
+package app
+
+import "fmt"
+
+// Position is the place of a city on a grid. X grows to the east and Y to the south.
+type Position struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Step returns the position one road away in the direction.
+func (p Position) Step(d Direction) Position {
+	switch d {
+	case North:
+		return Position{X: p.X, Y: p.Y - 1}
+	case South:
+		return Position{X: p.X, Y: p.Y + 1}
+	case East:
+		return Position{X: p.X + 1, Y: p.Y}
+	default:
+		return Position{X: p.X - 1, Y: p.Y}
+	}
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("(%d, %d)", p.X, p.Y)
+}
+
+// Layout places the cities of a world map on a grid, so they can be drawn and the
+// distance between them can be measured.
+type Layout struct {
+	// Positions contains the position of every city by city ID.
+	Positions []Position `json:"positions"`
+	Width     int        `json:"width"`
+	Height    int        `json:"height"`
+	// Contradictions describes the roads that don't fit in the grid, for example a
+	// cycle of roads that doesn't close, and the cities that the roads put on the
+	// same place. They don't stop the invasion, but the layout of such a map is
+	// only an approximation.
+	Contradictions []string `json:"contradictions,omitempty"`
+}
+
+// NewLayout places the cities on a grid by following their roads: a city on the
+// east of X1 is placed one column right of X1 and so on. Every group of connected
+// cities is placed right of the previous group. If the place of a city is already
+// taken by another city of the group, the city is placed in the next free column
+// of the same row and the overlap is reported as a contradiction.
+func NewLayout(wm *WorldMap) Layout {
+	l := Layout{Positions: make([]Position, len(wm.Cities))}
+	// expected contains the positions implied by the roads before the overlaps are
+	// moved aside. The roads are checked against them.
+	expected := make([]Position, len(wm.Cities))
+	placed := make([]bool, len(wm.Cities))
+	// incoming are the one-way roads to every city by city ID, they are followed
+	// backwards, so the cities on both ends are in the same group
+	incoming := make([][]int, len(wm.Cities))
+	for _, c := range wm.Cities {
+		for _, r := range c.Roads {
+			if nb, ok := wm.CityID(r.To); ok && r.OneWay {
+				incoming[nb] = append(incoming[nb], c.ID)
+			}
+		}
+	}
+
+	var offset int
+	for start := range wm.Cities {
+		if placed[start] {
+			continue
+		}
+
+		// the component is placed around (0, 0) and moved right of the previous one
+		component := []int{start}
+		placed[start] = true
+		taken := map[Position]int{{}: start}
+		positions := map[int]Position{start: {}}
+		// place puts the city nb on the side d of the city c, r is the road between
+		// them of the city from
+		place := func(c, nb int, d Direction, from int, r Road) {
+			placed[nb] = true
+			expected[nb] = expected[c].Step(d)
+			p := positions[c].Step(d)
+			if other, ok := taken[p]; ok {
+				l.Contradictions = append(l.Contradictions, fmt.Sprintf("the road %s %s puts %s on the place of %s", wm.Cities[from].Name, r, wm.Cities[nb].Name, wm.Cities[other].Name))
+				for ok {
+					p.X++
+					_, ok = taken[p]
+				}
+			}
+			taken[p] = nb
+			positions[nb] = p
+			component = append(component, nb)
+		}
+		for i := 0; i < len(component); i++ {
+			c := component[i]
+			for _, r := range wm.Cities[c].Roads {
+				nb, ok := wm.CityID(r.To)
+				if !ok || placed[nb] {
+					continue
+				}
+				place(c, nb, r.Direction, c, r)
+			}
+			for _, nb := range incoming[c] {
+				if placed[nb] {
+					continue
+				}
+				for _, r := range wm.Cities[nb].Roads {
+					if r.To == wm.Cities[c].Name {
+						place(c, nb, r.Direction.Opposite(), nb, r)
+						break
+					}
+				}
+			}
+		}
+
+		minX, minY, maxX := 0, 0, 0
+		for _, p := range positions {
+			if p.X < minX {
+				minX = p.X
+			}
+			if p.Y < minY {
+				minY = p.Y
+			}
+			if p.X > maxX {
+				maxX = p.X
+			}
+		}
+		for _, c := range component {
+			p := positions[c]
+			l.Positions[c] = Position{X: p.X - minX + offset, Y: p.Y - minY}
+		}
+		offset += maxX - minX + 1
+	}
+
+	l.Contradictions = append(l.Contradictions, roadContradictions(wm, expected)...)
+	for _, p := range l.Positions {
+		if p.X+1 > l.Width {
+			l.Width = p.X + 1
+		}
+		if p.Y+1 > l.Height {
+			l.Height = p.Y + 1
+		}
+	}
+	return l
+}
+
+// roadContradictions returns the roads that don't lead to the expected position of
+// their city, for example the last road of a cycle that doesn't close. Every pair of
+// cities is reported once, even if the roads in both directions don't fit.
+func roadContradictions(wm *WorldMap, expected []Position) []string {
+	var contradictions []string
+	reported := map[[2]int]bool{}
+	for _, c := range wm.Cities {
+		for _, r := range c.Roads {
+			nb, ok := wm.CityID(r.To)
+			if !ok {
+				continue
+			}
+			want := expected[c.ID].Step(r.Direction)
+			pair := [2]int{c.ID, nb}
+			if nb < c.ID {
+				pair = [2]int{nb, c.ID}
+			}
+			if expected[nb] == want || reported[pair] {
+				continue
+			}
+			reported[pair] = true
+			contradictions = append(contradictions, fmt.Sprintf("the road %s %s doesn't fit: the other roads put %s at %s relative to %s instead of %s",
+				c.Name, r, r.To, relative(expected[nb], expected[c.ID]), c.Name, relative(want, expected[c.ID])))
+		}
+	}
+	return contradictions
+}
+
+// relative returns the position p relative to the origin, so the contradictions
+// don't depend on where the groups of cities are placed.
+func relative(p, origin Position) Position {
+	return Position{X: p.X - origin.X, Y: p.Y - origin.Y}
+}
+
+// At returns the IDs of the cities by position.
+func (l Layout) At() map[Position]int {
+	at := make(map[Position]int, len(l.Positions))
+	for id, p := range l.Positions {
+		at[p] = id
+	}
+	return at
+}
+
+// Distance returns the Manhattan distance between the cities with the given IDs
+// on the grid.
+func (l Layout) Distance(from, to int) int {
+	dx := l.Positions[from].X - l.Positions[to].X
+	if dx < 0 {
+		dx = -dx
+	}
+	dy := l.Positions[from].Y - l.Positions[to].Y
+	if dy < 0 {
+		dy = -dy
+	}
+	return dx + dy
+}
@@ -0,0 +1,106 @@
+package app_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayoutOfAGrid(t *testing.T) {
+	// SETUP
+	wm := app.GenerateGrid(3, 2)
+
+	// ACTION
+	l := app.NewLayout(wm)
+
+	// ASSERTIONS
+	assert.Equal(t, 3, l.Width)
+	assert.Equal(t, 2, l.Height)
+	assert.Empty(t, l.Contradictions)
+	for i := 1; i <= 6; i++ {
+		id, _ := wm.CityID(fmt.Sprintf("X%d", i))
+		assert.Equal(t, app.Position{X: (i - 1) % 3, Y: (i - 1) / 3}, l.Positions[id])
+	}
+}
+
+func TestLayoutPlacesDisconnectedGroupsSideBySide(t *testing.T) {
+	// SETUP
+	wm := app.NewWorldMap([]app.CityInfo{
+		{Name: "A", Roads: []app.Road{{Direction: app.South, To: "B"}}},
+		{Name: "C", Roads: []app.Road{{Direction: app.West, To: "D"}}},
+	})
+
+	// ACTION
+	l := app.NewLayout(wm)
+
+	// ASSERTIONS
+	assert.Equal(t, []app.Position{{X: 0, Y: 0}, {X: 0, Y: 1}, {X: 2, Y: 0}, {X: 1, Y: 0}}, l.Positions)
+	assert.Equal(t, 3, l.Width)
+	assert.Equal(t, 2, l.Height)
+	assert.Empty(t, l.Contradictions)
+}
+
+func TestLayoutFollowsOneWayRoadsBackwards(t *testing.T) {
+	// SETUP
+	// A has no road, but B is placed next to it
+	wm := app.NewWorldMap([]app.CityInfo{{Name: "B", Roads: []app.Road{{Direction: app.West, To: "A", OneWay: true}}}})
+
+	// ACTION
+	l := app.NewLayout(wm)
+
+	// ASSERTIONS
+	assert.Equal(t, []app.Position{{X: 0, Y: 0}, {X: 1, Y: 0}}, l.Positions)
+	assert.Equal(t, 2, l.Width)
+	assert.Empty(t, l.Contradictions)
+}
+
+func TestLayoutWithCycleThatDoesNotClose(t *testing.T) {
+	// SETUP
+	wm := app.NewWorldMap([]app.CityInfo{
+		{Name: "A", Roads: []app.Road{{Direction: app.East, To: "B"}}},
+		{Name: "B", Roads: []app.Road{{Direction: app.South, To: "C"}}},
+		{Name: "C", Roads: []app.Road{{Direction: app.North, To: "A"}}},
+	})
+
+	// ACTION
+	l := app.NewLayout(wm)
+
+	// ASSERTIONS
+	assert.Equal(t, []string{"the road B south=C doesn't fit: the other roads put C at (-1, 1) relative to B instead of (0, 1)"}, l.Contradictions)
+	assert.Equal(t, []app.Position{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 0, Y: 1}}, l.Positions)
+}
+
+func TestLayoutWithCitiesOnTheSamePlace(t *testing.T) {
+	// SETUP
+	// D and E are both south-east of A
+	wm := app.NewWorldMap([]app.CityInfo{
+		{Name: "A", Roads: []app.Road{{Direction: app.East, To: "B"}, {Direction: app.South, To: "C"}}},
+		{Name: "B", Roads: []app.Road{{Direction: app.South, To: "D"}}},
+		{Name: "C", Roads: []app.Road{{Direction: app.East, To: "E"}}},
+	})
+
+	// ACTION
+	l := app.NewLayout(wm)
+
+	// ASSERTIONS
+	assert.Equal(t, []string{"the road B south=D puts D on the place of E"}, l.Contradictions)
+	assert.Equal(t, app.Position{X: 1, Y: 1}, l.Positions[4])
+	assert.Equal(t, app.Position{X: 2, Y: 1}, l.Positions[3])
+}
+
+func TestLayoutDistance(t *testing.T) {
+	// SETUP
+	wm := app.GenerateGrid(3, 3)
+	l := app.NewLayout(wm)
+	x1, _ := wm.CityID("X1")
+	x9, _ := wm.CityID("X9")
+
+	// ACTION
+	d := l.Distance(x1, x9)
+
+	// ASSERTIONS
+	assert.Equal(t, 4, d)
+	assert.Equal(t, 0, l.Distance(x9, x9))
+}
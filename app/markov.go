@@ -0,0 +1,246 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// The aliens choose uniformly at random one of the open paths of their city, so the
+// invasion is a Markov chain. Its state is the position of every alien and the set of
+// destroyed cities. For a small number of aliens the distribution over the states
+// can be computed exactly, iteration by iteration, without running any invasion.
+
+// maxMarkovCities is the maximum number of cities of a world map that can be solved
+// analytically, because the destroyed cities are stored in a bit mask.
+const maxMarkovCities = 64
+
+// MarkovOptions configures the analytic solver.
+type MarkovOptions struct {
+	// Placement contains the ID of the city where every alien starts. The alien with
+	// ID i starts in the city Placement[i].
+	Placement []int
+	// Iterations is the number of iterations of the invasion.
+	Iterations int
+	// Epsilon truncates the computation: the states with probability lower than Epsilon
+	// are dropped after every iteration. If it is zero the computation is exact.
+	Epsilon float64
+}
+
+// CityProbability is the probability of a city to be destroyed.
+type CityProbability struct {
+	Name        string  `json:"name"`
+	Probability float64 `json:"probability"`
+}
+
+// MarkovResult contains the probability of every city to be destroyed within the
+// given number of iterations.
+type MarkovResult struct {
+	Iterations int               `json:"iterations"`
+	Cities     []CityProbability `json:"cities"`
+	// Dropped is the probability of the states dropped because of the truncation.
+	// The true probabilities are between Probability and Probability+Dropped.
+	Dropped float64 `json:"dropped"`
+	// MaxStates is the maximum number of states in one iteration.
+	MaxStates int `json:"max_states"`
+}
+
+// DefaultPlacement returns the placement used by NewAlienCommander: one alien per
+// city in the order of the city IDs.
+func DefaultPlacement(wm *WorldMap, numberOfAliens int) []int {
+	var placement []int
+	for i := 0; i < numberOfAliens && i < len(wm.Cities); i++ {
+		placement = append(placement, i)
+	}
+	return placement
+}
+
+type markovState struct {
+	// positions contains the city of every alien or -1 if the alien is killed.
+	positions []int
+	destroyed uint64
+}
+
+func (s markovState) key() string {
+	var sb strings.Builder
+	for _, p := range s.positions {
+		sb.WriteString(fmt.Sprintf("%d,", p))
+	}
+	sb.WriteString(fmt.Sprintf("%x", s.destroyed))
+	return sb.String()
+}
+
+// SolveMarkov computes the probability of every city of the world map to be destroyed
+// within opts.Iterations iterations of the invasion. The roads must be one
+// iteration long.
+func SolveMarkov(wm *WorldMap, opts MarkovOptions) (MarkovResult, error) {
+	if len(wm.Cities) > maxMarkovCities {
+		return MarkovResult{}, fmt.Errorf("the world map has %d cities. The analytic solver supports maximum %d cities", len(wm.Cities), maxMarkovCities)
+	}
+	for _, c := range wm.Cities {
+		for _, r := range c.Roads {
+			if r.travelTime() > 1 {
+				return MarkovResult{}, fmt.Errorf("the road %s of the city %s is %d iterations long. The analytic solver supports only roads of one iteration", r, c.Name, r.Length)
+			}
+		}
+	}
+	start := markovState{positions: append([]int(nil), opts.Placement...)}
+	for _, p := range start.positions {
+		if p < 0 || p >= len(wm.Cities) {
+			return MarkovResult{}, fmt.Errorf("wrong placement: there is no city with ID %d", p)
+		}
+	}
+	start = resolveCollisions(start)
+
+	neighbours := make([][]int, len(wm.Cities))
+	for i := range wm.Cities {
+		neighbours[i] = wm.Neighbours(i)
+	}
+
+	res := MarkovResult{Iterations: opts.Iterations}
+	states := map[string]markovState{start.key(): start}
+	probabilities := map[string]float64{start.key(): 1}
+	for i := 0; i < opts.Iterations; i++ {
+		nextStates := map[string]markovState{}
+		nextProbabilities := map[string]float64{}
+		for k, s := range states {
+			for _, t := range transitions(s, neighbours, probabilities[k]) {
+				nk := t.state.key()
+				nextStates[nk] = t.state
+				nextProbabilities[nk] += t.probability
+			}
+		}
+
+		if opts.Epsilon > 0 {
+			for k, p := range nextProbabilities {
+				if p < opts.Epsilon {
+					res.Dropped += p
+					delete(nextProbabilities, k)
+					delete(nextStates, k)
+				}
+			}
+		}
+		states, probabilities = nextStates, nextProbabilities
+		if len(states) > res.MaxStates {
+			res.MaxStates = len(states)
+		}
+	}
+
+	destroyed := make([]float64, len(wm.Cities))
+	for k, s := range states {
+		for c := range wm.Cities {
+			if s.destroyed&(1<<uint(c)) != 0 {
+				destroyed[c] += probabilities[k]
+			}
+		}
+	}
+	res.Cities = make([]CityProbability, len(wm.Cities))
+	for i, c := range wm.Cities {
+		res.Cities[i] = CityProbability{Name: c.Name, Probability: destroyed[i]}
+	}
+	return res, nil
+}
+
+type transition struct {
+	state       markovState
+	probability float64
+}
+
+// transitions returns the states reachable from the state s in one iteration.
+func transitions(s markovState, neighbours [][]int, p float64) []transition {
+	var alive int
+	var canMove bool
+	options := make([][]int, len(s.positions))
+	for a, c := range s.positions {
+		if c < 0 {
+			continue
+		}
+		alive++
+		for _, n := range neighbours[c] {
+			if s.destroyed&(1<<uint(n)) == 0 {
+				options[a] = append(options[a], n)
+			}
+		}
+		if len(options[a]) > 0 {
+			canMove = true
+		}
+	}
+	// the commander stops the invasion, so the state doesn't change anymore
+	if alive <= 1 || !canMove {
+		return []transition{{state: s, probability: p}}
+	}
+
+	var result []transition
+	positions := make([]int, len(s.positions))
+	var choose func(a int, p float64)
+	choose = func(a int, p float64) {
+		if a == len(positions) {
+			next := markovState{positions: append([]int(nil), positions...), destroyed: s.destroyed}
+			result = append(result, transition{state: resolveCollisions(next), probability: p})
+			return
+		}
+		if s.positions[a] < 0 || len(options[a]) == 0 {
+			// killed aliens and trapped aliens stay where they are
+			positions[a] = s.positions[a]
+			choose(a+1, p)
+			return
+		}
+		for _, n := range options[a] {
+			positions[a] = n
+			choose(a+1, p/float64(len(options[a])))
+		}
+	}
+	choose(0, p)
+	return result
+}
+
+// resolveCollisions destroys the cities with more than one alien and kills the aliens in them.
+func resolveCollisions(s markovState) markovState {
+	count := map[int]int{}
+	for _, c := range s.positions {
+		if c >= 0 {
+			count[c]++
+		}
+	}
+	for a, c := range s.positions {
+		if c >= 0 && count[c] > 1 {
+			s.destroyed |= 1 << uint(c)
+			s.positions[a] = -1
+		}
+	}
+	return s
+}
+
+// Deviation describes a city whose simulated probability of destruction differs from
+// the analytic one more than the tolerance.
+type Deviation struct {
+	Name      string  `json:"name"`
+	Analytic  float64 `json:"analytic"`
+	Simulated float64 `json:"simulated"`
+	Tolerance float64 `json:"tolerance"`
+}
+
+// CompareWithBatch validates the simulator: it compares the analytic probabilities with
+// the results of a batch that used the same placement and opts.Iterations as maximum
+// number of iterations. The tolerance for every city is z standard errors of the
+// simulated probability plus the probability dropped by the truncation. It returns
+// the cities outside the tolerance.
+func CompareWithBatch(m MarkovResult, b BatchResult, z float64) []Deviation {
+	var deviations []Deviation
+	for i, c := range m.Cities {
+		if i >= len(b.Cities) {
+			break
+		}
+		p := c.Probability
+		tolerance := z*math.Sqrt(p*(1-p)/float64(b.Runs)) + m.Dropped
+		if diff := math.Abs(b.Cities[i].Probability - p); diff > tolerance+1e-9 {
+			deviations = append(deviations, Deviation{
+				Name:      c.Name,
+				Analytic:  p,
+				Simulated: b.Cities[i].Probability,
+				Tolerance: tolerance,
+			})
+		}
+	}
+	return deviations
+}
@@ -0,0 +1,96 @@
+package app_test
+
+import (
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSolveMarkovWhenTwoAliensMustMeet(t *testing.T) {
+	// SETUP
+	// X1 <--> X2 <--> X3, the aliens in X1 and X3 can only go to X2 where they destroy it.
+	wm := app.NewWorldMap([]app.CityInfo{
+		{Name: "X1", Roads: []app.Road{{Direction: app.East, To: "X2"}}},
+		{Name: "X2", Roads: []app.Road{{Direction: app.East, To: "X3"}}},
+	})
+
+	// ACTION
+	actual, err := app.SolveMarkov(wm, app.MarkovOptions{Placement: []int{0, 2}, Iterations: 3})
+
+	// ASSERTIONS
+	expected := []app.CityProbability{{Name: "X1"}, {Name: "X2", Probability: 1}, {Name: "X3"}}
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual.Cities)
+	assert.Zero(t, actual.Dropped)
+}
+
+func TestSolveMarkovWhenTheAliensPassThroughEachOther(t *testing.T) {
+	// SETUP
+	// X1 <--> X2, the aliens swap their cities in every iteration and never meet.
+	wm := app.NewWorldMap([]app.CityInfo{{Name: "X1", Roads: []app.Road{{Direction: app.East, To: "X2"}}}})
+
+	// ACTION
+	actual, err := app.SolveMarkov(wm, app.MarkovOptions{Placement: []int{0, 1}, Iterations: 10})
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, []app.CityProbability{{Name: "X1"}, {Name: "X2"}}, actual.Cities)
+}
+
+func TestSolveMarkovWithWrongPlacement(t *testing.T) {
+	// SETUP
+	wm := createWorldMap()
+
+	// ACTION
+	_, err := app.SolveMarkov(wm, app.MarkovOptions{Placement: []int{0, 9}, Iterations: 1})
+
+	// ASSERTIONS
+	assert.EqualError(t, err, "wrong placement: there is no city with ID 9")
+}
+
+func TestSolveMarkovWithLongRoads(t *testing.T) {
+	// SETUP
+	wm := app.NewWorldMap([]app.CityInfo{{Name: "X1", Roads: []app.Road{{Direction: app.East, To: "X2", Length: 2}}}})
+
+	// ACTION
+	_, err := app.SolveMarkov(wm, app.MarkovOptions{Placement: []int{0, 1}, Iterations: 1})
+
+	// ASSERTIONS
+	assert.EqualError(t, err, "the road east=X2:2 of the city X1 is 2 iterations long. The analytic solver supports only roads of one iteration")
+}
+
+func TestSolveMarkovTruncated(t *testing.T) {
+	// SETUP
+	wm := createWorldMap()
+	placement := app.DefaultPlacement(wm, 4)
+
+	// ACTION
+	exact, err1 := app.SolveMarkov(wm, app.MarkovOptions{Placement: placement, Iterations: 5})
+	truncated, err2 := app.SolveMarkov(wm, app.MarkovOptions{Placement: placement, Iterations: 5, Epsilon: 1e-3})
+
+	// ASSERTIONS
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.Greater(t, truncated.Dropped, 0.0)
+	for i, c := range exact.Cities {
+		assert.LessOrEqual(t, truncated.Cities[i].Probability, c.Probability+1e-9)
+		assert.GreaterOrEqual(t, truncated.Cities[i].Probability+truncated.Dropped, c.Probability-1e-9)
+	}
+}
+
+func TestSimulatorAgreesWithMarkovChain(t *testing.T) {
+	// SETUP
+	wm := createWorldMap()
+	iterations := 6
+	analytic, err := app.SolveMarkov(wm, app.MarkovOptions{Placement: app.DefaultPlacement(wm, 3), Iterations: iterations})
+
+	// ACTION
+	simulated, batchErr := app.RunBatch(wm, app.BatchOptions{Runs: 2000, Aliens: 3, MaxIterations: iterations, Seed: 1})
+	deviations := app.CompareWithBatch(analytic, simulated, 4)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.NoError(t, batchErr)
+	assert.Empty(t, deviations)
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/EmilGeorgiev/alvasion/metrics"
+)
+
+// Metrics counts what happens in the invasions that use it (see WithMetrics). One
+// Metrics is meant to be shared by all invasions of a process, for example the runs
+// of a batch or the invasions of the server. A nil Metrics counts nothing.
+type Metrics struct {
+	aliens     *metrics.Gauge
+	invasions  *metrics.Gauge
+	destroyed  *metrics.Counter
+	iterations *metrics.Meter
+	moves      *metrics.Meter
+
+	mu     sync.Mutex
+	cities map[*City]struct{}
+}
+
+// NewMetrics creates the metrics of the invasions and registers them in the registry.
+func NewMetrics(r *metrics.Registry) *Metrics {
+	m := &Metrics{
+		aliens:     r.Gauge("alvasion_active_aliens", "Number of aliens that are alive in the running invasions."),
+		invasions:  r.Gauge("alvasion_running_invasions", "Number of invasions that are running."),
+		destroyed:  r.Counter("alvasion_destroyed_cities_total", "Number of cities destroyed in all invasions."),
+		iterations: r.Meter("alvasion_iterations", "Number of iterations of all invasions"),
+		moves:      r.Meter("alvasion_moves", "Number of moves of aliens from one city to another in all invasions"),
+		cities:     map[*City]struct{}{},
+	}
+	r.GaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	r.GaugeVecFunc("alvasion_city_backlog", "Number of aliens on the roads to the city that the city has not received yet, summed over the running invasions.", "city", m.backlog)
+	return m
+}
+
+// start adds the cities of an invasion that starts.
+func (m *Metrics) start(cities []*City) {
+	if m == nil {
+		return
+	}
+	m.invasions.Add(1)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range cities {
+		m.cities[c] = struct{}{}
+	}
+}
+
+// stop removes the cities of an invasion that is over.
+func (m *Metrics) stop(cities []*City) {
+	if m == nil {
+		return
+	}
+	m.invasions.Add(-1)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range cities {
+		delete(m.cities, c)
+	}
+}
+
+// backlog returns the number of aliens waiting in the incoming roads of every city.
+// It reads only the lengths of the channels, so the cities are not stopped.
+func (m *Metrics) backlog() []metrics.Sample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	byName := map[string]int{}
+	for c := range m.cities {
+		n := byName[c.Name]
+		for _, in := range c.incoming {
+			n += len(in)
+		}
+		byName[c.Name] = n
+	}
+	samples := make([]metrics.Sample, 0, len(byName))
+	for name, n := range byName {
+		samples = append(samples, metrics.Sample{Label: name, Value: float64(n)})
+	}
+	return samples
+}
+
+func (m *Metrics) alienStarted() {
+	if m != nil {
+		m.aliens.Add(1)
+	}
+}
+
+func (m *Metrics) alienStopped() {
+	if m != nil {
+		m.aliens.Add(-1)
+	}
+}
+
+func (m *Metrics) alienMoved() {
+	if m != nil {
+		m.moves.Mark(1)
+	}
+}
+
+func (m *Metrics) cityDestroyed() {
+	if m != nil {
+		m.destroyed.Inc()
+	}
+}
+
+func (m *Metrics) iterationFinished() {
+	if m != nil {
+		m.iterations.Mark(1)
+	}
+}
@@ -0,0 +1,50 @@
+package app_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/EmilGeorgiev/alvasion/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvasionWithMetrics(t *testing.T) {
+	// SETUP
+	r := metrics.NewRegistry()
+	m := app.NewMetrics(r)
+	wm := app.GenerateGrid(4, 4)
+
+	// ACTION
+	var moves int
+	var destroyed int
+	var iterations int
+	for seed := int64(0); seed < 3; seed++ {
+		ac := app.NewAlienCommander(wm, 6, app.NewSeededRandomPath(seed), io.Discard, 100,
+			app.WithPlacement(app.NewUniformPlacement(seed, false)), app.WithMetrics(m))
+		assert.NoError(t, ac.StartInvasion())
+		for _, e := range ac.Events() {
+			if e.Type == app.AlienMoved {
+				moves++
+			}
+		}
+		destroyed += len(ac.Result().DestroyedCities)
+		iterations += ac.Result().Iterations
+	}
+	buf := bytes.NewBufferString("")
+	err := r.WriteText(buf)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	text := buf.String()
+	assert.Contains(t, text, "\nalvasion_active_aliens 0\n")
+	assert.Contains(t, text, "\nalvasion_running_invasions 0\n")
+	assert.Contains(t, text, fmt.Sprintf("\nalvasion_destroyed_cities_total %d\n", destroyed))
+	assert.Contains(t, text, fmt.Sprintf("\nalvasion_iterations_total %d\n", iterations))
+	assert.Contains(t, text, fmt.Sprintf("\nalvasion_moves_total %d\n", moves))
+	assert.Contains(t, text, "# TYPE go_goroutines gauge\n")
+	// the cities of the finished invasions are not tracked anymore
+	assert.Contains(t, text, "# TYPE alvasion_city_backlog gauge\n# HELP")
+}
@@ -0,0 +1,116 @@
+package app_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+// The seed corpus of the fuzz targets is in testdata/fuzz. The targets run as
+// normal tests with it; to search for new inputs run for example
+//
+//	go test ./app -run '^$' -fuzz FuzzParseWorldMap -fuzztime 1m
+
+func FuzzValidateLines(f *testing.F) {
+	f.Fuzz(func(t *testing.T, text string) {
+		// SETUP
+		lines := make(chan app.Line, 1)
+		parts := make(chan []string, 1)
+		errs := make(chan error, 1)
+		lines <- app.Line{Text: text, Number: 1}
+		close(lines)
+
+		// ACTION
+		app.ValidateLines(lines, parts, errs)
+
+		// ASSERTIONS
+		// every line is either accepted or rejected
+		assert.Equal(t, 1, len(parts)+len(errs))
+		if len(errs) > 0 {
+			return
+		}
+		p := <-parts
+		assert.Equal(t, text, strings.Join(p, " "))
+		assert.True(t, len(p) >= 2 && len(p) <= 5, "the number of parts is %d", len(p))
+		for _, road := range p[1:] {
+			sep := "="
+			if !strings.Contains(road, sep) {
+				sep = "->"
+			}
+			r := strings.Split(road, sep)
+			if assert.Len(t, r, 2) {
+				_, err := app.ParseDirection(r[0])
+				assert.NoError(t, err)
+				to := strings.Split(r[1], ":")[0]
+				assert.NotEmpty(t, to, "the road %s has no destination", road)
+				assert.NotEqual(t, p[0], to, "the road %s leads to the city itself", road)
+			}
+		}
+	})
+}
+
+func FuzzGenerateWorldMap(f *testing.F) {
+	f.Fuzz(func(t *testing.T, text string) {
+		// SETUP
+		// the parts are not validated, so GenerateWorldMap must cope with anything
+		parts := make(chan []string, 16)
+		go func() {
+			for _, line := range strings.Split(text, "\n") {
+				parts <- strings.Split(line, " ")
+			}
+			close(parts)
+		}()
+
+		// ACTION
+		wm := app.GenerateWorldMap(parts)
+
+		// ASSERTIONS
+		assertSymmetric(t, wm)
+	})
+}
+
+func FuzzParseWorldMap(f *testing.F) {
+	f.Fuzz(func(t *testing.T, text string) {
+		// ACTION
+		wm, errs := app.ParseWorldMap(strings.NewReader(text), 3)
+		if len(errs) > 0 {
+			assert.Nil(t, wm)
+			return
+		}
+		again, againErrs := app.ParseWorldMap(strings.NewReader(wm.String()), 3)
+
+		// ASSERTIONS
+		assertSymmetric(t, wm)
+		// parse -> serialize -> parse is the identity
+		assert.Empty(t, againErrs)
+		assert.Equal(t, wm, again)
+	})
+}
+
+// assertSymmetric asserts that the cities are sorted by name, that the ID of every
+// city is its index and that every road leads to another city with a road back
+// unless the road is one-way.
+func assertSymmetric(t *testing.T, wm *app.WorldMap) {
+	t.Helper()
+	for i, c := range wm.Cities {
+		assert.Equal(t, i, c.ID)
+		if i > 0 {
+			assert.Less(t, wm.Cities[i-1].Name, c.Name)
+		}
+		for _, r := range c.Roads {
+			assert.NotEmpty(t, r.To, "the road %s %s has no destination", c.Name, r)
+			assert.NotEqual(t, c.Name, r.To, "the road %s %s leads to the city itself", c.Name, r)
+			id, ok := wm.CityID(r.To)
+			if !assert.True(t, ok, "the road %s %s leads to a city that is not in the world map", c.Name, r) {
+				continue
+			}
+			back := r.OneWay
+			for _, br := range wm.Cities[id].Roads {
+				back = back || br.To == c.Name
+			}
+			assert.True(t, back, "the road %s %s has no road back", c.Name, r)
+		}
+	}
+}
@@ -2,10 +2,13 @@ package app_test
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"github.com/EmilGeorgiev/alvasion/app"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,7 +16,8 @@ import (
 
 func TestReadLines(t *testing.T) {
 	// SETUP
-	createFileWithLines("world-map.txt", []string{
+	fileName := filepath.Join(t.TempDir(), "world-map.txt")
+	createFileWithLines(fileName, []string{
 		"Foo west=Baz east=Boo north=Zerty south=Hepp",
 		"Baz east=Foo west=Nzas north=Lkert south=Jjer",
 		"Nzas west=Jett east=Baz north=Poelk south=Xols",
@@ -23,7 +27,7 @@ func TestReadLines(t *testing.T) {
 	lines := make(chan app.Line)
 
 	// ACTION
-	go app.ReadLines("world-map.txt", lines)
+	go app.ReadLines(fileName, lines)
 
 	actualLine1 := <-lines
 	actualLine2 := <-lines
@@ -154,6 +158,48 @@ func TestValidateLineContainsOnlyCityName(t *testing.T) {
 	assert.Equal(t, expectedErrs, actualErrs)
 }
 
+func TestValidateLineWithCityNameThatContainsEqualSign(t *testing.T) {
+	// SETUP
+	lines := make(chan app.Line, 2)
+	parts := make(chan []string, 2)
+	errs := make(chan error, 2)
+	lines <- app.Line{Text: "Foo=Bar south=Baz", Number: 1}
+	lines <- app.Line{Text: "Nzas west=Jett", Number: 2}
+	close(lines)
+
+	// ACTION
+	app.ValidateLines(lines, parts, errs)
+
+	// ASSERTION
+	expectedErr := fmt.Errorf("line number: %d has wrong format. The name of the city can't contain '=', ':' or '->', "+
+		"because the roads to it couldn't be read. Expect something like 'Foo west=Bar north=Baz' got: %s\n", 1, "Foo=Bar south=Baz")
+	assert.Equal(t, expectedErr, <-errs)
+	assert.Equal(t, []string{"Nzas", "west=Jett"}, <-parts)
+	assert.Empty(t, errs)
+	assert.Empty(t, parts)
+}
+
+func TestValidateLineWithEmptyCityName(t *testing.T) {
+	// SETUP
+	lines := make(chan app.Line, 2)
+	parts := make(chan []string, 2)
+	errs := make(chan error, 2)
+	lines <- app.Line{Text: " north=X1", Number: 1}
+	lines <- app.Line{Text: "Nzas west=Jett", Number: 2}
+	close(lines)
+
+	// ACTION
+	app.ValidateLines(lines, parts, errs)
+
+	// ASSERTION
+	expectedErr := fmt.Errorf("line number: %d has wrong format. The name of the city can't be empty. "+
+		"Expect something like 'Foo west=Bar north=Baz' got: %s\n", 1, " north=X1")
+	assert.Equal(t, expectedErr, <-errs)
+	assert.Equal(t, []string{"Nzas", "west=Jett"}, <-parts)
+	assert.Empty(t, errs)
+	assert.Empty(t, parts)
+}
+
 func TestValidateLineContainsMoreThan5Parts(t *testing.T) {
 	// SETUP
 	lines := make(chan app.Line)
@@ -229,8 +275,8 @@ func TestValidateLinesWithWrongRoadsFormat(t *testing.T) {
 
 	// ASSERTION
 	expectedErrs := []error{
-		fmt.Errorf("on line %d the road number %d has wrong format. Expected something like 'west=Baz' got %s", 1, 2, "eastBoo"),
-		fmt.Errorf("on line %d the road number %d has wrong format. Expected something like 'west=Baz' got %s", 2, 3, "northLkert"),
+		fmt.Errorf("on line %d the road number %d has wrong format. Expected something like 'west=Baz' or 'west->Baz' got %s", 1, 2, "eastBoo"),
+		fmt.Errorf("on line %d the road number %d has wrong format. Expected something like 'west=Baz' or 'west->Baz' got %s", 2, 3, "northLkert"),
 	}
 
 	assert.Equal(t, actualPartsForLine3, []string{"Nzas", "west=Jett"})
@@ -287,6 +333,124 @@ func TestValidateLinesWithWrongRoadDirection(t *testing.T) {
 	assert.Equal(t, expectedErrs, actualErrs)
 }
 
+func TestValidateLinesWithWrongRoadLength(t *testing.T) {
+	// SETUP
+	lines := make(chan app.Line, 5)
+	parts := make(chan []string, 5)
+	errs := make(chan error, 5)
+	lines <- app.Line{Text: "Foo west=Baz:0", Number: 1}
+	lines <- app.Line{Text: "Baz east=Foo:x", Number: 2}
+	lines <- app.Line{Text: "Too west=Baz east=Boo:", Number: 3}
+	lines <- app.Line{Text: "Nzas west=Jett:2", Number: 4}
+	close(lines)
+
+	// ACTION
+	app.ValidateLines(lines, parts, errs)
+	close(errs)
+
+	// ASSERTION
+	var actualErrs []error
+	for err := range errs {
+		actualErrs = append(actualErrs, err)
+	}
+	expectedErrs := []error{
+		fmt.Errorf("on the line %d the road number %d has wrong length. Expected a positive number like 'west=Baz:3' got %s", 1, 1, "west=Baz:0"),
+		fmt.Errorf("on the line %d the road number %d has wrong length. Expected a positive number like 'west=Baz:3' got %s", 2, 1, "east=Foo:x"),
+		fmt.Errorf("on the line %d the road number %d has wrong length. Expected a positive number like 'west=Baz:3' got %s", 3, 2, "east=Boo:"),
+	}
+	assert.Equal(t, expectedErrs, actualErrs)
+	assert.Equal(t, []string{"Nzas", "west=Jett:2"}, <-parts)
+	assert.Empty(t, parts)
+}
+
+func TestValidateLinesWithWrongRoadCapacity(t *testing.T) {
+	// SETUP
+	lines := make(chan app.Line, 5)
+	parts := make(chan []string, 5)
+	errs := make(chan error, 5)
+	lines <- app.Line{Text: "Foo west=Baz:2:0", Number: 1}
+	lines <- app.Line{Text: "Baz east=Foo:2:x", Number: 2}
+	lines <- app.Line{Text: "Too west=Baz east=Boo:x:2", Number: 3}
+	lines <- app.Line{Text: "Nzas west=Jett:2:3", Number: 4}
+	close(lines)
+
+	// ACTION
+	app.ValidateLines(lines, parts, errs)
+	close(errs)
+
+	// ASSERTION
+	var actualErrs []error
+	for err := range errs {
+		actualErrs = append(actualErrs, err)
+	}
+	expectedErrs := []error{
+		fmt.Errorf("on the line %d the road number %d has wrong capacity. Expected a positive number like 'west=Baz:3:2' got %s", 1, 1, "west=Baz:2:0"),
+		fmt.Errorf("on the line %d the road number %d has wrong capacity. Expected a positive number like 'west=Baz:3:2' got %s", 2, 1, "east=Foo:2:x"),
+		fmt.Errorf("on the line %d the road number %d has wrong length. Expected a positive number like 'west=Baz:3' got %s", 3, 2, "east=Boo:x:2"),
+	}
+	assert.Equal(t, expectedErrs, actualErrs)
+	assert.Equal(t, []string{"Nzas", "west=Jett:2:3"}, <-parts)
+	assert.Empty(t, parts)
+}
+
+func TestValidateLinesWithRoadWithoutDestination(t *testing.T) {
+	// SETUP
+	lines := make(chan app.Line, 5)
+	parts := make(chan []string, 5)
+	errs := make(chan error, 5)
+	lines <- app.Line{Text: "X1 west=", Number: 1}
+	lines <- app.Line{Text: "X1 east=X2 west=:3", Number: 2}
+	lines <- app.Line{Text: "X1 west->", Number: 3}
+	lines <- app.Line{Text: "X3 west=X2", Number: 4}
+	close(lines)
+
+	// ACTION
+	app.ValidateLines(lines, parts, errs)
+	close(errs)
+
+	// ASSERTION
+	var actualErrs []error
+	for err := range errs {
+		actualErrs = append(actualErrs, err)
+	}
+	expectedErrs := []error{
+		fmt.Errorf("on the line %d the road number %d has no destination. Expected something like 'west=Baz' or 'west->Baz' got %s", 1, 1, "west="),
+		fmt.Errorf("on the line %d the road number %d has no destination. Expected something like 'west=Baz' or 'west->Baz' got %s", 2, 2, "west=:3"),
+		fmt.Errorf("on the line %d the road number %d has no destination. Expected something like 'west=Baz' or 'west->Baz' got %s", 3, 1, "west->"),
+	}
+	assert.Equal(t, expectedErrs, actualErrs)
+	assert.Equal(t, []string{"X3", "west=X2"}, <-parts)
+	assert.Empty(t, parts)
+}
+
+func TestValidateLinesWithRoadToTheCityItself(t *testing.T) {
+	// SETUP
+	lines := make(chan app.Line, 5)
+	parts := make(chan []string, 5)
+	errs := make(chan error, 5)
+	lines <- app.Line{Text: "X1 north=X1 south=X2", Number: 1}
+	lines <- app.Line{Text: "X2 north=X1 east->X2:2", Number: 2}
+	lines <- app.Line{Text: "X3 west=X2", Number: 3}
+	close(lines)
+
+	// ACTION
+	app.ValidateLines(lines, parts, errs)
+	close(errs)
+
+	// ASSERTION
+	var actualErrs []error
+	for err := range errs {
+		actualErrs = append(actualErrs, err)
+	}
+	expectedErrs := []error{
+		fmt.Errorf("on the line %d the road number %d leads to the city itself. Expected a road to another city got %s", 1, 1, "north=X1"),
+		fmt.Errorf("on the line %d the road number %d leads to the city itself. Expected a road to another city got %s", 2, 2, "east->X2:2"),
+	}
+	assert.Equal(t, expectedErrs, actualErrs)
+	assert.Equal(t, []string{"X3", "west=X2"}, <-parts)
+	assert.Empty(t, parts)
+}
+
 // Test cases for Generate Word Map
 func TestGenerateWorldMap(t *testing.T) {
 	// SETUP
@@ -298,17 +462,16 @@ func TestGenerateWorldMap(t *testing.T) {
 		WestIsNil          bool
 		OutgoingRoadsNames []string
 	}{
-		{Name: "X1", NorthIsNil: true, SouthIsNil: false, EastIsNil: false, WestIsNil: true, OutgoingRoadsNames: []string{"", "south=X4", "east=X2", ""}},
-		{Name: "X2", NorthIsNil: true, SouthIsNil: false, EastIsNil: false, WestIsNil: false, OutgoingRoadsNames: []string{"", "south=X5", "east=X3", "west=X1"}},
-		{Name: "X3", NorthIsNil: true, SouthIsNil: false, EastIsNil: true, WestIsNil: false, OutgoingRoadsNames: []string{"", "south=X6", "", "west=X2"}},
-		{Name: "X4", NorthIsNil: false, SouthIsNil: false, EastIsNil: false, WestIsNil: true, OutgoingRoadsNames: []string{"north=X1", "south=X7", "east=X5", ""}},
+		{Name: "X1", NorthIsNil: true, SouthIsNil: false, EastIsNil: false, WestIsNil: true, OutgoingRoadsNames: []string{"south=X4", "east=X2"}},
+		{Name: "X2", NorthIsNil: true, SouthIsNil: false, EastIsNil: false, WestIsNil: false, OutgoingRoadsNames: []string{"south=X5", "east=X3", "west=X1"}},
+		{Name: "X3", NorthIsNil: true, SouthIsNil: false, EastIsNil: true, WestIsNil: false, OutgoingRoadsNames: []string{"south=X6", "west=X2"}},
+		{Name: "X4", NorthIsNil: false, SouthIsNil: false, EastIsNil: false, WestIsNil: true, OutgoingRoadsNames: []string{"north=X1", "south=X7", "east=X5"}},
 		{Name: "X5", NorthIsNil: false, SouthIsNil: false, EastIsNil: false, WestIsNil: false, OutgoingRoadsNames: []string{"north=X2", "south=X8", "east=X6", "west=X4"}},
-		{Name: "X6", NorthIsNil: false, SouthIsNil: false, EastIsNil: true, WestIsNil: false, OutgoingRoadsNames: []string{"north=X3", "south=X9", "", "west=X5"}},
-		{Name: "X7", NorthIsNil: false, SouthIsNil: true, EastIsNil: false, WestIsNil: true, OutgoingRoadsNames: []string{"north=X4", "", "east=X8", ""}},
-		{Name: "X8", NorthIsNil: false, SouthIsNil: true, EastIsNil: false, WestIsNil: false, OutgoingRoadsNames: []string{"north=X5", "", "east=X9", "west=X7"}},
-		{Name: "X9", NorthIsNil: false, SouthIsNil: true, EastIsNil: true, WestIsNil: false, OutgoingRoadsNames: []string{"north=X6", "", "", "west=X8"}},
+		{Name: "X6", NorthIsNil: false, SouthIsNil: false, EastIsNil: true, WestIsNil: false, OutgoingRoadsNames: []string{"north=X3", "south=X9", "west=X5"}},
+		{Name: "X7", NorthIsNil: false, SouthIsNil: true, EastIsNil: false, WestIsNil: true, OutgoingRoadsNames: []string{"north=X4", "east=X8"}},
+		{Name: "X8", NorthIsNil: false, SouthIsNil: true, EastIsNil: false, WestIsNil: false, OutgoingRoadsNames: []string{"north=X5", "east=X9", "west=X7"}},
+		{Name: "X9", NorthIsNil: false, SouthIsNil: true, EastIsNil: true, WestIsNil: false, OutgoingRoadsNames: []string{"north=X6", "west=X8"}},
 	}
-	// 0 (north), 1 (south), 2 (east), 3 (west)
 	parts := make(chan []string)
 
 	// ACTION
@@ -327,77 +490,147 @@ func TestGenerateWorldMap(t *testing.T) {
 	wm := app.GenerateWorldMap(parts)
 
 	// ASSERTIONS
-	for _, c := range cases {
+	for i, c := range cases {
 		t.Run("Assert "+c.Name, func(t *testing.T) {
-			assert.Equal(t, c.Name, wm[c.Name].Name)
-			assert.Equal(t, c.OutgoingRoadsNames, wm[c.Name].OutgoingRoadsNames)
-
-			assert.Equal(t, c.NorthIsNil, wm[c.Name].OutgoingRoads[0] == nil)
-			assert.Equal(t, c.NorthIsNil, wm[c.Name].IncomingRoads[0] == nil)
-
-			assert.Equal(t, c.SouthIsNil, wm[c.Name].OutgoingRoads[1] == nil)
-			assert.Equal(t, c.SouthIsNil, wm[c.Name].IncomingRoads[1] == nil)
-
-			assert.Equal(t, c.EastIsNil, wm[c.Name].OutgoingRoads[2] == nil)
-			assert.Equal(t, c.EastIsNil, wm[c.Name].IncomingRoads[2] == nil)
+			city := wm.Cities[i]
+			var roadsNames []string
+			directions := map[app.Direction]bool{}
+			for _, r := range city.Roads {
+				roadsNames = append(roadsNames, r.String())
+				directions[r.Direction] = true
+			}
 
-			assert.Equal(t, c.WestIsNil, wm[c.Name].OutgoingRoads[3] == nil)
-			assert.Equal(t, c.WestIsNil, wm[c.Name].IncomingRoads[3] == nil)
+			assert.Equal(t, c.Name, city.Name)
+			assert.Equal(t, i, city.ID)
+			assert.Equal(t, c.OutgoingRoadsNames, roadsNames)
+			assert.Equal(t, c.NorthIsNil, !directions[app.North])
+			assert.Equal(t, c.SouthIsNil, !directions[app.South])
+			assert.Equal(t, c.EastIsNil, !directions[app.East])
+			assert.Equal(t, c.WestIsNil, !directions[app.West])
 		})
 	}
-	assert.Equal(t, 9, len(wm))
+	assert.Equal(t, 9, len(wm.Cities))
 }
 
 func TestGenerateWorldMapConnectProperlyCitiesOnDirectionNorthSouth(t *testing.T) {
 	// SETUP
-
-	// 0 (north), 1 (south), 2 (east), 3 (west)
 	parts := make(chan []string)
 
 	// ACTION
 	go func() {
+		// the road back from X4 to X1 is missing
 		parts <- []string{"X1", "south=X4"}
-		parts <- []string{"X4", "north=X1"}
 		close(parts)
 	}()
 	wm := app.GenerateWorldMap(parts)
-	expectedAlien1 := app.Alien{ID: 1}
-	wm["X1"].OutgoingRoads[1] <- expectedAlien1
-	actualAlien1 := <-wm["X4"].IncomingRoads[0]
-
-	expectedAlien2 := app.Alien{ID: 2}
-	wm["X4"].OutgoingRoads[0] <- expectedAlien2
-	actualAlien2 := <-wm["X1"].IncomingRoads[1]
 
 	// ASSERTIONS
-	assert.Equal(t, expectedAlien1, actualAlien1)
-	assert.Equal(t, expectedAlien2, actualAlien2)
+	expected := []app.CityInfo{
+		{ID: 0, Name: "X1", Roads: []app.Road{{Direction: app.South, To: "X4"}}},
+		{ID: 1, Name: "X4", Roads: []app.Road{{Direction: app.North, To: "X1"}}},
+	}
+	assert.Equal(t, expected, wm.Cities)
 }
 
 func TestGenerateWorldMapConnectProperlyCitiesOnDirectionEastWest(t *testing.T) {
 	// SETUP
-
-	// 0 (north), 1 (south), 2 (east), 3 (west)
 	parts := make(chan []string)
 
 	// ACTION
 	go func() {
-		parts <- []string{"X1", "east=X2"}
 		parts <- []string{"X2", "west=X1"}
+		parts <- []string{"X1", "east=X2"}
 		close(parts)
 	}()
 	wm := app.GenerateWorldMap(parts)
-	expectedAlien1 := app.Alien{ID: 1}
-	wm["X1"].OutgoingRoads[2] <- expectedAlien1
-	actualAlien1 := <-wm["X2"].IncomingRoads[3]
 
-	expectedAlien2 := app.Alien{ID: 2}
-	wm["X2"].OutgoingRoads[3] <- expectedAlien2
-	actualAlien2 := <-wm["X1"].IncomingRoads[2]
+	// ASSERTIONS
+	expected := []app.CityInfo{
+		{ID: 0, Name: "X1", Roads: []app.Road{{Direction: app.East, To: "X2"}}},
+		{ID: 1, Name: "X2", Roads: []app.Road{{Direction: app.West, To: "X1"}}},
+	}
+	assert.Equal(t, expected, wm.Cities)
+	assert.Equal(t, "X1 east=X2\nX2 west=X1\n", wm.String())
+}
+
+func TestParseWorldMap(t *testing.T) {
+	// ACTION
+	wm, errs := app.ParseWorldMap(strings.NewReader("X1 east=X2\nX2 south=X3\n"), 3)
+
+	// ASSERTIONS
+	assert.Empty(t, errs)
+	assert.Equal(t, "X1 east=X2\nX2 south=X3 west=X1\nX3 north=X2\n", wm.String())
+}
+
+func TestParseWorldMapWithRoadLengths(t *testing.T) {
+	// ACTION
+	wm, errs := app.ParseWorldMap(strings.NewReader("X1 east=X2:3\nX2 south=X3:1 west=X1:3\n"), 3)
+
+	// ASSERTIONS
+	assert.Empty(t, errs)
+	assert.Equal(t, []app.Road{{Direction: app.East, To: "X2", Length: 3}}, wm.Cities[0].Roads)
+	assert.Equal(t, app.Road{Direction: app.South, To: "X3"}, wm.Cities[1].Roads[0])
+	// the length of the road back is the same and a length of one is not written
+	assert.Equal(t, "X1 east=X2:3\nX2 south=X3 west=X1:3\nX3 north=X2\n", wm.String())
+}
+
+func TestParseWorldMapWithOneWayRoads(t *testing.T) {
+	// ACTION
+	wm, errs := app.ParseWorldMap(strings.NewReader("X1 east->X2:2 south=X3\nX2 south->X4\n"), 3)
+
+	// ASSERTIONS
+	assert.Empty(t, errs)
+	assert.Equal(t, []app.Road{{Direction: app.South, To: "X3"}, {Direction: app.East, To: "X2", Length: 2, OneWay: true}}, wm.Cities[0].Roads)
+	// the one-way roads don't get a road back and X4 is not written, because it has no road
+	assert.Equal(t, "X1 south=X3 east->X2:2\nX2 south->X4\nX3 north=X1\n", wm.String())
+	assert.Equal(t, []int{2, 1}, wm.Neighbours(0))
+	assert.Empty(t, wm.Neighbours(3))
+	assert.Equal(t, []int{3}, wm.Traps())
+}
+
+func TestParseWorldMapWithRoadCapacities(t *testing.T) {
+	// ACTION
+	wm, errs := app.ParseWorldMap(strings.NewReader("X1 east=X2:3:2 south->X3:1:1\n"), 3)
+
+	// ASSERTIONS
+	assert.Empty(t, errs)
+	assert.Equal(t, []app.Road{{Direction: app.South, To: "X3", OneWay: true, Capacity: 1}, {Direction: app.East, To: "X2", Length: 3, Capacity: 2}}, wm.Cities[0].Roads)
+	// the road back has the same capacity and the length of a road with a capacity
+	// is always written
+	assert.Equal(t, "X1 south->X3:1:1 east=X2:3:2\nX2 west=X1:3:2\n", wm.String())
+}
+
+func TestParseWorldMapWithWrongLines(t *testing.T) {
+	// ACTION
+	wm, errs := app.ParseWorldMap(strings.NewReader("X1 east=X2\nX2\nX3 up=X1\n"), 3)
+
+	// ASSERTIONS
+	assert.Nil(t, wm)
+	assert.Len(t, errs, 2)
+}
+
+func TestParseWorldMapWithoutWorkers(t *testing.T) {
+	// ACTION
+	wm, errs := app.ParseWorldMap(strings.NewReader("X1 east=X2\n"), 0)
 
 	// ASSERTIONS
-	assert.Equal(t, expectedAlien1, actualAlien1)
-	assert.Equal(t, expectedAlien2, actualAlien2)
+	assert.Nil(t, wm)
+	assert.Equal(t, []error{errors.New("the number of workers must be positive, got 0")}, errs)
+}
+
+func TestParseWorldMapWithTooLongLine(t *testing.T) {
+	// SETUP
+	text := "X1 east=X2\nX3 east=" + strings.Repeat("X", 70000) + "\nX4 east=X5\n"
+
+	// ACTION
+	wm, errs := app.ParseWorldMap(strings.NewReader(text), 3)
+
+	// ASSERTIONS
+	assert.Nil(t, wm)
+	if assert.Len(t, errs, 1) {
+		assert.ErrorIs(t, errs[0], bufio.ErrTooLong)
+		assert.EqualError(t, errs[0], "reading the line number 2: bufio.Scanner: token too long")
+	}
 }
 
 func createFileWithLines(fileName string, lines []string) {
@@ -0,0 +1,282 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PlacementStrategy decides in which city every alien starts the invasion.
+type PlacementStrategy interface {
+	// Place returns the ID of the city of every alien: the alien with ID i starts in
+	// the city placement[i]. If the strategy puts only one alien per city and there
+	// are more aliens than cities, the remaining aliens are not placed and the
+	// returned placement is shorter than numberOfAliens.
+	Place(wm *WorldMap, numberOfAliens int) ([]int, error)
+}
+
+// errNoCities is returned by the strategies that choose cities at random, because
+// there is nothing to choose from on a world map without cities.
+var errNoCities = errors.New("the aliens can't be placed, because the world map has no cities")
+
+// SequentialPlacement puts one alien per city in the order of the city IDs: the
+// alien with ID i starts in the city with ID i.
+type SequentialPlacement struct{}
+
+// Place implements PlacementStrategy.
+func (SequentialPlacement) Place(wm *WorldMap, numberOfAliens int) ([]int, error) {
+	return DefaultPlacement(wm, numberOfAliens), nil
+}
+
+// UniformPlacement puts the aliens in cities chosen uniformly at random. Without
+// AllowMultiple the cities are chosen without replacement, so there is maximum
+// one alien per city.
+type UniformPlacement struct {
+	AllowMultiple bool
+	rnd           *rand.Rand
+}
+
+// NewUniformPlacement returns a UniformPlacement with its own source seeded with the seed.
+func NewUniformPlacement(seed int64, allowMultiple bool) UniformPlacement {
+	return UniformPlacement{AllowMultiple: allowMultiple, rnd: rand.New(rand.NewSource(seed))}
+}
+
+// Place implements PlacementStrategy.
+func (p UniformPlacement) Place(wm *WorldMap, numberOfAliens int) ([]int, error) {
+	if len(wm.Cities) == 0 {
+		return nil, errNoCities
+	}
+	if p.AllowMultiple {
+		placement := make([]int, numberOfAliens)
+		for i := range placement {
+			placement[i] = p.rnd.Intn(len(wm.Cities))
+		}
+		return placement, nil
+	}
+
+	perm := p.rnd.Perm(len(wm.Cities))
+	if numberOfAliens < len(perm) {
+		perm = perm[:numberOfAliens]
+	}
+	return perm, nil
+}
+
+// RegionPlacement puts all aliens in one region of the world: the cities closest
+// to the center (by number of roads), one alien per city. If Center is empty a
+// random city is the center.
+type RegionPlacement struct {
+	Center string
+	rnd    *rand.Rand
+}
+
+// NewRegionPlacement returns a RegionPlacement around the center. The seed is used
+// to choose the center if it is empty.
+func NewRegionPlacement(center string, seed int64) RegionPlacement {
+	return RegionPlacement{Center: center, rnd: rand.New(rand.NewSource(seed))}
+}
+
+// Place implements PlacementStrategy.
+func (p RegionPlacement) Place(wm *WorldMap, numberOfAliens int) ([]int, error) {
+	if len(wm.Cities) == 0 {
+		return nil, errNoCities
+	}
+	if p.Center == "" {
+		return spread(wm, []int{p.rnd.Intn(len(wm.Cities))}, numberOfAliens), nil
+	}
+	center, ok := wm.CityID(p.Center)
+	if !ok {
+		return nil, fmt.Errorf("the center of the region %s is not in the world map", p.Center)
+	}
+	return spread(wm, []int{center}, numberOfAliens), nil
+}
+
+// ClusteredPlacement puts the aliens in several clusters: it chooses Clusters random
+// cities as centers and fills the cities around them in turn, one alien per city.
+type ClusteredPlacement struct {
+	Clusters int
+	rnd      *rand.Rand
+}
+
+// NewClusteredPlacement returns a ClusteredPlacement with its own source seeded with the seed.
+func NewClusteredPlacement(clusters int, seed int64) ClusteredPlacement {
+	return ClusteredPlacement{Clusters: clusters, rnd: rand.New(rand.NewSource(seed))}
+}
+
+// Place implements PlacementStrategy.
+func (p ClusteredPlacement) Place(wm *WorldMap, numberOfAliens int) ([]int, error) {
+	if len(wm.Cities) == 0 {
+		return nil, errNoCities
+	}
+	if p.Clusters < 1 || p.Clusters > len(wm.Cities) {
+		return nil, fmt.Errorf("the number of clusters must be between 1 and %d, got %d", len(wm.Cities), p.Clusters)
+	}
+	centers := p.rnd.Perm(len(wm.Cities))[:p.Clusters]
+	return spread(wm, centers, numberOfAliens), nil
+}
+
+// spread visits the cities in breadth-first order starting from all centers at once,
+// so every center gets the closest cities around it, and returns the first n cities.
+// If the cities reachable from the centers are not enough, the rest of the cities
+// are used in the order of their IDs.
+func spread(wm *WorldMap, centers []int, n int) []int {
+	visited := make([]bool, len(wm.Cities))
+	queue := append([]int(nil), centers...)
+	for _, c := range centers {
+		visited[c] = true
+	}
+
+	var placement []int
+	for len(queue) > 0 && len(placement) < n {
+		c := queue[0]
+		queue = queue[1:]
+		placement = append(placement, c)
+		for _, nb := range wm.Neighbours(c) {
+			if !visited[nb] {
+				visited[nb] = true
+				queue = append(queue, nb)
+			}
+		}
+	}
+
+	for c := range wm.Cities {
+		if len(placement) >= n {
+			break
+		}
+		if !visited[c] {
+			visited[c] = true
+			placement = append(placement, c)
+		}
+	}
+	return placement
+}
+
+// ExplicitPlacement puts every alien in the city given for it, for example read
+// from a file with lines like "alien 3 in X5".
+type ExplicitPlacement struct {
+	// Cities maps the ID of an alien to the name of its city.
+	Cities        map[int]string
+	AllowMultiple bool
+}
+
+// Place implements PlacementStrategy. Every alien must have a city.
+func (p ExplicitPlacement) Place(wm *WorldMap, numberOfAliens int) ([]int, error) {
+	placement := make([]int, numberOfAliens)
+	occupied := map[int]int{}
+	for id := 0; id < numberOfAliens; id++ {
+		name, ok := p.Cities[id]
+		if !ok {
+			return nil, fmt.Errorf("there is no city for alien %d", id)
+		}
+		c, ok := wm.CityID(name)
+		if !ok {
+			return nil, fmt.Errorf("the city %s of alien %d is not in the world map", name, id)
+		}
+		if other, ok := occupied[c]; ok && !p.AllowMultiple {
+			return nil, fmt.Errorf("alien %d and alien %d are in the same city %s, but only one alien per city is allowed", other, id, name)
+		}
+		occupied[c] = id
+		placement[id] = c
+	}
+	for id := range p.Cities {
+		if id >= numberOfAliens {
+			return nil, fmt.Errorf("there is a city for alien %d, but there are only %d aliens", id, numberOfAliens)
+		}
+	}
+	return placement, nil
+}
+
+// ReadExplicitPlacement reads a placement with one line per alien in the format
+// "alien 3 in X5". Empty lines and lines starting with # are ignored.
+func ReadExplicitPlacement(r io.Reader, allowMultiple bool) (ExplicitPlacement, error) {
+	p := ExplicitPlacement{Cities: map[int]string{}, AllowMultiple: allowMultiple}
+	scanner := bufio.NewScanner(r)
+	var lineNumber int
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Fields(line)
+		if len(parts) != 4 || parts[0] != "alien" || parts[2] != "in" {
+			return ExplicitPlacement{}, fmt.Errorf("line number: %d of the placement has wrong format. Expected something like 'alien 3 in X5' got: %s", lineNumber, line)
+		}
+		id, err := strconv.Atoi(parts[1])
+		if err != nil || id < 0 {
+			return ExplicitPlacement{}, fmt.Errorf("line number: %d of the placement has wrong alien ID %s", lineNumber, parts[1])
+		}
+		if _, ok := p.Cities[id]; ok {
+			return ExplicitPlacement{}, fmt.Errorf("line number: %d of the placement places alien %d for the second time", lineNumber, id)
+		}
+		p.Cities[id] = parts[3]
+	}
+	if err := scanner.Err(); err != nil {
+		return ExplicitPlacement{}, fmt.Errorf("reading placement: %w", err)
+	}
+	return p, nil
+}
+
+// PlacementSpec describes a placement strategy independently of its seed, so the
+// same spec can create a differently seeded strategy for every invasion of a batch.
+type PlacementSpec struct {
+	// Kind is one of sequential, uniform, region, clustered and file. The zero value is sequential.
+	Kind          string
+	Center        string
+	Clusters      int
+	Explicit      ExplicitPlacement
+	AllowMultiple bool
+}
+
+// ParsePlacementSpec parses the placement used in the config: "sequential", "uniform",
+// "region" (around a random city), "region:X5", "clustered:3" or "file:placement.txt".
+// AllowMultiple allows more than one alien per city for the uniform and file placements.
+func ParsePlacementSpec(spec string, allowMultiple bool) (PlacementSpec, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	ps := PlacementSpec{Kind: kind, AllowMultiple: allowMultiple}
+	switch kind {
+	case "", "sequential", "uniform":
+	case "region":
+		ps.Center = arg
+	case "clustered":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return PlacementSpec{}, fmt.Errorf("wrong placement %q. Expected the number of clusters like 'clustered:3'", spec)
+		}
+		ps.Clusters = n
+	case "file":
+		f, err := os.Open(arg)
+		if err != nil {
+			return PlacementSpec{}, fmt.Errorf("wrong placement %q: %w", spec, err)
+		}
+		defer f.Close()
+
+		if ps.Explicit, err = ReadExplicitPlacement(f, allowMultiple); err != nil {
+			return PlacementSpec{}, err
+		}
+	default:
+		return PlacementSpec{}, fmt.Errorf("unknown placement %q. Expected 'sequential/uniform/region/clustered/file'", spec)
+	}
+	return ps, nil
+}
+
+// Strategy returns the placement strategy described by the spec that uses the seed.
+func (ps PlacementSpec) Strategy(seed int64) PlacementStrategy {
+	switch ps.Kind {
+	case "uniform":
+		return NewUniformPlacement(seed, ps.AllowMultiple)
+	case "region":
+		return NewRegionPlacement(ps.Center, seed)
+	case "clustered":
+		return NewClusteredPlacement(ps.Clusters, seed)
+	case "file":
+		return ps.Explicit
+	default:
+		return SequentialPlacement{}
+	}
+}
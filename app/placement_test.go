@@ -0,0 +1,204 @@
+package app_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequentialPlacement(t *testing.T) {
+	// ACTION
+	actual, err := app.SequentialPlacement{}.Place(createWorldMap(), 12)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8}, actual)
+}
+
+func TestUniformPlacementWithoutMultipleAliensPerCity(t *testing.T) {
+	// ACTION
+	actual, err := app.NewUniformPlacement(5, false).Place(createWorldMap(), 6)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Len(t, actual, 6)
+	occupied := map[int]bool{}
+	for _, c := range actual {
+		assert.False(t, occupied[c], "city %d has more than one alien", c)
+		occupied[c] = true
+	}
+}
+
+func TestUniformPlacementWithMultipleAliensPerCity(t *testing.T) {
+	// ACTION
+	actual, err := app.NewUniformPlacement(5, true).Place(createWorldMap(), 30)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Len(t, actual, 30)
+	for _, c := range actual {
+		assert.True(t, c >= 0 && c < 9)
+	}
+}
+
+func TestRegionPlacement(t *testing.T) {
+	// ACTION
+	actual, err := app.NewRegionPlacement("C4", 1).Place(createWorldMap(), 5)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4, 1, 7, 5, 3}, actual)
+}
+
+func TestRegionPlacementWithUnknownCenter(t *testing.T) {
+	// ACTION
+	_, err := app.NewRegionPlacement("Foo", 1).Place(createWorldMap(), 5)
+
+	// ASSERTIONS
+	assert.EqualError(t, err, "the center of the region Foo is not in the world map")
+}
+
+func TestPlacementOnAWorldMapWithoutCities(t *testing.T) {
+	cases := []struct {
+		name     string
+		strategy app.PlacementStrategy
+		expected string
+	}{
+		{name: "sequential", strategy: app.SequentialPlacement{}},
+		{name: "uniform", strategy: app.NewUniformPlacement(1, false), expected: "the aliens can't be placed, because the world map has no cities"},
+		{name: "uniform with multiple aliens per city", strategy: app.NewUniformPlacement(1, true), expected: "the aliens can't be placed, because the world map has no cities"},
+		{name: "region", strategy: app.NewRegionPlacement("", 1), expected: "the aliens can't be placed, because the world map has no cities"},
+		{name: "region with center", strategy: app.NewRegionPlacement("C4", 1), expected: "the aliens can't be placed, because the world map has no cities"},
+		{name: "clustered", strategy: app.NewClusteredPlacement(1, 1), expected: "the aliens can't be placed, because the world map has no cities"},
+		{name: "explicit", strategy: app.ExplicitPlacement{Cities: map[int]string{0: "C4", 1: "C5"}}, expected: "the city C4 of alien 0 is not in the world map"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// ACTION
+			actual, err := c.strategy.Place(app.NewWorldMap(nil), 2)
+
+			// ASSERTIONS
+			if c.expected == "" {
+				assert.NoError(t, err)
+				assert.Empty(t, actual)
+				return
+			}
+			assert.EqualError(t, err, c.expected)
+		})
+	}
+}
+
+func TestClusteredPlacement(t *testing.T) {
+	// ACTION
+	actual, err := app.NewClusteredPlacement(2, 3).Place(createWorldMap(), 9)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8}, actual)
+}
+
+func TestReadExplicitPlacement(t *testing.T) {
+	// SETUP
+	r := strings.NewReader("# the placement of the aliens\nalien 1 in C4\n\nalien 0 in C2\n")
+
+	// ACTION
+	p, err := app.ReadExplicitPlacement(r, false)
+	actual, placeErr := p.Place(createWorldMap(), 2)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.NoError(t, placeErr)
+	assert.Equal(t, []int{2, 4}, actual)
+}
+
+func TestExplicitPlacementWithWrongInput(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  string
+		aliens   int
+		expected string
+	}{
+		{name: "wrong format", content: "alien 0 at C2\n", aliens: 1, expected: "line number: 1 of the placement has wrong format. Expected something like 'alien 3 in X5' got: alien 0 at C2"},
+		{name: "wrong alien ID", content: "alien x in C2\n", aliens: 1, expected: "line number: 1 of the placement has wrong alien ID x"},
+		{name: "alien placed twice", content: "alien 0 in C2\nalien 0 in C3\n", aliens: 1, expected: "line number: 2 of the placement places alien 0 for the second time"},
+		{name: "unknown city", content: "alien 0 in Foo\n", aliens: 1, expected: "the city Foo of alien 0 is not in the world map"},
+		{name: "missing alien", content: "alien 0 in C2\n", aliens: 2, expected: "there is no city for alien 1"},
+		{name: "too many aliens", content: "alien 0 in C2\nalien 1 in C3\n", aliens: 1, expected: "there is a city for alien 1, but there are only 1 aliens"},
+		{name: "two aliens in a city", content: "alien 0 in C2\nalien 1 in C2\n", aliens: 2, expected: "alien 0 and alien 1 are in the same city C2, but only one alien per city is allowed"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// ACTION
+			p, err := app.ReadExplicitPlacement(strings.NewReader(c.content), false)
+			if err == nil {
+				_, err = p.Place(createWorldMap(), c.aliens)
+			}
+
+			// ASSERTIONS
+			assert.EqualError(t, err, c.expected)
+		})
+	}
+}
+
+func TestParsePlacementSpec(t *testing.T) {
+	cases := []struct {
+		spec     string
+		expected app.PlacementSpec
+		err      string
+	}{
+		{spec: "sequential", expected: app.PlacementSpec{Kind: "sequential"}},
+		{spec: "uniform", expected: app.PlacementSpec{Kind: "uniform"}},
+		{spec: "region:C4", expected: app.PlacementSpec{Kind: "region", Center: "C4"}},
+		{spec: "clustered:3", expected: app.PlacementSpec{Kind: "clustered", Clusters: 3}},
+		{spec: "clustered:many", err: "wrong placement \"clustered:many\". Expected the number of clusters like 'clustered:3'"},
+		{spec: "random", err: "unknown placement \"random\". Expected 'sequential/uniform/region/clustered/file'"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.spec, func(t *testing.T) {
+			// ACTION
+			actual, err := app.ParsePlacementSpec(c.spec, false)
+
+			// ASSERTIONS
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, actual)
+		})
+	}
+}
+
+func TestInitialCollisionDestroysTheCityBeforeTheFirstIteration(t *testing.T) {
+	// SETUP
+	p := app.ExplicitPlacement{Cities: map[int]string{0: "C4", 1: "C4"}, AllowMultiple: true}
+	buf := bytes.NewBufferString("")
+	commander := app.NewAlienCommander(createWorldMap(), 2, app.NewSeededRandomPath(1), buf, 10, app.WithPlacement(p))
+
+	// ACTION
+	err := commander.StartInvasion()
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, "C4 is destroyed from alien 0 and alien 1!\n", buf.String())
+	assert.Equal(t, 0, commander.Result().Iterations)
+	assert.Contains(t, commander.Events(), app.Event{Type: app.CityDestroyed, City: "C4", Aliens: []int{0, 1}})
+}
+
+func TestStartInvasionWithWrongPlacement(t *testing.T) {
+	// SETUP
+	p := app.ExplicitPlacement{Cities: map[int]string{0: "Foo"}}
+	commander := app.NewAlienCommander(createWorldMap(), 1, app.NewSeededRandomPath(1), bytes.NewBufferString(""), 10, app.WithPlacement(p))
+
+	// ACTION
+	err := commander.StartInvasion()
+
+	// ASSERTIONS
+	assert.EqualError(t, err, "placing the aliens: the city Foo of alien 0 is not in the world map")
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDOT writes the world map in the DOT language of Graphviz. Every pair of
+// connected cities is drawn with one edge, the one-way roads with an arrow. The
+// destroyed cities are drawn dashed with "(destroyed)" after the name and the
+// roads leading to them are dashed. If the layout is not nil the cities are
+// pinned to their positions on the grid, two inches apart, and the graph is
+// drawn with the neato engine, which respects the positions.
+func (wm *WorldMap) WriteDOT(w io.Writer, destroyed map[string]bool, layout *Layout) error {
+	var sb strings.Builder
+	sb.WriteString("graph world {\n")
+	if layout != nil {
+		sb.WriteString("  layout=neato;\n")
+	}
+	for _, c := range wm.Cities {
+		pos := ""
+		if layout != nil {
+			// the Y axis of Graphviz grows upwards
+			p := layout.Positions[c.ID]
+			pos = fmt.Sprintf(", pos=\"%d,%d!\"", 2*p.X, -2*p.Y)
+		}
+		if destroyed[c.Name] {
+			sb.WriteString(fmt.Sprintf("  %q [shape=box, style=dashed, label=%q%s];\n", c.Name, c.Name+" (destroyed)", pos))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("  %q [shape=box%s];\n", c.Name, pos))
+	}
+	wm.links(func(from, to int, _ Road, back *Road) {
+		var attrs []string
+		if destroyed[wm.Cities[from].Name] || destroyed[wm.Cities[to].Name] {
+			attrs = append(attrs, "style=dashed")
+		}
+		if back == nil {
+			attrs = append(attrs, "dir=forward")
+		}
+		style := ""
+		if len(attrs) > 0 {
+			style = " [" + strings.Join(attrs, ", ") + "]"
+		}
+		sb.WriteString(fmt.Sprintf("  %q -- %q%s;\n", wm.Cities[from].Name, wm.Cities[to].Name, style))
+	})
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
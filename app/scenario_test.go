@@ -0,0 +1,218 @@
+package app_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/EmilGeorgiev/alvasion/config"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "regenerate the golden files of the scenarios in testdata/scenarios")
+
+// TestScenarios runs every scenario in testdata/scenarios with the concurrent and
+// the sequential engine and compares the destruction messages, the event log and the report with the golden
+// files of the scenario. A scenario is a directory with:
+//   - scenario.yaml: the settings in the format of the config file, at least
+//     world_map and number_of_aliens. A placement "file:NAME" is relative to the directory.
+//   - moves.txt (optional): the scripted moves, one direction or "stay" per line in
+//     the order in which the aliens move. Without it the aliens move randomly with the seed.
+//   - output.golden, events.golden and report.golden: the expected results.
+//
+// The compact and the sharded engine choose the paths with a hash of the seed
+// instead of a Randomizer, so they run only the scenarios with scripted moves in
+// which no alien stays and every alien that moves has only one path.
+//
+// To regenerate the golden files after a change of the rules run
+//
+//	go test ./app -run TestScenarios -update
+func TestScenarios(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "scenarios", "*"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dirs)
+
+	for _, dir := range dirs {
+		dir := dir
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			// the golden files are written from the concurrent engine, the others must agree
+			forced := runScenario(t, dir, "concurrent", *update)
+			runScenario(t, dir, "sequential", false)
+			if forced {
+				runScenario(t, dir, "compact", false)
+				runScenario(t, dir, "sharded", false)
+			}
+		})
+	}
+}
+
+// runScenario runs the scenario with the engine and reports whether the scenario
+// has scripted moves and all of them are forced.
+func runScenario(t *testing.T, dir, engine string, update bool) bool {
+	t.Helper()
+	// SETUP
+	cfg, err := config.Load(filepath.Join(dir, "scenario.yaml"), func(string) (string, bool) { return "", false })
+	if !assert.NoError(t, err) || !assert.NoError(t, cfg.Validate()) {
+		return false
+	}
+	f, err := os.Open(cfg.WorldMap)
+	if !assert.NoError(t, err) {
+		return false
+	}
+	defer f.Close()
+	wm, errs := app.ParseWorldMap(f, 1)
+	if !assert.Empty(t, errs) {
+		return false
+	}
+
+	placement := cfg.Placement
+	if strings.HasPrefix(placement, "file:") {
+		placement = "file:" + filepath.Join(dir, strings.TrimPrefix(placement, "file:"))
+	}
+	ps, err := app.ParsePlacementSpec(placement, cfg.MultipleAliensPerCity)
+	if !assert.NoError(t, err) {
+		return false
+	}
+	tc := app.DefaultTermination(cfg.MaxIterations)
+	if cfg.Termination != "" {
+		if tc, err = app.ParseTermination(cfg.Termination); !assert.NoError(t, err) {
+			return false
+		}
+	}
+
+	var r app.Randomizer = app.NewSeededRandomPath(cfg.Seed)
+	script, err := readMoves(filepath.Join(dir, "moves.txt"))
+	if err == nil {
+		script.t = t
+		r = script
+	} else if !assert.ErrorIs(t, err, os.ErrNotExist) {
+		return false
+	}
+
+	out := bytes.NewBufferString("")
+	opts := []app.Option{app.WithPlacement(ps.Strategy(cfg.Seed)), app.WithTermination(tc)}
+	if cfg.HeadOnCollisions {
+		opts = append(opts, app.WithHeadOnCollisions())
+	}
+	var invasion app.Invasion
+	switch engine {
+	case "sequential":
+		invasion = app.NewSequentialCommander(wm, cfg.NumberOfAliens, r, out, cfg.MaxIterations, opts...)
+	case "compact":
+		invasion = app.NewCompactCommander(app.NewCompactGraph(wm), cfg.NumberOfAliens, cfg.Seed, 2, out, cfg.MaxIterations, opts...)
+	case "sharded":
+		g := app.NewCompactGraph(wm)
+		invasion = app.NewShardedCommander(g, app.PartitionGraph(g, 2), cfg.NumberOfAliens, cfg.Seed, out, cfg.MaxIterations, opts...)
+	default:
+		invasion = app.NewAlienCommander(wm, cfg.NumberOfAliens, r, out, cfg.MaxIterations, opts...)
+	}
+
+	// ACTION
+	err = invasion.StartInvasion()
+
+	// ASSERTIONS
+	if !assert.NoError(t, err, engine) {
+		return false
+	}
+	// the compact and the sharded engine don't use the script
+	if script != nil && (engine == "concurrent" || engine == "sequential") {
+		assert.Equal(t, len(script.moves), script.next, "%s: not all scripted moves are used", engine)
+	}
+	events := bytes.NewBufferString("")
+	assert.NoError(t, app.WriteEvents(events, invasion.Events()))
+	assertGolden(t, filepath.Join(dir, "output.golden"), out.String(), engine, update)
+	assertGolden(t, filepath.Join(dir, "events.golden"), events.String(), engine, update)
+	report := invasion.GenerateReportForInvasion()
+	assertGolden(t, filepath.Join(dir, "report.golden"), report, engine, update)
+	if report != "" {
+		_, errs := app.ParseWorldMap(strings.NewReader(report), 1)
+		assert.Empty(t, errs, "%s: the report must be a valid world map", engine)
+	}
+	return script != nil && !script.choices
+}
+
+func assertGolden(t *testing.T, path, actual, engine string, update bool) {
+	t.Helper()
+	if update {
+		assert.NoError(t, os.WriteFile(path, []byte(actual), 0o644))
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if assert.NoError(t, err, "run the test with -update to create the golden file") {
+		assert.Equal(t, string(expected), actual, "%s: %s", engine, path)
+	}
+}
+
+// scriptedMoves is a Randomizer that takes the paths in the directions of the script.
+// An alien without any path is trapped and doesn't use a move of the script.
+type scriptedMoves struct {
+	t     *testing.T
+	moves []string
+	next  int
+	// choices is set if an alien stayed or had more than one path.
+	choices bool
+}
+
+func (s *scriptedMoves) ChoosePath(paths []app.Path) (app.Path, error) {
+	if len(paths) == 0 {
+		return app.Path{}, errors.New("no available paths. The alien is stuck")
+	}
+	if s.next >= len(s.moves) {
+		s.t.Errorf("the scripted moves ran out after %d moves", len(s.moves))
+		return app.Path{}, errors.New("no scripted move")
+	}
+	move := s.moves[s.next]
+	s.next++
+	if len(paths) > 1 || move == "stay" {
+		s.choices = true
+	}
+	if move == "stay" {
+		return app.Path{}, errors.New("the alien stays")
+	}
+	var directions []string
+	for _, p := range paths {
+		if p.Direction.String() == move {
+			return p, nil
+		}
+		directions = append(directions, p.Direction.String())
+	}
+	s.t.Errorf("the scripted move number %d is %s, but the alien can only go %s", s.next, move, strings.Join(directions, ", "))
+	return app.Path{}, errors.New("no such path")
+}
+
+// readMoves reads the script of the moves. Empty lines and everything after # are ignored.
+func readMoves(name string) (*scriptedMoves, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := &scriptedMoves{}
+	scanner := bufio.NewScanner(f)
+	var lineNumber int
+	for scanner.Scan() {
+		lineNumber++
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		move := strings.TrimSpace(line)
+		if move == "" {
+			continue
+		}
+		if move != "stay" {
+			d, err := app.ParseDirection(move)
+			if err != nil {
+				return nil, fmt.Errorf("line number: %d of %s: %w", lineNumber, name, err)
+			}
+			move = d.String()
+		}
+		s.moves = append(s.moves, move)
+	}
+	return s, scanner.Err()
+}
@@ -0,0 +1,417 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Invasion is an engine that runs an invasion of a world map. AlienCommander runs
+// every city and alien in its own goroutine, SequentialCommander runs the same
+// rules in one goroutine.
+type Invasion interface {
+	StartInvasion() error
+	GenerateReportForInvasion() string
+	Events() []Event
+	Result() InvasionResult
+}
+
+// SequentialCommander is the reference implementation of the rules of the
+// invasion. It runs in the goroutine of the caller without any channels, so it is
+// easy to follow and its result can be compared with the result of the concurrent
+// AlienCommander. Two invasions of the same world map with the same placement and
+// randomizers in the same state are identical in both engines: they call the
+// randomizer in the same order with the same paths and produce the same events,
+// destruction messages and report.
+type SequentialCommander struct {
+	worldMap       *WorldMap
+	numberOfAliens int
+	randomizer     Randomizer
+	placement      PlacementStrategy
+	out            io.Writer
+	maxIterations  int
+	termination    TerminationCondition
+	eventHandlers  []func(Event)
+	discardEvents  bool
+	headOn         bool
+
+	cities     []*sequentialCity
+	aliens     []int
+	positions  map[int]int // alien ID -> city ID
+	inTransit  map[int]int // alien ID -> ID of the city at the end of the long road it is on
+	stopReason string
+	iterations int
+	destroyed  []string
+	events     []Event
+
+	// the aliens waiting for room on the full roads and the number of aliens on the
+	// roads keyed by the IDs of the cities where they start and end
+	waiting map[int]int // alien ID -> ID of the city at the end of the road it waits for
+	load    map[[2]int]int
+}
+
+type sequentialCity struct {
+	name  string
+	paths []Path
+	// aliens are the aliens in the city and arriving the aliens that came in the
+	// current iteration and are counted at its end. transit are the aliens on the
+	// long roads to the city.
+	aliens      []int
+	arriving    []sequentialArrival
+	transit     []sequentialArrival
+	isDestroyed bool
+	// departure is the alien that left the city in the current iteration.
+	departure *sequentialDeparture
+}
+
+// sequentialArrival is an alien on the way from the city with the ID from to a
+// city that arrives in the number of iterations.
+type sequentialArrival struct {
+	alien      int
+	from       int
+	iterations int
+}
+
+// sequentialDeparture is an alien that left a city for the city with the ID.
+type sequentialDeparture struct {
+	alien int
+	to    int
+}
+
+// NewSequentialCommander creates a sequential commander with the same arguments
+// as NewAlienCommander. Only the options of the placement, the termination, the
+// event handlers, the event log and the head-on collisions apply, the others are
+// ignored.
+func NewSequentialCommander(wm *WorldMap, numberOfAliens int, r Randomizer, out io.Writer, maxIterations int, opts ...Option) *SequentialCommander {
+	// the options configure an AlienCommander, so they are applied to one and the
+	// settings are copied from it
+	settings := &AlienCommander{placement: SequentialPlacement{}, termination: DefaultTermination(maxIterations)}
+	for _, opt := range opts {
+		opt(settings)
+	}
+
+	sc := &SequentialCommander{
+		worldMap:       wm,
+		numberOfAliens: numberOfAliens,
+		randomizer:     r,
+		placement:      settings.placement,
+		out:            out,
+		maxIterations:  maxIterations,
+		termination:    settings.termination,
+		eventHandlers:  settings.eventHandlers,
+		discardEvents:  settings.discardEvents,
+		headOn:         settings.headOn,
+		positions:      map[int]int{},
+		inTransit:      map[int]int{},
+		waiting:        map[int]int{},
+		load:           map[[2]int]int{},
+	}
+	// the paths are built like the paths of the concurrent cities, so they are in
+	// the same order, but the channels and the entries of the one-way roads are
+	// dropped
+	for _, c := range wm.buildCities() {
+		city := &sequentialCity{name: c.Name}
+		for _, p := range exits(c.paths) {
+			city.paths = append(city.paths, Path{Direction: p.Direction, To: p.To, Length: p.Length, Capacity: p.Capacity, oneWay: p.oneWay})
+		}
+		sc.cities = append(sc.cities, city)
+	}
+	return sc
+}
+
+// StartInvasion runs the invasion like AlienCommander.StartInvasion.
+func (sc *SequentialCommander) StartInvasion() error {
+	start := time.Now()
+	placement, err := sc.placement.Place(sc.worldMap, sc.numberOfAliens)
+	if err != nil {
+		return fmt.Errorf("placing the aliens: %w", err)
+	}
+	for id, cityID := range placement {
+		sc.aliens = append(sc.aliens, id)
+		sc.positions[id] = cityID
+		c := sc.cities[cityID]
+		c.aliens = append(c.aliens, id)
+		sc.record(Event{Type: AlienPlaced, City: c.name, Aliens: []int{id}})
+	}
+
+	if len(sc.positions) > 1 {
+		sc.countAliens(0)
+	}
+	for {
+		canMove := sc.surveyRoads()
+		state := InvasionState{
+			Iterations: sc.iterations,
+			Aliens:     len(sc.positions) + len(sc.inTransit),
+			Cities:     len(sc.cities),
+			Destroyed:  sc.destroyed,
+			CanMove:    canMove,
+			Elapsed:    time.Since(start),
+		}
+		if reason, ok := sc.termination.Met(state); ok {
+			sc.stopReason = reason
+			break
+		}
+		if sc.iterations >= sc.maxIterations {
+			sc.stopReason = IterationsAtLeast(sc.maxIterations).String()
+			break
+		}
+
+		sc.releaseAliens()
+		sc.countAliens(sc.iterations + 1)
+		sc.iterations++
+		sc.record(Event{Iteration: sc.iterations, Type: IterationFinished})
+	}
+	return nil
+}
+
+// surveyRoads removes the paths to the destroyed cities and reports whether at
+// least one alien is in a city with an open path or travels on a long road.
+func (sc *SequentialCommander) surveyRoads() bool {
+	canMove := len(sc.inTransit) > 0
+	for _, c := range sc.cities {
+		if c.isDestroyed {
+			continue
+		}
+		open := c.paths[:0]
+		for _, p := range c.paths {
+			if id, _ := sc.worldMap.CityID(p.To); !sc.cities[id].isDestroyed {
+				open = append(open, p)
+			}
+		}
+		c.paths = open
+		if len(c.aliens) > 0 && len(c.paths) > 0 {
+			canMove = true
+		}
+	}
+	return canMove
+}
+
+// releaseAliens lets the aliens choose a path one by one in the order of their IDs.
+// An alien that waits for room on a full road takes it without choosing again,
+// unless the road is closed.
+func (sc *SequentialCommander) releaseAliens() {
+	for _, id := range sc.aliens {
+		cityID, ok := sc.positions[id]
+		if !ok {
+			continue
+		}
+		c := sc.cities[cityID]
+		if len(c.aliens) != 1 {
+			continue
+		}
+		path, ok := sc.waitingPath(id, cityID)
+		switch {
+		case ok && path.full():
+			continue
+		case !ok:
+			delete(sc.waiting, id)
+			paths := make([]Path, len(c.paths))
+			for i, p := range c.paths {
+				paths[i] = sc.withLoad(cityID, p)
+			}
+			var err error
+			path, err = sc.randomizer.ChoosePath(paths)
+			if err != nil {
+				// the alien is trapped and stays in the city
+				continue
+			}
+		}
+		to, _ := sc.worldMap.CityID(path.To)
+		if path.full() {
+			sc.waiting[id] = to
+			sc.record(Event{Iteration: sc.iterations + 1, Type: AlienQueued, From: c.name, To: path.To, Aliens: []int{id}})
+			continue
+		}
+		delete(sc.waiting, id)
+		sc.load[[2]int{cityID, to}]++
+		c.aliens = nil
+		c.departure = &sequentialDeparture{alien: id, to: to}
+		sc.cities[to].arriving = append(sc.cities[to].arriving, sequentialArrival{alien: id, from: cityID, iterations: path.Length})
+		delete(sc.positions, id)
+		sc.record(Event{Iteration: sc.iterations + 1, Type: AlienMoved, From: c.name, To: path.To, Aliens: []int{id}})
+	}
+}
+
+// waitingPath returns the path the alien in the city waits for with the number of
+// aliens on its road. ok is false if the alien doesn't wait or the road is closed.
+func (sc *SequentialCommander) waitingPath(alien, cityID int) (Path, bool) {
+	to, ok := sc.waiting[alien]
+	if !ok {
+		return Path{}, false
+	}
+	for _, p := range sc.cities[cityID].paths {
+		if p.To == sc.cities[to].name {
+			return sc.withLoad(cityID, p), true
+		}
+	}
+	return Path{}, false
+}
+
+// withLoad returns the path of the city with the number of aliens on its road.
+func (sc *SequentialCommander) withLoad(cityID int, p Path) Path {
+	to, _ := sc.worldMap.CityID(p.To)
+	p.Load = sc.load[[2]int{cityID, to}]
+	return p
+}
+
+// countAliens receives the arriving aliens and destroys the cities with more than
+// one alien in the order of the city IDs. The aliens on the long roads get one
+// iteration closer to the cities before the aliens that left in the iteration
+// get on the roads.
+func (sc *SequentialCommander) countAliens(iteration int) {
+	if sc.headOn {
+		sc.collide(iteration)
+	}
+	for _, c := range sc.cities {
+		c.departure = nil
+	}
+	for cityID, c := range sc.cities {
+		if c.isDestroyed {
+			continue
+		}
+		travelling := c.transit[:0]
+		for _, t := range c.transit {
+			if t.iterations--; t.iterations == 0 {
+				c.aliens = append(c.aliens, t.alien)
+				delete(sc.inTransit, t.alien)
+				sc.load[[2]int{t.from, cityID}]--
+				continue
+			}
+			travelling = append(travelling, t)
+		}
+		c.transit = travelling
+		for _, a := range c.arriving {
+			if a.iterations > 1 {
+				c.transit = append(c.transit, sequentialArrival{alien: a.alien, from: a.from, iterations: a.iterations - 1})
+				sc.inTransit[a.alien] = cityID
+				continue
+			}
+			c.aliens = append(c.aliens, a.alien)
+			sc.load[[2]int{a.from, cityID}]--
+		}
+		c.arriving = nil
+		sort.Ints(c.aliens)
+		sort.Slice(c.transit, func(i, j int) bool {
+			return c.transit[i].alien < c.transit[j].alien
+		})
+		if len(c.aliens) <= 1 {
+			for _, id := range c.aliens {
+				sc.positions[id] = cityID
+			}
+			continue
+		}
+
+		c.isDestroyed = true
+		for _, id := range c.aliens {
+			delete(sc.positions, id)
+			delete(sc.waiting, id)
+		}
+		sc.destroyed = append(sc.destroyed, c.name)
+		sc.record(Event{Iteration: iteration, Type: CityDestroyed, City: c.name, Aliens: c.aliens})
+		_, _ = fmt.Fprintln(sc.out, destructionMessage(c.name, c.aliens))
+		for _, t := range c.transit {
+			delete(sc.inTransit, t.alien)
+			sc.record(Event{Iteration: iteration, Type: AlienLost, City: c.name, Aliens: []int{t.alien}})
+		}
+	}
+}
+
+// collide destroys the roads on which two aliens met, because they left the cities
+// on both ends in the iteration, in the order of the lower IDs of the cities.
+func (sc *SequentialCommander) collide(iteration int) {
+	for cityID, c := range sc.cities {
+		d := c.departure
+		if d == nil || d.to < cityID {
+			continue
+		}
+		other := sc.cities[d.to]
+		if other.departure == nil || other.departure.to != cityID {
+			continue
+		}
+		aliens := []int{d.alien, other.departure.alien}
+		sort.Ints(aliens)
+		c.arriving = withoutArrival(c.arriving, other.departure.alien)
+		other.arriving = withoutArrival(other.arriving, d.alien)
+		c.paths = withoutPath(c.paths, other.name)
+		other.paths = withoutPath(other.paths, c.name)
+		sc.record(Event{Iteration: iteration, Type: RoadDestroyed, From: c.name, To: other.name, Aliens: aliens})
+		_, _ = fmt.Fprintln(sc.out, roadDestructionMessage(c.name, other.name, aliens))
+	}
+}
+
+func withoutArrival(arrivals []sequentialArrival, alien int) []sequentialArrival {
+	left := arrivals[:0]
+	for _, a := range arrivals {
+		if a.alien != alien {
+			left = append(left, a)
+		}
+	}
+	return left
+}
+
+func withoutPath(paths []Path, to string) []Path {
+	left := paths[:0]
+	for _, p := range paths {
+		if p.To != to {
+			left = append(left, p)
+		}
+	}
+	return left
+}
+
+func (sc *SequentialCommander) record(e Event) {
+	if !sc.discardEvents {
+		sc.events = append(sc.events, e)
+	}
+	for _, h := range sc.eventHandlers {
+		h(e)
+	}
+}
+
+// GenerateReportForInvasion returns what is left of the world after the invasion
+// like AlienCommander.GenerateReportForInvasion.
+func (sc *SequentialCommander) GenerateReportForInvasion() string {
+	var sb strings.Builder
+	for _, c := range sc.cities {
+		if c.isDestroyed || len(c.paths) == 0 {
+			continue
+		}
+		sb.WriteString(c.name)
+		for _, p := range c.paths {
+			sb.WriteString(" " + p.road().String())
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Events returns the event log of the invasion. It must be called after StartInvasion.
+func (sc *SequentialCommander) Events() []Event {
+	return append([]Event(nil), sc.events...)
+}
+
+// Result returns the result of the invasion. It must be called after StartInvasion.
+func (sc *SequentialCommander) Result() InvasionResult {
+	res := InvasionResult{
+		Iterations:      sc.iterations,
+		DestroyedCities: append([]string(nil), sc.destroyed...),
+		Positions:       map[int]string{},
+		StopReason:      sc.stopReason,
+	}
+	for _, id := range sc.aliens {
+		if cityID, ok := sc.positions[id]; ok {
+			res.SurvivingAliens = append(res.SurvivingAliens, id)
+			res.Positions[id] = sc.cities[cityID].name
+		}
+		if cityID, ok := sc.inTransit[id]; ok {
+			if res.InTransit == nil {
+				res.InTransit = map[int]string{}
+			}
+			res.SurvivingAliens = append(res.SurvivingAliens, id)
+			res.InTransit[id] = sc.cities[cityID].name
+		}
+	}
+	return res
+}
@@ -0,0 +1,142 @@
+package app_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSequentialCommanderAgreesWithAlienCommander is the differential test of the
+// two engines: both run the same invasions of random world maps and must produce
+// the same destruction messages, events, reports and results.
+func TestSequentialCommanderAgreesWithAlienCommander(t *testing.T) {
+	terminations := []string{"", "aliens<=0", "iterations>=5", "destroyed>=20% or no_movement"}
+	for seed := int64(0); seed < 200; seed++ {
+		rnd := rand.New(rand.NewSource(seed))
+		wm := randomWorldMap(rnd)
+		aliens := rnd.Intn(2*len(wm.Cities) + 1)
+		maxIterations := rnd.Intn(50)
+		multiple := rnd.Intn(2) == 0
+		expr := terminations[rnd.Intn(len(terminations))]
+		headOn := rnd.Intn(2) == 0
+
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			// SETUP
+			opts := func() []app.Option {
+				opts := []app.Option{app.WithPlacement(app.NewUniformPlacement(seed, multiple))}
+				if expr != "" {
+					tc, err := app.ParseTermination(expr)
+					assert.NoError(t, err)
+					opts = append(opts, app.WithTermination(tc))
+				}
+				if headOn {
+					opts = append(opts, app.WithHeadOnCollisions())
+				}
+				return opts
+			}
+			concurrentOut := bytes.NewBufferString("")
+			concurrent := app.NewAlienCommander(wm, aliens, app.NewSeededRandomPath(seed), concurrentOut, maxIterations, opts()...)
+			sequentialOut := bytes.NewBufferString("")
+			sequential := app.NewSequentialCommander(wm, aliens, app.NewSeededRandomPath(seed), sequentialOut, maxIterations, opts()...)
+
+			// ACTION
+			concurrentErr := concurrent.StartInvasion()
+			sequentialErr := sequential.StartInvasion()
+
+			// ASSERTIONS
+			assert.Equal(t, concurrentErr, sequentialErr)
+			if concurrentErr != nil {
+				return
+			}
+			assert.Equal(t, concurrentOut.String(), sequentialOut.String())
+			assert.Equal(t, concurrent.Events(), sequential.Events())
+			assert.Equal(t, concurrent.GenerateReportForInvasion(), sequential.GenerateReportForInvasion())
+			assert.Equal(t, concurrent.Result(), sequential.Result())
+		})
+	}
+}
+
+func TestSequentialCommanderWith9SoldiersAnd9Cities(t *testing.T) {
+	// SETUP
+	mockRand := new(MockRandomizer)
+	mockMovementsOfThe9Aliens(mockRand)
+	buf := bytes.NewBufferString("")
+	sc := app.NewSequentialCommander(createWorldMap(), 9, mockRand, buf, 10000)
+
+	// ACTION
+	err := sc.StartInvasion()
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	expectedReport := "" +
+		"C0 south=C3\n" +
+		"C2 south=C5\n" +
+		"C3 north=C0 south=C6\n" +
+		"C5 north=C2\n" +
+		"C6 north=C3\n"
+	assert.Equal(t, expectedReport, sc.GenerateReportForInvasion())
+	assert.Contains(t, buf.String(), "C1 is destroyed from alien 0 and alien 2!")
+	assert.Contains(t, buf.String(), "C8 is destroyed from alien 5 and alien 7!")
+}
+
+// randomWorldMap returns a grid of up to 6x6 cities in which some of the roads and
+// cities are missing, so there are dead ends and isolated cities. Some roads are
+// one-way, so there are also cities that the aliens can't leave.
+func randomWorldMap(rnd *rand.Rand) *app.WorldMap {
+	width, height := 1+rnd.Intn(6), 1+rnd.Intn(6)
+	name := func(row, col int) string {
+		return fmt.Sprintf("X%d", row*width+col+1)
+	}
+	// the roads are added as cities with one road, NewWorldMap merges them with
+	// the cities
+	var cities, roads []app.CityInfo
+	for row := 0; row < height; row++ {
+		for col := 0; col < width; col++ {
+			if rnd.Intn(10) == 0 {
+				continue
+			}
+			cities = append(cities, app.CityInfo{Name: name(row, col)})
+			if row < height-1 && rnd.Intn(4) != 0 {
+				roads = append(roads, randomRoad(rnd, name(row, col), app.South, name(row+1, col)))
+			}
+			if col < width-1 && rnd.Intn(4) != 0 {
+				roads = append(roads, randomRoad(rnd, name(row, col), app.East, name(row, col+1)))
+			}
+		}
+	}
+	if len(cities) == 0 {
+		cities = append(cities, app.CityInfo{Name: name(0, 0)})
+	}
+	return app.NewWorldMap(append(cities, roads...))
+}
+
+// randomRoad returns the city from with the road in the direction d to the city to.
+// Some roads are one-way and some of them lead the other way, so the city to with
+// the road to from is returned. Half of the long roads carry only one alien at a
+// time.
+func randomRoad(rnd *rand.Rand, from string, d app.Direction, to string) app.CityInfo {
+	r := app.Road{Direction: d, To: to, Length: randomLength(rnd)}
+	if r.Length > 1 && rnd.Intn(2) == 0 {
+		r.Capacity = 1
+	}
+	switch rnd.Intn(8) {
+	case 0:
+		r.OneWay = true
+	case 1:
+		return app.CityInfo{Name: to, Roads: []app.Road{{Direction: d.Opposite(), To: from, Length: r.Length, OneWay: true, Capacity: r.Capacity}}}
+	}
+	return app.CityInfo{Name: from, Roads: []app.Road{r}}
+}
+
+// randomLength returns the length of a road of a random world map. Most roads take
+// one iteration.
+func randomLength(rnd *rand.Rand) int {
+	if rnd.Intn(3) != 0 {
+		return 0
+	}
+	return 2 + rnd.Intn(3)
+}
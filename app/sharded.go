@@ -0,0 +1,551 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Partition assigns every city of a CompactGraph to a shard.
+type Partition struct {
+	// Shards is the shard of every city by city ID.
+	Shards []int32
+	// Sizes is the number of cities of every shard.
+	Sizes []int
+	// Cut is the number of paths between cities of different shards.
+	Cut int
+}
+
+// PartitionGraph splits the cities of the graph in shards of the same size (±1).
+// Every shard grows with a breadth-first search from the first city that is not in
+// a shard yet, so the shards are regions of connected cities with few paths
+// between them. If there are more shards than cities, every city is a shard.
+func PartitionGraph(g *CompactGraph, shards int) Partition {
+	n := len(g.offsets) - 1
+	if shards > n {
+		shards = n
+	}
+	if shards < 1 {
+		shards = 1
+	}
+
+	p := Partition{Shards: make([]int32, n), Sizes: make([]int, shards)}
+	for c := range p.Shards {
+		p.Shards[c] = -1
+	}
+	var next int32 // all cities before next are in a shard
+	queue := make([]int32, 0, n/shards+1)
+	for s := 0; s < shards; s++ {
+		size := n*(s+1)/shards - n*s/shards
+		queue = queue[:0]
+		for head := 0; p.Sizes[s] < size; head++ {
+			if head == len(queue) {
+				// the region can't grow, so it continues with an unassigned city
+				for p.Shards[next] >= 0 {
+					next++
+				}
+				p.Shards[next] = int32(s)
+				p.Sizes[s]++
+				queue = append(queue, next)
+				continue
+			}
+			c := queue[head]
+			for _, to := range g.targets[g.offsets[c]:g.offsets[c+1]] {
+				if p.Shards[to] < 0 && p.Sizes[s] < size {
+					p.Shards[to] = int32(s)
+					p.Sizes[s]++
+					queue = append(queue, to)
+				}
+			}
+		}
+	}
+
+	for c := 0; c < n; c++ {
+		for _, to := range g.targets[g.offsets[c]:g.offsets[c+1]] {
+			// the pairs of cities with paths in both directions are counted once
+			if p.Shards[to] != p.Shards[c] && (int(to) > c || !g.hasPath(to, int32(c))) {
+				p.Cut++
+			}
+		}
+	}
+	return p
+}
+
+// ShardedCommander runs the invasion of CompactCommander on a partitioned graph.
+// Every shard is simulated by its own worker that owns the cities of the shard and
+// the aliens in them. An alien that crosses the border of a shard is handed off to
+// the worker of the other shard through the exchange buffers of the iteration.
+// The paths are chosen like in CompactCommander, so the invasion is the same as
+// the invasion of CompactCommander with the same seed for any partition.
+type ShardedCommander struct {
+	graph          *CompactGraph
+	partition      Partition
+	numberOfAliens int
+	seed           int64
+	placement      PlacementStrategy
+	out            io.Writer
+	maxIterations  int
+	termination    TerminationCondition
+	eventHandlers  []func(Event)
+	discardEvents  bool
+	headOn         bool
+
+	shards []*shard
+	// the state of the cities and the aliens is shared by the workers, but every
+	// worker changes only the state of its cities and aliens
+	positions []int32 // alien ID -> city ID, -1 if the alien is dead
+	// remaining is the number of iterations until the alien arrives in the city of
+	// its position if it is on a long road, otherwise 0.
+	remaining   []int32
+	occupants   []int32 // city ID -> number of aliens in the city
+	isDestroyed []bool
+	alive       int
+	stopReason  string
+	iterations  int
+	destroyed   []string
+	events      []Event
+
+	// closed and departed are the state of the head-on collisions like in
+	// CompactCommander and departedTo is the city the alien that left every city in
+	// the iteration goes to. They are nil without head-on collisions.
+	closed     []bool
+	departed   []int32
+	departedTo []int32
+
+	// traffic is the state of the roads with capacities like in CompactCommander.
+	// Every worker changes only the roads from the cities of its shard, the aliens
+	// that arrived are taken off the roads after all workers are done.
+	traffic *traffic
+}
+
+// shard is the state of the worker of one shard in the current iteration.
+type shard struct {
+	id int32
+	// aliens are the aliens in the cities of the shard and on the long roads to
+	// them sorted by ID.
+	aliens []int32
+	// outbox are the aliens that moved to the cities of the other shards by shard.
+	outbox  [][]int32
+	moves   []Event
+	victims []victim
+	canMove bool
+	// departures are the aliens that left the cities of the shard in the iteration
+	// and crashes the roads they destroyed from the cities with the lower ID.
+	departures []departure
+	crashes    []crash
+	crashed    int
+	// arrived are the aliens that arrived from the long roads in the iteration.
+	arrived []int32
+}
+
+// crash is a road destroyed by the alien that left the city from and the other
+// alien that left the city to.
+type crash struct {
+	from, to, alien, other int32
+}
+
+type victim struct {
+	city, alien int32
+	// lost is set if the alien was on a long road to the city.
+	lost bool
+}
+
+// NewShardedCommander creates a sharded commander of numberOfAliens aliens that
+// choose their paths with the seed. There is a worker for every shard of the
+// partition. Like NewSequentialCommander only the options of the placement, the
+// termination, the event handlers, the event log and the head-on collisions apply.
+func NewShardedCommander(g *CompactGraph, p Partition, numberOfAliens int, seed int64, out io.Writer, maxIterations int, opts ...Option) *ShardedCommander {
+	settings := &AlienCommander{placement: SequentialPlacement{}, termination: DefaultTermination(maxIterations)}
+	for _, opt := range opts {
+		opt(settings)
+	}
+
+	n := len(g.worldMap.Cities)
+	ss := &ShardedCommander{
+		graph:          g,
+		partition:      p,
+		numberOfAliens: numberOfAliens,
+		seed:           seed,
+		placement:      settings.placement,
+		out:            out,
+		maxIterations:  maxIterations,
+		termination:    settings.termination,
+		eventHandlers:  settings.eventHandlers,
+		discardEvents:  settings.discardEvents,
+		headOn:         settings.headOn,
+		occupants:      make([]int32, n),
+		isDestroyed:    make([]bool, n),
+	}
+	if ss.headOn {
+		ss.closed, ss.departed = noCollisions(g)
+		ss.departedTo = make([]int32, n)
+	}
+	for i := range p.Sizes {
+		ss.shards = append(ss.shards, &shard{id: int32(i), outbox: make([][]int32, len(p.Sizes))})
+	}
+	return ss
+}
+
+// StartInvasion runs the invasion like CompactCommander.StartInvasion.
+func (ss *ShardedCommander) StartInvasion() error {
+	start := time.Now()
+	placement, err := ss.placement.Place(ss.graph.worldMap, ss.numberOfAliens)
+	if err != nil {
+		return fmt.Errorf("placing the aliens: %w", err)
+	}
+	ss.positions = make([]int32, len(placement))
+	ss.remaining = make([]int32, len(placement))
+	ss.traffic = newTraffic(ss.graph, len(placement))
+	for id, cityID := range placement {
+		ss.positions[id] = int32(cityID)
+		ss.occupants[cityID]++
+		s := ss.shards[ss.partition.Shards[cityID]]
+		s.aliens = append(s.aliens, int32(id))
+		if ss.recording() {
+			ss.record(Event{Type: AlienPlaced, City: ss.graph.name(int32(cityID)), Aliens: []int{id}})
+		}
+	}
+	ss.alive = len(placement)
+
+	if ss.alive > 1 {
+		ss.countAliens(0)
+	}
+	for {
+		canMove := ss.surveyRoads()
+		state := InvasionState{
+			Iterations: ss.iterations,
+			Aliens:     ss.alive,
+			Cities:     len(ss.occupants),
+			Destroyed:  ss.destroyed,
+			CanMove:    canMove,
+			Elapsed:    time.Since(start),
+		}
+		if reason, ok := ss.termination.Met(state); ok {
+			ss.stopReason = reason
+			break
+		}
+		if ss.iterations >= ss.maxIterations {
+			ss.stopReason = IterationsAtLeast(ss.maxIterations).String()
+			break
+		}
+
+		ss.releaseAliens(ss.iterations + 1)
+		ss.countAliens(ss.iterations + 1)
+		ss.iterations++
+		ss.record(Event{Iteration: ss.iterations, Type: IterationFinished})
+	}
+	return nil
+}
+
+// surveyRoads reports whether at least one alien is in a city with a path to a
+// city that is not destroyed or travels on a long road.
+func (ss *ShardedCommander) surveyRoads() bool {
+	ss.each(func(s *shard) {
+		s.canMove = false
+		for _, a := range s.aliens {
+			if ss.remaining[a] > 0 || ss.graph.openPaths(ss.positions[a], ss.isDestroyed, ss.closed) > 0 {
+				s.canMove = true
+				return
+			}
+		}
+	})
+	for _, s := range ss.shards {
+		if s.canMove {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseAliens moves the aliens in two phases. First every worker moves its
+// aliens and puts the aliens that leave the shard in the outbox of the shard they
+// go to. Then every worker takes the aliens from the outboxes of the other shards.
+// An alien on a long road belongs to the shard of the city it goes to.
+func (ss *ShardedCommander) releaseAliens(iteration int) {
+	ss.each(func(s *shard) {
+		s.moves = s.moves[:0]
+		s.departures = s.departures[:0]
+		s.arrived = s.arrived[:0]
+		for i := range s.outbox {
+			s.outbox[i] = s.outbox[i][:0]
+		}
+		stay := s.aliens[:0]
+		for _, a := range s.aliens {
+			from := ss.positions[a]
+			if ss.remaining[a] > 0 {
+				if ss.remaining[a]--; ss.remaining[a] == 0 {
+					ss.occupants[from]++
+					if ss.traffic != nil {
+						s.arrived = append(s.arrived, a)
+					}
+				}
+				stay = append(stay, a)
+				continue
+			}
+			j, now := ss.graph.choose(ss.traffic, ss.seed, iteration, a, from, ss.isDestroyed, ss.closed)
+			if !now {
+				if j >= 0 && ss.recording() {
+					s.moves = append(s.moves, Event{Iteration: iteration, Type: AlienQueued, From: ss.graph.name(from), To: ss.graph.name(ss.graph.targets[j]), Aliens: []int{int(a)}})
+				}
+				stay = append(stay, a)
+				continue
+			}
+			to, length := ss.graph.targets[j], ss.graph.lengths[j]
+			if ss.traffic != nil {
+				ss.traffic.enter(ss.graph, a, j)
+			}
+			ss.positions[a] = to
+			ss.remaining[a] = length - 1
+			ss.occupants[from]--
+			if owner := ss.partition.Shards[to]; owner != s.id {
+				s.outbox[owner] = append(s.outbox[owner], a)
+			} else {
+				if length == 1 {
+					ss.occupants[to]++
+				}
+				stay = append(stay, a)
+			}
+			if ss.headOn {
+				ss.departed[from] = a
+				ss.departedTo[from] = to
+				s.departures = append(s.departures, departure{alien: a, from: from})
+			}
+			if ss.recording() {
+				s.moves = append(s.moves, Event{Iteration: iteration, Type: AlienMoved, From: ss.graph.name(from), To: ss.graph.name(to), Aliens: []int{int(a)}})
+			}
+		}
+		s.aliens = stay
+	})
+	if ss.headOn {
+		ss.collide()
+	}
+	if ss.traffic != nil {
+		arrived := make([][]int32, len(ss.shards))
+		for i, s := range ss.shards {
+			arrived[i] = s.arrived
+		}
+		ss.traffic.arrive(arrived)
+	}
+
+	ss.each(func(s *shard) {
+		for _, d := range s.departures {
+			ss.departed[d.from] = -1
+		}
+		var received bool
+		for _, other := range ss.shards {
+			for _, a := range other.outbox[s.id] {
+				if ss.positions[a] < 0 {
+					// the alien was killed on the road
+					continue
+				}
+				if ss.remaining[a] == 0 {
+					ss.occupants[ss.positions[a]]++
+				}
+				s.aliens = append(s.aliens, a)
+				received = true
+			}
+		}
+		if received {
+			sort.Slice(s.aliens, func(i, j int) bool {
+				return s.aliens[i] < s.aliens[j]
+			})
+		}
+	})
+
+	if ss.recording() {
+		var moves []Event
+		for _, s := range ss.shards {
+			moves = append(moves, s.moves...)
+		}
+		sort.SliceStable(moves, func(i, j int) bool {
+			return moves[i].Aliens[0] < moves[j].Aliens[0]
+		})
+		for _, e := range moves {
+			ss.record(e)
+		}
+	}
+	if ss.headOn {
+		ss.recordCrashes(iteration)
+	}
+}
+
+// collide finds the roads on which two aliens met, because they left the cities
+// on both ends in the iteration. Every worker kills the aliens that left the
+// cities of its shard and closes the paths from them, so the road is closed when
+// both workers are done.
+func (ss *ShardedCommander) collide() {
+	ss.each(func(s *shard) {
+		s.crashes = s.crashes[:0]
+		s.crashed = 0
+		for _, d := range s.departures {
+			to := ss.departedTo[d.from]
+			other := ss.departed[to]
+			if other < 0 || ss.departedTo[to] != d.from {
+				continue
+			}
+			ss.closed[ss.graph.path(d.from, to)] = true
+			if ss.remaining[d.alien] == 0 && ss.partition.Shards[to] == s.id {
+				ss.occupants[to]--
+			}
+			ss.positions[d.alien] = -1
+			ss.remaining[d.alien] = 0
+			s.crashed++
+			if d.from < to {
+				s.crashes = append(s.crashes, crash{from: d.from, to: to, alien: d.alien, other: other})
+			}
+		}
+		if s.crashed == 0 {
+			return
+		}
+		alive := s.aliens[:0]
+		for _, a := range s.aliens {
+			if ss.positions[a] >= 0 {
+				alive = append(alive, a)
+			}
+		}
+		s.aliens = alive
+	})
+}
+
+// recordCrashes records the destroyed roads in the order of the lower IDs of the
+// cities on their ends.
+func (ss *ShardedCommander) recordCrashes(iteration int) {
+	var crashes []crash
+	for _, s := range ss.shards {
+		crashes = append(crashes, s.crashes...)
+		ss.alive -= s.crashed
+	}
+	sort.Slice(crashes, func(i, j int) bool {
+		return crashes[i].from < crashes[j].from
+	})
+	for _, c := range crashes {
+		aliens := []int{int(c.alien), int(c.other)}
+		sort.Ints(aliens)
+		from, to := ss.graph.name(c.from), ss.graph.name(c.to)
+		ss.record(Event{Iteration: iteration, Type: RoadDestroyed, From: from, To: to, Aliens: aliens})
+		_, _ = fmt.Fprintln(ss.out, roadDestructionMessage(from, to, aliens))
+	}
+}
+
+// countAliens destroys the cities with more than one alien and the aliens on the
+// long roads to them. Every worker destroys the cities of its shard and the
+// destruction is recorded in the order of the city IDs.
+func (ss *ShardedCommander) countAliens(iteration int) {
+	ss.each(func(s *shard) {
+		s.victims = s.victims[:0]
+		survivors := s.aliens[:0]
+		for _, a := range s.aliens {
+			if c := ss.positions[a]; ss.occupants[c] > 1 {
+				s.victims = append(s.victims, victim{city: c, alien: a, lost: ss.remaining[a] > 0})
+				continue
+			}
+			survivors = append(survivors, a)
+		}
+		s.aliens = survivors
+		for _, v := range s.victims {
+			ss.isDestroyed[v.city] = true
+			ss.occupants[v.city] = 0
+			ss.positions[v.alien] = -1
+			ss.remaining[v.alien] = 0
+		}
+	})
+
+	var victims []victim
+	for _, s := range ss.shards {
+		victims = append(victims, s.victims...)
+	}
+	sort.Slice(victims, func(i, j int) bool {
+		if victims[i].city != victims[j].city {
+			return victims[i].city < victims[j].city
+		}
+		return victims[i].alien < victims[j].alien
+	})
+	for i := 0; i < len(victims); {
+		c := victims[i].city
+		var aliens, lost []int
+		for ; i < len(victims) && victims[i].city == c; i++ {
+			if victims[i].lost {
+				lost = append(lost, int(victims[i].alien))
+				continue
+			}
+			aliens = append(aliens, int(victims[i].alien))
+		}
+		ss.alive -= len(aliens) + len(lost)
+		name := ss.graph.name(c)
+		ss.destroyed = append(ss.destroyed, name)
+		ss.record(Event{Iteration: iteration, Type: CityDestroyed, City: name, Aliens: aliens})
+		_, _ = fmt.Fprintln(ss.out, destructionMessage(name, aliens))
+		for _, a := range lost {
+			ss.record(Event{Iteration: iteration, Type: AlienLost, City: name, Aliens: []int{a}})
+		}
+	}
+}
+
+// each calls f for every shard in the goroutine of its worker and waits for all of them.
+func (ss *ShardedCommander) each(f func(s *shard)) {
+	if len(ss.shards) == 1 {
+		f(ss.shards[0])
+		return
+	}
+	var wg sync.WaitGroup
+	for _, s := range ss.shards {
+		wg.Add(1)
+		go func(s *shard) {
+			defer wg.Done()
+			f(s)
+		}(s)
+	}
+	wg.Wait()
+}
+
+// recording reports whether the events are needed like CompactCommander.recording.
+func (ss *ShardedCommander) recording() bool {
+	return !ss.discardEvents || len(ss.eventHandlers) > 0
+}
+
+func (ss *ShardedCommander) record(e Event) {
+	if !ss.discardEvents {
+		ss.events = append(ss.events, e)
+	}
+	for _, h := range ss.eventHandlers {
+		h(e)
+	}
+}
+
+// GenerateReportForInvasion returns what is left of the world after the invasion
+// like SequentialCommander.GenerateReportForInvasion.
+func (ss *ShardedCommander) GenerateReportForInvasion() string {
+	return ss.graph.report(ss.isDestroyed, ss.closed)
+}
+
+// Events returns the event log of the invasion. It must be called after StartInvasion.
+func (ss *ShardedCommander) Events() []Event {
+	return append([]Event(nil), ss.events...)
+}
+
+// Result returns the result of the invasion. It must be called after StartInvasion.
+func (ss *ShardedCommander) Result() InvasionResult {
+	res := InvasionResult{
+		Iterations:      ss.iterations,
+		DestroyedCities: append([]string(nil), ss.destroyed...),
+		Positions:       map[int]string{},
+		StopReason:      ss.stopReason,
+	}
+	for id, c := range ss.positions {
+		switch {
+		case c < 0:
+		case ss.remaining[id] > 0:
+			if res.InTransit == nil {
+				res.InTransit = map[int]string{}
+			}
+			res.SurvivingAliens = append(res.SurvivingAliens, id)
+			res.InTransit[id] = ss.graph.name(c)
+		default:
+			res.SurvivingAliens = append(res.SurvivingAliens, id)
+			res.Positions[id] = ss.graph.name(c)
+		}
+	}
+	return res
+}
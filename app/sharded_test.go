@@ -0,0 +1,115 @@
+package app_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestShardedCommanderAgreesWithCompactCommander runs the same invasions of random
+// world maps in the compact engine, which is one shard, and in the sharded engine
+// with a random number of shards.
+func TestShardedCommanderAgreesWithCompactCommander(t *testing.T) {
+	terminations := []string{"", "aliens<=0", "iterations>=5", "destroyed>=20% or no_movement"}
+	for seed := int64(0); seed < 200; seed++ {
+		rnd := rand.New(rand.NewSource(seed))
+		wm := randomWorldMap(rnd)
+		aliens := rnd.Intn(2*len(wm.Cities) + 1)
+		maxIterations := rnd.Intn(50)
+		multiple := rnd.Intn(2) == 0
+		expr := terminations[rnd.Intn(len(terminations))]
+		headOn := rnd.Intn(2) == 0
+		shards := 1 + rnd.Intn(8)
+
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			// SETUP
+			opts := func() []app.Option {
+				opts := []app.Option{app.WithPlacement(app.NewUniformPlacement(seed, multiple))}
+				if expr != "" {
+					tc, err := app.ParseTermination(expr)
+					assert.NoError(t, err)
+					opts = append(opts, app.WithTermination(tc))
+				}
+				if headOn {
+					opts = append(opts, app.WithHeadOnCollisions())
+				}
+				return opts
+			}
+			g := app.NewCompactGraph(wm)
+			compactOut := bytes.NewBufferString("")
+			compact := app.NewCompactCommander(g, aliens, seed, 1, compactOut, maxIterations, opts()...)
+			shardedOut := bytes.NewBufferString("")
+			sharded := app.NewShardedCommander(g, app.PartitionGraph(g, shards), aliens, seed, shardedOut, maxIterations, opts()...)
+
+			// ACTION
+			compactErr := compact.StartInvasion()
+			shardedErr := sharded.StartInvasion()
+
+			// ASSERTIONS
+			assert.Equal(t, compactErr, shardedErr)
+			if compactErr != nil {
+				return
+			}
+			assert.Equal(t, compactOut.String(), shardedOut.String())
+			assert.Equal(t, compact.Events(), sharded.Events())
+			assert.Equal(t, compact.GenerateReportForInvasion(), sharded.GenerateReportForInvasion())
+			assert.Equal(t, compact.Result(), sharded.Result())
+		})
+	}
+}
+
+func TestShardedCommanderHandsOffAliensBetweenShards(t *testing.T) {
+	// SETUP
+	g := app.NewCompactGraph(app.GenerateGrid(30, 30))
+	compact := app.NewCompactCommander(g, 400, 3, 1, bytes.NewBufferString(""), 40)
+	assert.NoError(t, compact.StartInvasion())
+
+	for _, shards := range []int{2, 7, 16, 900} {
+		p := app.PartitionGraph(g, shards)
+		sharded := app.NewShardedCommander(g, p, 400, 3, bytes.NewBufferString(""), 40)
+
+		// ACTION
+		err := sharded.StartInvasion()
+
+		// ASSERTIONS
+		assert.NoError(t, err)
+		assert.Equal(t, compact.Events(), sharded.Events(), "shards %d", shards)
+		assert.Equal(t, compact.Result(), sharded.Result(), "shards %d", shards)
+	}
+}
+
+func TestPartitionGraph(t *testing.T) {
+	// SETUP
+	g := app.NewCompactGraph(app.GenerateGrid(10, 10))
+
+	// ACTION
+	p := app.PartitionGraph(g, 3)
+
+	// ASSERTIONS
+	assert.Equal(t, []int{33, 33, 34}, p.Sizes)
+	sizes := make([]int, 3)
+	for _, s := range p.Shards {
+		sizes[s]++
+	}
+	assert.Equal(t, p.Sizes, sizes)
+	// the grid has 180 paths and the shards are regions, so only a few of them are cut
+	assert.Greater(t, p.Cut, 0)
+	assert.Less(t, p.Cut, 40)
+}
+
+func TestPartitionGraphWithMoreShardsThanCities(t *testing.T) {
+	// SETUP
+	g := app.NewCompactGraph(app.GenerateGrid(3, 1))
+
+	// ACTION
+	p := app.PartitionGraph(g, 5)
+
+	// ASSERTIONS
+	assert.Equal(t, []int32{0, 1, 2}, p.Shards)
+	assert.Equal(t, []int{1, 1, 1}, p.Sizes)
+	assert.Equal(t, 2, p.Cut)
+}
@@ -0,0 +1,374 @@
+package app
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sizes of the SVG drawing in pixels.
+const (
+	svgCell   = 120 // distance between two neighbour cities
+	svgMargin = 60
+	svgAlien  = 12 // distance between two aliens in the same city
+)
+
+// SVGOptions configures how the world map is drawn by WriteSVG.
+type SVGOptions struct {
+	// Events is the event log of an invasion of the world map. Without events the
+	// world is drawn before the invasion.
+	Events []Event
+	// Animate draws the invasion iteration by iteration with SMIL animations. Without
+	// it only the end of the invasion is drawn.
+	Animate bool
+	// Step is how long one iteration takes in the animation. Zero means one second.
+	Step time.Duration
+}
+
+// svgFrame is the state of the invasion after one iteration: where every alien is drawn.
+type svgFrame struct {
+	aliens map[int]svgAlienAt
+}
+
+// svgAlienAt is the place of an alien in the drawing. The aliens in a city are
+// drawn in a row under it and a killed alien in the middle of its city.
+type svgAlienAt struct {
+	x, y  float64
+	alive bool
+}
+
+// svgTravel is an alien on a road that is longer than one iteration: it left the
+// city from in the iteration start and arrives in the city to after length
+// iterations.
+type svgTravel struct {
+	from, to      int
+	start, length int
+}
+
+// WriteSVG draws the world map as SVG. The cities are drawn at their positions in
+// the layout and the roads as lines between them, the one-way roads with an arrow.
+// With the event log of an invasion the destroyed cities are crossed out, the
+// roads to them are dashed and the aliens are drawn as dots under the city where
+// they are.
+func (wm *WorldMap) WriteSVG(w io.Writer, layout Layout, opts SVGOptions) error {
+	center := func(id int) (int, int) {
+		p := layout.Positions[id]
+		return svgMargin + p.X*svgCell, svgMargin + p.Y*svgCell
+	}
+	frames, destroyedIn, roadDestroyedIn, err := svgFrames(wm, opts.Events, center)
+	if err != nil {
+		return err
+	}
+	step := opts.Step
+	if step <= 0 {
+		step = time.Second
+	}
+	// shown is the iteration drawn before the animation starts
+	shown := len(frames) - 1
+	if opts.Animate {
+		shown = 0
+	}
+	destroyed := func(id int) bool {
+		return destroyedIn[id] >= 0 && destroyedIn[id] <= shown
+	}
+	// begin returns the time when the aliens start to move in the iteration and
+	// moved the time when they arrive and the cities are destroyed.
+	begin := func(iteration int) string {
+		return fmt.Sprintf("%gs", (time.Duration(iteration) * step).Seconds())
+	}
+	moved := func(iteration int) string {
+		return fmt.Sprintf("%gs", (time.Duration(iteration)*step + step/2).Seconds())
+	}
+
+	var sb strings.Builder
+	width := 2*svgMargin + (layout.Width-1)*svgCell
+	height := 2*svgMargin + (layout.Height-1)*svgCell
+	sb.WriteString(fmt.Sprintf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"sans-serif\" font-size=\"14\">\n", width, height, width, height))
+	sb.WriteString(fmt.Sprintf("  <rect width=\"%d\" height=\"%d\" fill=\"white\"/>\n", width, height))
+
+	wm.links(func(from, to int, _ Road, back *Road) {
+		x1, y1 := center(from)
+		x2, y2 := center(to)
+		// the road is closed in the first iteration in which one of its cities or
+		// the road itself is destroyed
+		closedIn := -1
+		road, ok := roadDestroyedIn[[2]int{from, to}]
+		if !ok {
+			road = -1
+		}
+		for _, d := range []int{destroyedIn[from], destroyedIn[to], road} {
+			if d >= 0 && (closedIn < 0 || d < closedIn) {
+				closedIn = d
+			}
+		}
+		attrs := ""
+		if closedIn >= 0 && closedIn <= shown {
+			attrs = " stroke-dasharray=\"6 4\""
+		}
+		sb.WriteString(fmt.Sprintf("  <line class=\"road\" x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"gray\" stroke-width=\"2\"%s>", x1, y1, x2, y2, attrs))
+		if opts.Animate && attrs == "" && closedIn > 0 {
+			sb.WriteString(fmt.Sprintf("<set attributeName=\"stroke-dasharray\" to=\"6 4\" begin=\"%s\" fill=\"freeze\"/>", moved(closedIn)))
+		}
+		sb.WriteString("</line>\n")
+		if back == nil {
+			sb.WriteString(svgArrow(x1, y1, x2, y2))
+		}
+	})
+
+	for _, c := range wm.Cities {
+		x, y := center(c.ID)
+		name := html.EscapeString(c.Name)
+		half := 4*len(c.Name) + 10
+		sb.WriteString(fmt.Sprintf("  <g class=\"city\" id=\"city-%s\">\n", name))
+		sb.WriteString(fmt.Sprintf("    <rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"30\" rx=\"4\" fill=\"white\" stroke=\"black\"/>\n", x-half, y-15, 2*half))
+		sb.WriteString(fmt.Sprintf("    <text x=\"%d\" y=\"%d\" text-anchor=\"middle\">%s</text>\n", x, y+5, name))
+		if d := destroyedIn[c.ID]; d >= 0 {
+			visibility := ""
+			if !destroyed(c.ID) {
+				visibility = " visibility=\"hidden\""
+			}
+			sb.WriteString(fmt.Sprintf("    <g class=\"destroyed\" stroke=\"red\" stroke-width=\"3\"%s>\n", visibility))
+			if visibility != "" {
+				sb.WriteString(fmt.Sprintf("      <set attributeName=\"visibility\" to=\"visible\" begin=\"%s\" fill=\"freeze\"/>\n", moved(d)))
+			}
+			sb.WriteString(fmt.Sprintf("      <line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\"/>\n", x-half, y-15, x+half, y+15))
+			sb.WriteString(fmt.Sprintf("      <line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\"/>\n", x-half, y+15, x+half, y-15))
+			sb.WriteString("    </g>\n")
+		}
+		sb.WriteString("  </g>\n")
+	}
+
+	for _, alien := range svgAliens(frames) {
+		at, ok := frames[shown].aliens[alien]
+		if !ok || !at.alive {
+			continue
+		}
+		if !opts.Animate {
+			sb.WriteString(fmt.Sprintf("  <circle class=\"alien\" cx=\"%g\" cy=\"%g\" r=\"5\" fill=\"orange\"><title>alien %d</title></circle>\n", at.x, at.y, alien))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("  <circle class=\"alien\" cx=\"%g\" cy=\"%g\" r=\"5\" fill=\"orange\"><title>alien %d</title>\n", at.x, at.y, alien))
+		for i := 1; i < len(frames); i++ {
+			next := frames[i].aliens[alien]
+			if next.x != at.x || next.y != at.y {
+				sb.WriteString(fmt.Sprintf("    <animate attributeName=\"cx\" to=\"%g\" begin=\"%s\" dur=\"%gs\" fill=\"freeze\"/>\n", next.x, begin(i), step.Seconds()/2))
+				sb.WriteString(fmt.Sprintf("    <animate attributeName=\"cy\" to=\"%g\" begin=\"%s\" dur=\"%gs\" fill=\"freeze\"/>\n", next.y, begin(i), step.Seconds()/2))
+			}
+			at = next
+			if !at.alive {
+				sb.WriteString(fmt.Sprintf("    <set attributeName=\"visibility\" to=\"hidden\" begin=\"%s\" fill=\"freeze\"/>\n", moved(i)))
+				break
+			}
+		}
+		sb.WriteString("  </circle>\n")
+	}
+
+	if opts.Animate {
+		for i := range frames {
+			visibility := ""
+			if i > 0 {
+				visibility = " visibility=\"hidden\""
+			}
+			sb.WriteString(fmt.Sprintf("  <text class=\"iteration\" x=\"10\" y=\"%d\"%s>Iteration %d/%d", height-10, visibility, i, len(frames)-1))
+			if i > 0 {
+				sb.WriteString(fmt.Sprintf("<set attributeName=\"visibility\" to=\"visible\" begin=\"%s\" fill=\"freeze\"/>", begin(i)))
+			}
+			if i < len(frames)-1 {
+				sb.WriteString(fmt.Sprintf("<set attributeName=\"visibility\" to=\"hidden\" begin=\"%s\" fill=\"freeze\"/>", begin(i+1)))
+			}
+			sb.WriteString("</text>\n")
+		}
+	}
+	sb.WriteString("</svg>\n")
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// svgArrow returns the arrow in the middle of the one-way road from (x1, y1) to
+// (x2, y2) that points in the direction of travel.
+func svgArrow(x1, y1, x2, y2 int) string {
+	dx, dy := float64(x2-x1), float64(y2-y1)
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return ""
+	}
+	// the unit vector along the road and the one across it
+	ux, uy := dx/length, dy/length
+	mx, my := float64(x1+x2)/2, float64(y1+y2)/2
+	return fmt.Sprintf("  <polygon class=\"one-way\" points=\"%g,%g %g,%g %g,%g\" fill=\"gray\"/>\n",
+		mx+8*ux, my+8*uy, mx-4*ux-6*uy, my-4*uy+6*ux, mx-4*ux+6*uy, my-4*uy-6*ux)
+}
+
+// svgFrames applies the event log to the world map iteration by iteration. The
+// frame 0 is the world after the aliens are placed. Without events there is only
+// the frame 0 with no aliens. It returns the frames, the iteration in which every
+// city is destroyed or -1 and the iterations in which the destroyed roads are
+// destroyed, keyed by the IDs of the cities on their ends in both orders. An
+// alien on a road longer than one iteration is drawn on the road until it
+// arrives. An event of an iteration that the log doesn't finish is an error, so
+// there is at most one frame per iteration in the log.
+func svgFrames(wm *WorldMap, events []Event, center func(id int) (int, int)) ([]svgFrame, []int, map[[2]int]int, error) {
+	roadDestroyedIn := map[[2]int]int{}
+	destroyedIn := make([]int, len(wm.Cities))
+	for i := range destroyedIn {
+		destroyedIn[i] = -1
+	}
+	iterations := 0
+	for _, e := range events {
+		if e.Type == IterationFinished {
+			iterations++
+		}
+	}
+	cityOf := map[int]int{}       // city ID by the ID of a living alien in a city
+	onRoad := map[int]svgTravel{} // the travel by the ID of a living alien on a road
+	killed := map[int]int{}       // city ID by the ID of an alien killed in the iteration
+	var frames []svgFrame
+	finish := func() {
+		k := len(frames)
+		f := svgFrame{aliens: make(map[int]svgAlienAt, len(cityOf)+len(onRoad)+len(killed))}
+		for a, t := range onRoad {
+			if t.start+t.length-1 <= k {
+				delete(onRoad, a)
+				cityOf[a] = t.to
+				continue
+			}
+			x1, y1 := center(t.from)
+			x2, y2 := center(t.to)
+			part := float64(k-t.start+1) / float64(t.length)
+			f.aliens[a] = svgAlienAt{x: float64(x1) + float64(x2-x1)*part, y: float64(y1) + float64(y2-y1)*part, alive: true}
+		}
+		inCity := map[int][]int{}
+		for a, c := range cityOf {
+			inCity[c] = append(inCity[c], a)
+		}
+		for c, aliens := range inCity {
+			sort.Ints(aliens)
+			x, y := center(c)
+			for i, a := range aliens {
+				f.aliens[a] = svgAlienAt{x: float64(x) + (float64(i)-float64(len(aliens)-1)/2)*svgAlien, y: float64(y + 25), alive: true}
+			}
+		}
+		for a, c := range killed {
+			x, y := center(c)
+			f.aliens[a] = svgAlienAt{x: float64(x), y: float64(y)}
+		}
+		frames = append(frames, f)
+		killed = map[int]int{}
+	}
+
+	city := func(name string) (int, error) {
+		id, ok := wm.CityID(name)
+		if !ok {
+			return 0, fmt.Errorf("the event log refers to the city %s that is not in the world map", name)
+		}
+		return id, nil
+	}
+	for _, e := range events {
+		if e.Iteration > iterations {
+			return nil, nil, nil, fmt.Errorf("the event log has an event of the iteration %d but finishes only %d iterations", e.Iteration, iterations)
+		}
+		for len(frames) < e.Iteration {
+			finish()
+		}
+		switch e.Type {
+		case AlienPlaced:
+			id, err := city(e.City)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			for _, a := range e.Aliens {
+				cityOf[a] = id
+			}
+		case AlienMoved:
+			from, err := city(e.From)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			to, err := city(e.To)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			length := 1
+			for _, r := range wm.Cities[from].Roads {
+				if r.To == e.To {
+					length = r.travelTime()
+					break
+				}
+			}
+			for _, a := range e.Aliens {
+				delete(cityOf, a)
+				if length > 1 {
+					onRoad[a] = svgTravel{from: from, to: to, start: e.Iteration, length: length}
+				} else {
+					cityOf[a] = to
+				}
+			}
+		case CityDestroyed:
+			id, err := city(e.City)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			destroyedIn[id] = len(frames)
+			for _, a := range e.Aliens {
+				delete(cityOf, a)
+				delete(onRoad, a)
+				killed[a] = id
+			}
+		case RoadDestroyed:
+			from, err := city(e.From)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			to, err := city(e.To)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			roadDestroyedIn[[2]int{from, to}] = len(frames)
+			roadDestroyedIn[[2]int{to, from}] = len(frames)
+			// the aliens are drawn killed in the cities they went to
+			for _, a := range e.Aliens {
+				if c, ok := cityOf[a]; ok {
+					delete(cityOf, a)
+					killed[a] = c
+				}
+				if t, ok := onRoad[a]; ok {
+					delete(onRoad, a)
+					killed[a] = t.to
+				}
+			}
+		case AlienLost:
+			id, err := city(e.City)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			for _, a := range e.Aliens {
+				delete(cityOf, a)
+				delete(onRoad, a)
+				killed[a] = id
+			}
+		}
+	}
+	finish()
+	return frames, destroyedIn, roadDestroyedIn, nil
+}
+
+// svgAliens returns the IDs of all aliens of the invasion in increasing order.
+func svgAliens(frames []svgFrame) []int {
+	seen := map[int]bool{}
+	var ids []int
+	for _, f := range frames {
+		for a := range f.aliens {
+			if !seen[a] {
+				seen[a] = true
+				ids = append(ids, a)
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
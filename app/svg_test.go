@@ -0,0 +1,163 @@
+package app_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+// svgEvents is an invasion of a 2x1 grid: alien 0 moves from X1 to X2 and
+// destroys it together with alien 1.
+var svgEvents = []app.Event{
+	{Type: app.AlienPlaced, City: "X1", Aliens: []int{0}},
+	{Type: app.AlienPlaced, City: "X2", Aliens: []int{1}},
+	{Type: app.AlienPlaced, City: "X1", Aliens: []int{2}},
+	{Iteration: 1, Type: app.AlienMoved, From: "X1", To: "X2", Aliens: []int{0}},
+	{Iteration: 1, Type: app.CityDestroyed, City: "X2", Aliens: []int{0, 1}},
+	{Iteration: 1, Type: app.IterationFinished},
+}
+
+func TestWriteSVGBeforeTheInvasion(t *testing.T) {
+	// SETUP
+	wm := app.GenerateGrid(2, 1)
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := wm.WriteSVG(buf, app.NewLayout(wm), app.SVGOptions{})
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	svg := buf.String()
+	assert.Contains(t, svg, `<svg xmlns="http://www.w3.org/2000/svg" width="240" height="120"`)
+	assert.Contains(t, svg, `<line class="road" x1="60" y1="60" x2="180" y2="60" stroke="gray" stroke-width="2"></line>`)
+	assert.Contains(t, svg, `<text x="60" y="65" text-anchor="middle">X1</text>`)
+	assert.Contains(t, svg, `<text x="180" y="65" text-anchor="middle">X2</text>`)
+	assert.NotContains(t, svg, "destroyed")
+	assert.NotContains(t, svg, "alien")
+}
+
+func TestWriteSVGWithOneWayRoad(t *testing.T) {
+	// SETUP
+	wm := app.NewWorldMap([]app.CityInfo{{Name: "X1", Roads: []app.Road{{Direction: app.East, To: "X2", OneWay: true}}}})
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := wm.WriteSVG(buf, app.NewLayout(wm), app.SVGOptions{})
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	svg := buf.String()
+	assert.Contains(t, svg, `<line class="road" x1="60" y1="60" x2="180" y2="60" stroke="gray" stroke-width="2"></line>`)
+	// the arrow in the middle of the road points to X2
+	assert.Contains(t, svg, `<polygon class="one-way" points="128,60 116,66 116,54" fill="gray"/>`)
+}
+
+func TestWriteSVGAfterTheInvasion(t *testing.T) {
+	// SETUP
+	wm := app.GenerateGrid(2, 1)
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := wm.WriteSVG(buf, app.NewLayout(wm), app.SVGOptions{Events: svgEvents})
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	svg := buf.String()
+	assert.Contains(t, svg, `<line class="road" x1="60" y1="60" x2="180" y2="60" stroke="gray" stroke-width="2" stroke-dasharray="6 4"></line>`)
+	assert.Contains(t, svg, "<g class=\"city\" id=\"city-X2\">\n"+
+		"    <rect x=\"162\" y=\"45\" width=\"36\" height=\"30\" rx=\"4\" fill=\"white\" stroke=\"black\"/>\n"+
+		"    <text x=\"180\" y=\"65\" text-anchor=\"middle\">X2</text>\n"+
+		"    <g class=\"destroyed\" stroke=\"red\" stroke-width=\"3\">\n")
+	assert.Contains(t, svg, `<circle class="alien" cx="60" cy="85" r="5" fill="orange"><title>alien 2</title></circle>`)
+	assert.NotContains(t, svg, "alien 0")
+	assert.NotContains(t, svg, "alien 1")
+	assert.NotContains(t, svg, "<animate")
+}
+
+func TestWriteAnimatedSVG(t *testing.T) {
+	// SETUP
+	wm := app.GenerateGrid(2, 1)
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := wm.WriteSVG(buf, app.NewLayout(wm), app.SVGOptions{Events: svgEvents, Animate: true, Step: 2 * time.Second})
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	svg := buf.String()
+	// the aliens 0 and 2 are in X1 before the first iteration
+	assert.Contains(t, svg, "<circle class=\"alien\" cx=\"54\" cy=\"85\" r=\"5\" fill=\"orange\"><title>alien 0</title>\n"+
+		"    <animate attributeName=\"cx\" to=\"180\" begin=\"2s\" dur=\"1s\" fill=\"freeze\"/>\n"+
+		"    <animate attributeName=\"cy\" to=\"60\" begin=\"2s\" dur=\"1s\" fill=\"freeze\"/>\n"+
+		"    <set attributeName=\"visibility\" to=\"hidden\" begin=\"3s\" fill=\"freeze\"/>\n"+
+		"  </circle>\n")
+	assert.Contains(t, svg, "<circle class=\"alien\" cx=\"66\" cy=\"85\" r=\"5\" fill=\"orange\"><title>alien 2</title>\n"+
+		"    <animate attributeName=\"cx\" to=\"60\" begin=\"2s\" dur=\"1s\" fill=\"freeze\"/>\n"+
+		"    <animate attributeName=\"cy\" to=\"85\" begin=\"2s\" dur=\"1s\" fill=\"freeze\"/>\n"+
+		"  </circle>\n")
+	assert.Contains(t, svg, "<g class=\"destroyed\" stroke=\"red\" stroke-width=\"3\" visibility=\"hidden\">\n"+
+		"      <set attributeName=\"visibility\" to=\"visible\" begin=\"3s\" fill=\"freeze\"/>\n")
+	assert.Contains(t, svg, `<set attributeName="stroke-dasharray" to="6 4" begin="3s" fill="freeze"/>`)
+	assert.Contains(t, svg, `>Iteration 0/1<set attributeName="visibility" to="hidden" begin="2s" fill="freeze"/></text>`)
+	assert.Contains(t, svg, ` visibility="hidden">Iteration 1/1<set attributeName="visibility" to="visible" begin="2s" fill="freeze"/></text>`)
+}
+
+func TestWriteSVGWithUnknownCity(t *testing.T) {
+	// SETUP
+	wm := app.GenerateGrid(2, 1)
+	events := []app.Event{{Type: app.AlienPlaced, City: "X7", Aliens: []int{0}}}
+
+	// ACTION
+	err := wm.WriteSVG(bytes.NewBufferString(""), app.NewLayout(wm), app.SVGOptions{Events: events})
+
+	// ASSERTIONS
+	assert.EqualError(t, err, "the event log refers to the city X7 that is not in the world map")
+}
+
+func TestWriteAnimatedSVGWithLongRoad(t *testing.T) {
+	// SETUP
+	wm := app.NewWorldMap([]app.CityInfo{{Name: "X1", Roads: []app.Road{{Direction: app.East, To: "X2", Length: 3}}}})
+	events := []app.Event{
+		{Type: app.AlienPlaced, City: "X1", Aliens: []int{0}},
+		{Iteration: 1, Type: app.AlienMoved, From: "X1", To: "X2", Aliens: []int{0}},
+		{Iteration: 1, Type: app.IterationFinished},
+		{Iteration: 2, Type: app.IterationFinished},
+		{Iteration: 3, Type: app.IterationFinished},
+	}
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := wm.WriteSVG(buf, app.NewLayout(wm), app.SVGOptions{Events: events, Animate: true, Step: 2 * time.Second})
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	// the alien travels a third of the road in every iteration and arrives in X2
+	// at the end of the iteration 3
+	assert.Contains(t, buf.String(), "<circle class=\"alien\" cx=\"60\" cy=\"85\" r=\"5\" fill=\"orange\"><title>alien 0</title>\n"+
+		"    <animate attributeName=\"cx\" to=\"100\" begin=\"2s\" dur=\"1s\" fill=\"freeze\"/>\n"+
+		"    <animate attributeName=\"cy\" to=\"60\" begin=\"2s\" dur=\"1s\" fill=\"freeze\"/>\n"+
+		"    <animate attributeName=\"cx\" to=\"140\" begin=\"4s\" dur=\"1s\" fill=\"freeze\"/>\n"+
+		"    <animate attributeName=\"cy\" to=\"60\" begin=\"4s\" dur=\"1s\" fill=\"freeze\"/>\n"+
+		"    <animate attributeName=\"cx\" to=\"180\" begin=\"6s\" dur=\"1s\" fill=\"freeze\"/>\n"+
+		"    <animate attributeName=\"cy\" to=\"85\" begin=\"6s\" dur=\"1s\" fill=\"freeze\"/>\n"+
+		"  </circle>\n")
+}
+
+func TestWriteSVGWithIterationThatIsNotFinished(t *testing.T) {
+	// SETUP
+	wm := app.GenerateGrid(2, 1)
+	events := []app.Event{
+		{Type: app.AlienPlaced, City: "X1", Aliens: []int{0}},
+		{Iteration: 1, Type: app.IterationFinished},
+		{Iteration: 1 << 40, Type: app.AlienLost, City: "X2", Aliens: []int{0}},
+	}
+
+	// ACTION
+	err := wm.WriteSVG(bytes.NewBufferString(""), app.NewLayout(wm), app.SVGOptions{Events: events})
+
+	// ASSERTIONS
+	assert.EqualError(t, err, "the event log has an event of the iteration 1099511627776 but finishes only 1 iterations")
+}
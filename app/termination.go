@@ -0,0 +1,303 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InvasionState is what the commander knows about the invasion between two iterations.
+// The termination conditions decide with it whether the invasion is over.
+type InvasionState struct {
+	// Iterations is the number of finished iterations.
+	Iterations int
+	// Aliens is the number of aliens that are alive.
+	Aliens int
+	// Cities is the number of cities in the world map.
+	Cities int
+	// Destroyed are the names of the destroyed cities.
+	Destroyed []string
+	// CanMove is true if at least one alien is in a city with an open path.
+	CanMove bool
+	// Elapsed is the time since the start of the invasion.
+	Elapsed time.Duration
+}
+
+// TerminationCondition decides when the invasion is over. The commander checks it
+// before every iteration. The String method returns the condition in the format
+// of ParseTermination.
+type TerminationCondition interface {
+	// Met reports whether the invasion must stop. If it must, it returns the
+	// description of the condition that is met.
+	Met(s InvasionState) (string, bool)
+	String() string
+}
+
+// AliensAtMost stops the invasion when the number of alive aliens is not more than the value.
+type AliensAtMost int
+
+// Met implements TerminationCondition.
+func (c AliensAtMost) Met(s InvasionState) (string, bool) {
+	return c.String(), s.Aliens <= int(c)
+}
+
+func (c AliensAtMost) String() string {
+	return fmt.Sprintf("aliens<=%d", int(c))
+}
+
+// IterationsAtLeast stops the invasion after the number of iterations.
+type IterationsAtLeast int
+
+// Met implements TerminationCondition.
+func (c IterationsAtLeast) Met(s InvasionState) (string, bool) {
+	return c.String(), s.Iterations >= int(c)
+}
+
+func (c IterationsAtLeast) String() string {
+	return fmt.Sprintf("iterations>=%d", int(c))
+}
+
+// Timeout stops the invasion when it takes longer than the duration. The invasion
+// is stopped between two iterations, so it may take a bit longer than the duration.
+type Timeout time.Duration
+
+// Met implements TerminationCondition.
+func (c Timeout) Met(s InvasionState) (string, bool) {
+	return c.String(), s.Elapsed >= time.Duration(c)
+}
+
+func (c Timeout) String() string {
+	return fmt.Sprintf("timeout=%s", time.Duration(c))
+}
+
+// DestroyedAtLeast stops the invasion when at least the percent of the cities are destroyed.
+type DestroyedAtLeast float64
+
+// Met implements TerminationCondition.
+func (c DestroyedAtLeast) Met(s InvasionState) (string, bool) {
+	return c.String(), s.Cities > 0 && float64(len(s.Destroyed))*100 >= float64(c)*float64(s.Cities)
+}
+
+func (c DestroyedAtLeast) String() string {
+	return fmt.Sprintf("destroyed>=%s%%", strconv.FormatFloat(float64(c), 'f', -1, 64))
+}
+
+// NoMovement stops the invasion when none of the aliens can move, because all
+// roads from their cities lead to destroyed cities.
+type NoMovement struct{}
+
+// Met implements TerminationCondition.
+func (c NoMovement) Met(s InvasionState) (string, bool) {
+	return c.String(), !s.CanMove
+}
+
+func (c NoMovement) String() string {
+	return "no_movement"
+}
+
+// CityIsDestroyed stops the invasion when the city with the name is destroyed.
+type CityIsDestroyed string
+
+// Met implements TerminationCondition.
+func (c CityIsDestroyed) Met(s InvasionState) (string, bool) {
+	for _, name := range s.Destroyed {
+		if name == string(c) {
+			return c.String(), true
+		}
+	}
+	return c.String(), false
+}
+
+func (c CityIsDestroyed) String() string {
+	return "city_destroyed=" + string(c)
+}
+
+// AnyOf stops the invasion when at least one of the conditions is met. The reason
+// is the first condition that is met.
+type AnyOf []TerminationCondition
+
+// Met implements TerminationCondition.
+func (c AnyOf) Met(s InvasionState) (string, bool) {
+	for _, sub := range c {
+		if reason, ok := sub.Met(s); ok {
+			return reason, true
+		}
+	}
+	return c.String(), false
+}
+
+func (c AnyOf) String() string {
+	return join(c, " or ")
+}
+
+// AllOf stops the invasion when all conditions are met. The reason contains all of them.
+type AllOf []TerminationCondition
+
+// Met implements TerminationCondition.
+func (c AllOf) Met(s InvasionState) (string, bool) {
+	reasons := make([]string, 0, len(c))
+	for _, sub := range c {
+		reason, ok := sub.Met(s)
+		if !ok {
+			return c.String(), false
+		}
+		reasons = append(reasons, reason)
+	}
+	return strings.Join(reasons, " and "), true
+}
+
+func (c AllOf) String() string {
+	return join(c, " and ")
+}
+
+func join(conditions []TerminationCondition, sep string) string {
+	parts := make([]string, len(conditions))
+	for i, c := range conditions {
+		parts[i] = c.String()
+		switch c.(type) {
+		case AnyOf, AllOf:
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// DefaultTermination returns the condition of the original invasion: it stops when
+// there is zero or one alien left, none of the aliens can move or the maximum
+// number of iterations is reached.
+func DefaultTermination(maxIterations int) TerminationCondition {
+	return AnyOf{AliensAtMost(1), NoMovement{}, IterationsAtLeast(maxIterations)}
+}
+
+// ParseTermination parses a termination condition. The conditions are:
+//
+//	aliens<=1            the number of alive aliens is at most 1
+//	iterations>=10000    10000 iterations are finished
+//	timeout=30s          the invasion takes 30 seconds or more
+//	destroyed>=50%       at least half of the cities are destroyed
+//	no_movement          none of the aliens can move
+//	city_destroyed=X5    the city X5 is destroyed
+//
+// They are combined with "and" and "or". "and" binds stronger than "or" and
+// parentheses can group conditions, for example
+// "aliens<=1 or (destroyed>=50% and iterations>=100)".
+func ParseTermination(expr string) (TerminationCondition, error) {
+	p := terminationParser{tokens: strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expr))}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("the termination condition is empty")
+	}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("wrong termination condition %q: %w", expr, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("wrong termination condition %q: unexpected %q", expr, p.tokens[p.pos])
+	}
+	return c, nil
+}
+
+type terminationParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *terminationParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *terminationParser) parseOr() (TerminationCondition, error) {
+	var anyOf AnyOf
+	for {
+		c, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		anyOf = append(anyOf, c)
+		if !strings.EqualFold(p.next(), "or") {
+			break
+		}
+		p.pos++
+	}
+	if len(anyOf) == 1 {
+		return anyOf[0], nil
+	}
+	return anyOf, nil
+}
+
+func (p *terminationParser) parseAnd() (TerminationCondition, error) {
+	var allOf AllOf
+	for {
+		c, err := p.parseCondition()
+		if err != nil {
+			return nil, err
+		}
+		allOf = append(allOf, c)
+		if !strings.EqualFold(p.next(), "and") {
+			break
+		}
+		p.pos++
+	}
+	if len(allOf) == 1 {
+		return allOf[0], nil
+	}
+	return allOf, nil
+}
+
+func (p *terminationParser) parseCondition() (TerminationCondition, error) {
+	token := p.next()
+	p.pos++
+	if token == "(" {
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return c, nil
+	}
+
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("missing condition at the end")
+	case token == "no_movement":
+		return NoMovement{}, nil
+	case strings.HasPrefix(token, "aliens<="):
+		n, err := strconv.Atoi(strings.TrimPrefix(token, "aliens<="))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("the number of aliens in %q must be a non-negative integer", token)
+		}
+		return AliensAtMost(n), nil
+	case strings.HasPrefix(token, "iterations>="):
+		n, err := strconv.Atoi(strings.TrimPrefix(token, "iterations>="))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("the number of iterations in %q must be a non-negative integer", token)
+		}
+		return IterationsAtLeast(n), nil
+	case strings.HasPrefix(token, "timeout="):
+		d, err := time.ParseDuration(strings.TrimPrefix(token, "timeout="))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("the duration in %q must be positive like 30s or 5m", token)
+		}
+		return Timeout(d), nil
+	case strings.HasPrefix(token, "destroyed>=") && strings.HasSuffix(token, "%"):
+		v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(token, "destroyed>="), "%"), 64)
+		if err != nil || v < 0 || v > 100 {
+			return nil, fmt.Errorf("the percent in %q must be between 0 and 100", token)
+		}
+		return DestroyedAtLeast(v), nil
+	case strings.HasPrefix(token, "city_destroyed="):
+		name := strings.TrimPrefix(token, "city_destroyed=")
+		if name == "" {
+			return nil, fmt.Errorf("the name of the city in %q is empty", token)
+		}
+		return CityIsDestroyed(name), nil
+	default:
+		return nil, fmt.Errorf("unknown condition %q. Expected one of aliens<=N, iterations>=N, timeout=D, destroyed>=P%%, no_movement, city_destroyed=NAME", token)
+	}
+}
@@ -0,0 +1,175 @@
+package app_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerminationConditions(t *testing.T) {
+	state := app.InvasionState{
+		Iterations: 10,
+		Aliens:     3,
+		Cities:     8,
+		Destroyed:  []string{"X1", "X2"},
+		CanMove:    true,
+		Elapsed:    2 * time.Second,
+	}
+
+	cases := []struct {
+		condition app.TerminationCondition
+		met       bool
+	}{
+		{condition: app.AliensAtMost(3), met: true},
+		{condition: app.AliensAtMost(2), met: false},
+		{condition: app.IterationsAtLeast(10), met: true},
+		{condition: app.IterationsAtLeast(11), met: false},
+		{condition: app.Timeout(time.Second), met: true},
+		{condition: app.Timeout(time.Minute), met: false},
+		{condition: app.DestroyedAtLeast(25), met: true},
+		{condition: app.DestroyedAtLeast(30), met: false},
+		{condition: app.NoMovement{}, met: false},
+		{condition: app.CityIsDestroyed("X2"), met: true},
+		{condition: app.CityIsDestroyed("X3"), met: false},
+		{condition: app.AnyOf{app.AliensAtMost(1), app.CityIsDestroyed("X1")}, met: true},
+		{condition: app.AllOf{app.AliensAtMost(5), app.NoMovement{}}, met: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.condition.String(), func(t *testing.T) {
+			// ACTION
+			_, met := c.condition.Met(state)
+
+			// ASSERTIONS
+			assert.Equal(t, c.met, met)
+		})
+	}
+}
+
+func TestTerminationReason(t *testing.T) {
+	// SETUP
+	state := app.InvasionState{Iterations: 100, Aliens: 1, Cities: 4, Destroyed: []string{"X1", "X2"}}
+	anyOf := app.AnyOf{app.CityIsDestroyed("X3"), app.IterationsAtLeast(50), app.AliensAtMost(1)}
+	allOf := app.AllOf{app.DestroyedAtLeast(50), app.IterationsAtLeast(50)}
+
+	// ACTION
+	anyReason, anyMet := anyOf.Met(state)
+	allReason, allMet := allOf.Met(state)
+
+	// ASSERTIONS
+	assert.True(t, anyMet)
+	assert.Equal(t, "iterations>=50", anyReason)
+	assert.True(t, allMet)
+	assert.Equal(t, "destroyed>=50% and iterations>=50", allReason)
+}
+
+func TestParseTermination(t *testing.T) {
+	cases := []struct {
+		expr     string
+		expected app.TerminationCondition
+	}{
+		{expr: "aliens<=1", expected: app.AliensAtMost(1)},
+		{expr: "timeout=1m30s", expected: app.Timeout(90 * time.Second)},
+		{expr: "destroyed>=12.5%", expected: app.DestroyedAtLeast(12.5)},
+		{expr: "no_movement", expected: app.NoMovement{}},
+		{expr: "city_destroyed=X5", expected: app.CityIsDestroyed("X5")},
+		{
+			expr:     "aliens<=1 or no_movement AND iterations>=100",
+			expected: app.AnyOf{app.AliensAtMost(1), app.AllOf{app.NoMovement{}, app.IterationsAtLeast(100)}},
+		},
+		{
+			expr:     "(aliens<=1 or no_movement) and iterations>=100",
+			expected: app.AllOf{app.AnyOf{app.AliensAtMost(1), app.NoMovement{}}, app.IterationsAtLeast(100)},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.expr, func(t *testing.T) {
+			// ACTION
+			actual, err := app.ParseTermination(c.expr)
+			again, againErr := app.ParseTermination(actual.String())
+
+			// ASSERTIONS
+			assert.NoError(t, err)
+			assert.NoError(t, againErr)
+			assert.Equal(t, c.expected, actual)
+			assert.Equal(t, c.expected, again)
+		})
+	}
+}
+
+func TestParseTerminationWithWrongExpression(t *testing.T) {
+	cases := []struct {
+		expr     string
+		expected string
+	}{
+		{expr: "", expected: "the termination condition is empty"},
+		{expr: "aliens<1", expected: "wrong termination condition \"aliens<1\": unknown condition \"aliens<1\""},
+		{expr: "aliens<=-1", expected: "the number of aliens in \"aliens<=-1\" must be a non-negative integer"},
+		{expr: "timeout=soon", expected: "the duration in \"timeout=soon\" must be positive like 30s or 5m"},
+		{expr: "destroyed>=120%", expected: "the percent in \"destroyed>=120%\" must be between 0 and 100"},
+		{expr: "aliens<=1 or", expected: "missing condition at the end"},
+		{expr: "(aliens<=1 or no_movement", expected: "missing )"},
+		{expr: "aliens<=1 no_movement", expected: "unexpected \"no_movement\""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.expr, func(t *testing.T) {
+			// ACTION
+			_, err := app.ParseTermination(c.expr)
+
+			// ASSERTIONS
+			assert.ErrorContains(t, err, c.expected)
+		})
+	}
+}
+
+func TestInvasionStopsWhenTheCityIsDestroyed(t *testing.T) {
+	// SETUP
+	mockRand := new(MockRandomizer)
+	mockMovementsOfThe9Aliens(mockRand)
+	buf := bytes.NewBufferString("")
+	commander := app.NewAlienCommander(createWorldMap(), 9, mockRand, buf, 10000, app.WithTermination(app.CityIsDestroyed("C4")))
+
+	// ACTION
+	err := commander.StartInvasion()
+	res := commander.Result()
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, "city_destroyed=C4", res.StopReason)
+	assert.Equal(t, 1, res.Iterations)
+	assert.Contains(t, res.DestroyedCities, "C4")
+}
+
+func TestInvasionStopsByDefaultCondition(t *testing.T) {
+	// SETUP
+	mockRand := new(MockRandomizer)
+	mockMovementsOfThe2Aliens(mockRand)
+	commander := app.NewAlienCommander(createWorldMap(), 2, mockRand, bytes.NewBufferString(""), 2)
+
+	// ACTION
+	err := commander.StartInvasion()
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, "iterations>=2", commander.Result().StopReason)
+}
+
+func TestMaxIterationsStopsTheInvasionIfTheConditionIsNeverMet(t *testing.T) {
+	// SETUP
+	commander := app.NewAlienCommander(createWorldMap(), 2, app.NewSeededRandomPath(1), bytes.NewBufferString(""), 5,
+		app.WithTermination(app.CityIsDestroyed("Foo")))
+
+	// ACTION
+	err := commander.StartInvasion()
+	res := commander.Result()
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, "iterations>=5", res.StopReason)
+	assert.Equal(t, 5, res.Iterations)
+}
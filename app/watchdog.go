@@ -0,0 +1,185 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// ErrDeadlock is returned by StartInvasion when a city doesn't accept a command or
+// doesn't reply to it within the timeout of the watchdog.
+var ErrDeadlock = errors.New("deadlock")
+
+// ErrLivelock is returned by StartInvasion when the invasion makes no progress for
+// the number of iterations of the watchdog although some aliens can move.
+var ErrLivelock = errors.New("livelock")
+
+// Watchdog stops an invasion that doesn't make progress (see WithWatchdog). The
+// zero value checks nothing.
+type Watchdog struct {
+	// Ticks is the number of iterations in a row in which no alien moves and no city
+	// is destroyed, although at least one alien is in a city with an open path, after
+	// which the invasion is stopped with ErrLivelock. Zero disables the check.
+	Ticks int
+	// Timeout is how long the commander waits for a city to accept a command and
+	// to reply to it before the invasion is stopped with ErrDeadlock. Zero disables
+	// the check.
+	Timeout time.Duration
+	// Diagnostics is where the state of every city and alien and the stacks of all
+	// goroutines are written when the watchdog stops the invasion. It can be nil.
+	Diagnostics io.Writer
+}
+
+// WithWatchdog stops the invasion with an error instead of running or hanging
+// forever when it doesn't make progress. After a deadlock the goroutines of the
+// stuck cities and aliens can't be stopped, so they are left behind.
+func WithWatchdog(w Watchdog) Option {
+	return func(ac *AlienCommander) {
+		ac.watchdog = w
+	}
+}
+
+// send sends the command to the city. It fails if the city doesn't accept it
+// within the timeout of the watchdog.
+func (ac *AlienCommander) send(c *City, cmd command) error {
+	ac.command = cmd
+	timeout := ac.watchdog.Timeout
+	if timeout <= 0 {
+		c.commands <- cmd
+		ac.pending[c.ID] = true
+		return nil
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case c.commands <- cmd:
+		ac.pending[c.ID] = true
+		return nil
+	case <-t.C:
+		return fmt.Errorf("%w: the city %s didn't accept the command %s within %s", ErrDeadlock, c.Name, cmd, timeout)
+	}
+}
+
+// receive receives the next sitrep. It fails if no city replies within the timeout
+// of the watchdog.
+func (ac *AlienCommander) receive() (Sitrep, error) {
+	var sr Sitrep
+	timeout := ac.watchdog.Timeout
+	if timeout <= 0 {
+		sr = <-ac.sitreps
+	} else {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		select {
+		case sr = <-ac.sitreps:
+		case <-t.C:
+			return Sitrep{}, fmt.Errorf("%w: the cities %s didn't reply to the command %s within %s",
+				ErrDeadlock, strings.Join(ac.pendingCities(), ", "), ac.command, timeout)
+		}
+	}
+	delete(ac.pending, sr.CityID)
+	ac.lastSitreps[sr.CityID] = sr
+	return sr, nil
+}
+
+func (ac *AlienCommander) pendingCities() []string {
+	var names []string
+	for _, c := range ac.cities {
+		if ac.pending[c.ID] {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// checkProgress counts the iterations without progress and fails when there are
+// as many of them in a row as the ticks of the watchdog. canMove tells whether an
+// alien could move in the iteration.
+func (ac *AlienCommander) checkProgress(canMove bool) error {
+	if ac.watchdog.Ticks <= 0 {
+		return nil
+	}
+	if ac.progressed || !canMove {
+		ac.stalled = 0
+		return nil
+	}
+	ac.stalled++
+	if ac.stalled < ac.watchdog.Ticks {
+		return nil
+	}
+	return fmt.Errorf("%w: no alien moved and no city was destroyed in the last %d iterations although %d aliens can move",
+		ErrLivelock, ac.stalled, len(ac.positions))
+}
+
+// diagnose writes the state of every city and alien as the commander knows it and
+// the stacks of all goroutines to the diagnostics writer of the watchdog.
+func (ac *AlienCommander) diagnose(err error) {
+	w := ac.watchdog.Diagnostics
+	if w == nil {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("watchdog: %s\n", err))
+	sb.WriteString(fmt.Sprintf("iteration: %d\n", ac.iterations+1))
+	sb.WriteString("cities:\n")
+	for _, c := range ac.cities {
+		sb.WriteString(fmt.Sprintf("  %s: %s\n", c.Name, ac.cityState(c)))
+	}
+	sb.WriteString("aliens:\n")
+	for _, a := range ac.aliens {
+		sb.WriteString(fmt.Sprintf("  alien %d: %s\n", a.ID, ac.alienState(a)))
+	}
+	sb.WriteString("goroutines:\n")
+	sb.Write(stacks())
+	_, _ = io.WriteString(w, sb.String())
+}
+
+func (ac *AlienCommander) cityState(c *City) string {
+	sr, ok := ac.lastSitreps[c.ID]
+	if ok && sr.Destroyed {
+		return "destroyed"
+	}
+	var state string
+	if ok {
+		ids := make([]string, len(sr.Aliens))
+		for i, a := range sr.Aliens {
+			ids[i] = fmt.Sprint(a.ID)
+		}
+		state = fmt.Sprintf("aliens [%s], %d open paths", strings.Join(ids, " "), sr.OpenPaths)
+	} else {
+		state = "no sitrep yet"
+	}
+	if ac.pending[c.ID] {
+		state += fmt.Sprintf(", no reply to the command %s", ac.command)
+	}
+	return state
+}
+
+func (ac *AlienCommander) alienState(a Alien) string {
+	if cityID, ok := ac.positions[a.ID]; ok {
+		return "in " + ac.cities[cityID].Name
+	}
+	if to, ok := ac.onTheRoad[a.ID]; ok {
+		return "on the road to " + to
+	}
+	if cityID, ok := ac.inTransit[a.ID]; ok {
+		return "on the long road to " + ac.cities[cityID].Name
+	}
+	return "dead"
+}
+
+// stacks returns the stacks of all goroutines.
+func stacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 1<<26 {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,78 @@
+package app_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchdogStopsALivelock(t *testing.T) {
+	// SETUP
+	// the aliens refuse to take any of the open paths, so nothing ever happens
+	refuse := app.RandomPath(func(paths []app.Path) (app.Path, error) {
+		return app.Path{}, errors.New("the alien doesn't want to leave")
+	})
+	buf := bytes.NewBufferString("")
+	ac := app.NewAlienCommander(app.GenerateGrid(2, 2), 2, refuse, io.Discard, 100,
+		app.WithWatchdog(app.Watchdog{Ticks: 3, Diagnostics: buf}))
+
+	// ACTION
+	err := ac.StartInvasion()
+
+	// ASSERTIONS
+	assert.ErrorIs(t, err, app.ErrLivelock)
+	assert.EqualError(t, err, "livelock: no alien moved and no city was destroyed in the last 3 iterations although 2 aliens can move")
+	assert.Equal(t, 3, ac.Result().Iterations)
+	assert.Contains(t, buf.String(), "watchdog: livelock: ")
+	assert.Contains(t, buf.String(), "  X1: aliens [0], 2 open paths\n")
+	assert.Contains(t, buf.String(), "  X3: aliens [], 2 open paths\n")
+	assert.Contains(t, buf.String(), "  alien 1: in X2\n")
+	assert.Contains(t, buf.String(), "goroutines:\n")
+}
+
+func TestWatchdogStopsADeadlock(t *testing.T) {
+	// SETUP
+	// the first alien never chooses a path, so its city never replies
+	block := make(chan struct{})
+	defer close(block)
+	stuck := app.RandomPath(func(paths []app.Path) (app.Path, error) {
+		<-block
+		return app.Path{}, errors.New("stuck")
+	})
+	buf := bytes.NewBufferString("")
+	ac := app.NewAlienCommander(app.GenerateGrid(2, 2), 2, stuck, io.Discard, 100,
+		app.WithWatchdog(app.Watchdog{Timeout: 50 * time.Millisecond, Diagnostics: buf}))
+
+	// ACTION
+	err := ac.StartInvasion()
+
+	// ASSERTIONS
+	assert.ErrorIs(t, err, app.ErrDeadlock)
+	assert.EqualError(t, err, "deadlock: the cities X1 didn't reply to the command releaseAlien within 50ms")
+	assert.Contains(t, buf.String(), "iteration: 1\n")
+	assert.Contains(t, buf.String(), "  X1: aliens [0], 2 open paths, no reply to the command releaseAlien\n")
+	assert.Contains(t, buf.String(), "  alien 0: in X1\n")
+	assert.Contains(t, buf.String(), "app.Alien.Start")
+}
+
+func TestWatchdogDoesNotStopAnInvasionThatMakesProgress(t *testing.T) {
+	// SETUP
+	wm := app.GenerateGrid(4, 4)
+
+	for seed := int64(0); seed < 5; seed++ {
+		ac := app.NewAlienCommander(wm, 8, app.NewSeededRandomPath(seed), io.Discard, 1000,
+			app.WithPlacement(app.NewUniformPlacement(seed, false)),
+			app.WithWatchdog(app.Watchdog{Ticks: 1, Timeout: 5 * time.Second}))
+
+		// ACTION
+		err := ac.StartInvasion()
+
+		// ASSERTION
+		assert.NoError(t, err)
+	}
+}
@@ -1,178 +1,379 @@
 package app
 
-//
-//import (
-//	"sort"
-//	"sync"
-//)
-//
-//// Destroy marks the current city as destroyed and destroys all roads (channels) leading in or out of the city.
-//// If the city is already destroyed, the function returns the city unchanged. Otherwise, it marks the city as destroyed,
-//// makes all the incoming roads to be empty, and closes all outgoing roads.
-////
-//// This function emulates the effect of an invasion on the city and its connected roads in the simulated world.
-//// When a city is destroyed, it's no longer accessible via any of the roads, so all the roads (represented by channels)
-//// are closed. This makes the city isolated from the rest of the cities in the world.
-////
-//// Destroy operates on a copy of the City (as it does not have a pointer receiver),
-//// so remember to assign the result of the Destroy call to the original city if the changes need to be persisted.
-////
-//// This method is used from the commander when 2 or more aliens visit the city, and they destroy it.
-//// AlienCommander use this method updated the world map that he has.
-////
-//// Returns: A copy of the city with the applied changes.
-//func (c City) Destroy() City {
-//	if c.IsDestroyed {
-//		return c
-//	}
-//	c.IsDestroyed = true
-//	c.Alien = nil
-//	c.IncomingRoads = make([]chan Alien, 4) // destroy all incoming roads
-//	c.OutgoingRoadsNames = make([]string, 4)
-//
-//	// destroy all outgoing roads.
-//	for i, r := range c.OutgoingRoads {
-//		if r == nil {
-//			continue
-//		}
-//		// by closing the channel we send event to the city that is on the
-//		// other side that this city is destroyed and this road can be used anymore.
-//		close(r)
-//		c.OutgoingRoads[i] = nil
-//	}
-//	return c
-//}
-//
-//// Road represents a path connecting two cities in the world.
-//// Each Road has a name, and a channel (Ch) that facilitates the movement of Aliens.
-//// Aliens use this channel to travel from one city to another during the invasion.
-//// In our model, every channel (road) has only one direction. This represents the fact
-//// that aliens can only travel in one direction along a road. For example, if there's a
-//// channel leading out from city A to city B, aliens can only use this channel to travel
-//// from A to B, not the other way around. To represent bidirectional travel between two cities,
-//// we use two separate channels. One for A to B, and another for B to A. This means that each pair
-//// of connected cities is linked by two channels: one for each direction of travel. This model
-//// ensures clarity in movement and road utilization, as each channel clearly defines the direction of
-//// travel between cities.
-////
-//// Fields:
-////   - Name: the unique identifier for the road.
-////   - Ch: the channel used by Aliens to traverse this road. This channel essentially simulates the road,
-////     allowing aliens to be "sent" from one city to another. If the channel is closed, this
-////     implies that the road is destroyed and can no longer be used by aliens.
-//type Road struct {
-//	Name string
-//	Ch   chan Alien
-//}
-//
-//// City for simplicity we will add a convention that the in/out roads North, South, East,
-//// and West will be always in slace's indexes 0 (north), 1 (south), 2 (east), 3 (west).
-//type City struct {
-//	ID                 int
-//	Name               string
-//	OutgoingRoads      []chan Alien
-//	IncomingRoads      []chan Alien
-//	IsDestroyed        bool
-//	Alien              *Alien
-//	Sitrep             chan Sitrep
-//	OutgoingRoadsNames []string
-//}
-//
-//// CheckForIncomingAliens checks all incoming roads for incoming alien soldiers.
-//// It runs concurrently, and when an alien is detected, the alien is added to a list of aliens.
-////
-//// If the function detects one or more aliens arriving via the same road, it sends a situation report (Sitrep)
-//// containing the list of aliens and the name of the city. The Sitrep is sent through a channel of the first
-//// alien in the list. On the other side of the channel is the AlienCommander which determine what to do base on
-//// the information in the Sitrep.
-////
-//// The function uses a WaitGroup to coordinate with other concurrently running tasks. The method should be use
-//// during the current iteration of the invasion after the commander gives orders to his soldiers.
-////
-//// Parameters:
-////   - wg: a pointer to a sync.WaitGroup used for managing concurrent tasks
-////
-//// This function does not return any value.
-//func (c City) CheckForIncomingAliens(wg *sync.WaitGroup) {
-//	defer wg.Done()
-//	var aliens []Alien
-//	for _, road := range c.IncomingRoads {
-//		// If the road does not exist, skip this iteration
-//		if road == nil {
-//			continue
-//		}
-//
-//		// Check for incoming alien
-//		select {
-//		case alien, ok := <-road:
-//			// If the road is destroyed or the alien is already killed (probably this should not happen), skip this iteration
-//			if !ok || alien.Killed {
-//				continue
-//			}
-//			aliens = append(aliens, alien)
-//		default:
-//		}
-//	}
-//
-//	if len(aliens) == 0 {
-//		return
-//	}
-//
-//	sort.Slice(aliens, func(i, j int) bool {
-//		return aliens[i].ID < aliens[j].ID
-//	})
-//
-//	// If there are one or more aliens, an alien send a situation report to his commander.
-//	c.Sitrep <- Sitrep{FromAliens: aliens, CityName: c.Name, CityID: c.ID}
-//}
-//
-//// CheckForDestroyedRoads checks the status of each incoming road to the city.
-//// If a road (or channel) has been destroyed, it is removed from the city's incoming
-//// and outgoing road lists, and the corresponding entry in the city's OutgoingRoadsNames
-//// is cleared.
-////
-//// This function is designed to run asynchronously in a goroutine, so it receives a WaitGroup
-//// as an argument to coordinate with other concurrently running tasks. Once it finishes
-//// its job, it calls Done on the WaitGroup to indicate completion.
-////
-//// Use this method after all aliens finished with their job/movements during the iteration.
-////
-//// The function returns the updated city.
-////
-//// Parameters:
-////   - wg: a pointer to a sync.WaitGroup used to coordinate with other concurrent tasks
-////
-//// Returns:
-////   - City: the updated city with the status of its roads checked and adjusted
-//func (c City) CheckForDestroyedRoads(wg *sync.WaitGroup) City {
-//	defer wg.Done()
-//
-//	for i, road := range c.IncomingRoads {
-//		// Check each road to see if it has been destroyed
-//		select {
-//		case _, ok := <-road:
-//			if !ok {
-//				// If the road is destroyed, remove it from the incoming and outgoing roads
-//				// and clear the corresponding name from OutgoingRoadsNames
-//				c.IncomingRoads[i] = nil
-//				c.OutgoingRoads[i] = nil
-//				c.OutgoingRoadsNames[i] = ""
-//			}
-//			// If there is no destruction status available for this road, continue the loop
-//		default:
-//		}
-//	}
-//
-//	// Return the updated city
-//	return c
-//}
-//
-//func (c City) SetAlien(a *Alien) City {
-//	c.Alien = a
-//	return c
-//}
-//
-//func (c City) SetSitrep(sr chan Sitrep) City {
-//	c.Sitrep = sr
-//	return c
-//}
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Direction is one of the four compass directions a road can lead out of a city.
+// The order of the constants is the order in which the roads of a city are
+// stored and printed: north, south, east, west.
+type Direction int
+
+const (
+	North Direction = iota
+	South
+	East
+	West
+)
+
+var directionNames = [...]string{"north", "south", "east", "west"}
+
+// ParseDirection converts the textual direction used in the world map file
+// (case-insensitive) to a Direction.
+func ParseDirection(s string) (Direction, error) {
+	for i, n := range directionNames {
+		if strings.ToLower(s) == n {
+			return Direction(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown direction %q. Expected 'west/north/east/south'", s)
+}
+
+func (d Direction) String() string {
+	if d < North || d > West {
+		return fmt.Sprintf("Direction(%d)", int(d))
+	}
+	return directionNames[d]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Direction) MarshalText() ([]byte, error) {
+	if d < North || d > West {
+		return nil, fmt.Errorf("unknown direction %d", int(d))
+	}
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Direction) UnmarshalText(text []byte) error {
+	parsed, err := ParseDirection(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Opposite returns the direction of the road that leads back.
+func (d Direction) Opposite() Direction {
+	switch d {
+	case North:
+		return South
+	case South:
+		return North
+	case East:
+		return West
+	default:
+		return East
+	}
+}
+
+// Road is a road leading out of a city as it is described in the world map file,
+// for example "east=X2", "east=X2:3" for a road of length 3, "east=X2:3:2" for a
+// road of length 3 with a capacity of 2 aliens or "east->X2" for a one-way road.
+type Road struct {
+	Direction Direction `json:"direction"`
+	To        string    `json:"to"`
+	// Length is the number of iterations an alien travels on the road. Zero means
+	// an ordinary road of length 1, on which the alien arrives in the same iteration.
+	Length int `json:"length,omitempty"`
+	// OneWay is set if the aliens can travel on the road only to the city To. The
+	// city To doesn't get a road back.
+	OneWay bool `json:"one_way,omitempty"`
+	// Capacity is the number of aliens that can travel on the road to the city To
+	// at the same time. Zero means no limit. An alien arrives on an ordinary road in
+	// the iteration it leaves and only one alien leaves a city in an iteration, so
+	// the capacity limits only the long roads.
+	Capacity int `json:"capacity,omitempty"`
+}
+
+func (r Road) String() string {
+	sep := "="
+	if r.OneWay {
+		sep = "->"
+	}
+	if r.Capacity > 0 {
+		return fmt.Sprintf("%s%s%s:%d:%d", r.Direction, sep, r.To, r.travelTime(), r.Capacity)
+	}
+	if r.Length > 1 {
+		return fmt.Sprintf("%s%s%s:%d", r.Direction, sep, r.To, r.Length)
+	}
+	return fmt.Sprintf("%s%s%s", r.Direction, sep, r.To)
+}
+
+// travelTime returns the number of iterations an alien travels on the road.
+func (r Road) travelTime() int {
+	if r.Length < 1 {
+		return 1
+	}
+	return r.Length
+}
+
+// CityInfo describes one city of the world map and the roads leading out of it.
+type CityInfo struct {
+	ID    int    `json:"-"`
+	Name  string `json:"name"`
+	Roads []Road `json:"roads"`
+}
+
+// WorldMap is the parsed description of the world. It does not contain any
+// channels or goroutines, so one WorldMap can be used to start many independent
+// invasions. The cities are sorted by name and the ID of every city is its index
+// in Cities.
+type WorldMap struct {
+	Cities []CityInfo `json:"cities"`
+	ids    map[string]int
+}
+
+// NewWorldMap creates a world map from the cities and makes the roads symmetric:
+// if a city X1 has a road "east=X2" and X2 doesn't have any road back to X1,
+// a road "west=X1" of the same length and capacity is added to X2. The one-way
+// roads like "east->X2" don't get a road back. Cities that are only referenced by
+// a road are added to the map too.
+func NewWorldMap(cities []CityInfo) *WorldMap {
+	byName := map[string]*CityInfo{}
+	get := func(name string) *CityInfo {
+		c, ok := byName[name]
+		if !ok {
+			c = &CityInfo{Name: name}
+			byName[name] = c
+		}
+		return c
+	}
+
+	for _, c := range cities {
+		city := get(c.Name)
+		city.Roads = append(city.Roads, c.Roads...)
+	}
+
+	// copy the names first because the loop can add cities that are only referenced
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, r := range byName[name].Roads {
+			neighbour := get(r.To)
+			if !r.OneWay && !hasRoadTo(neighbour.Roads, name) {
+				neighbour.Roads = append(neighbour.Roads, Road{Direction: r.Direction.Opposite(), To: name, Length: r.Length, Capacity: r.Capacity})
+			}
+		}
+	}
+
+	names = names[:0]
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	wm := &WorldMap{Cities: make([]CityInfo, len(names)), ids: make(map[string]int, len(names))}
+	for i, name := range names {
+		c := byName[name]
+		sort.SliceStable(c.Roads, func(i, j int) bool {
+			return c.Roads[i].Direction < c.Roads[j].Direction
+		})
+		wm.Cities[i] = CityInfo{ID: i, Name: name, Roads: c.Roads}
+		wm.ids[name] = i
+	}
+	return wm
+}
+
+// CityID returns the ID of the city with the given name.
+func (wm *WorldMap) CityID(name string) (int, bool) {
+	id, ok := wm.ids[name]
+	return id, ok
+}
+
+// String returns the world map in the format of the world map file. A line of the
+// file must contain a road, so the cities without roads are left out. The cities
+// at the end of one-way roads are added again when the file is parsed.
+func (wm *WorldMap) String() string {
+	var sb strings.Builder
+	for _, c := range wm.Cities {
+		if len(c.Roads) == 0 {
+			continue
+		}
+		sb.WriteString(c.Name)
+		for _, r := range c.Roads {
+			sb.WriteString(" " + r.String())
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// WriteJSON writes the world map as a JSON document.
+func (wm *WorldMap) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(wm); err != nil {
+		return fmt.Errorf("writing world map as JSON: %w", err)
+	}
+	return nil
+}
+
+// ReadWorldMapJSON reads a world map written by WriteJSON.
+func ReadWorldMapJSON(r io.Reader) (*WorldMap, error) {
+	var wm WorldMap
+	if err := json.NewDecoder(r).Decode(&wm); err != nil {
+		return nil, fmt.Errorf("reading world map as JSON: %w", err)
+	}
+	for _, c := range wm.Cities {
+		if c.Name == "" {
+			return nil, errors.New("reading world map as JSON: a city without a name")
+		}
+		for _, r := range c.Roads {
+			switch {
+			case r.To == "":
+				return nil, fmt.Errorf("reading world map as JSON: the road %s of the city %s has no destination", r.Direction, c.Name)
+			case r.To == c.Name:
+				return nil, fmt.Errorf("reading world map as JSON: the road %s of the city %s leads to the city itself", r, c.Name)
+			case r.Length < 0:
+				return nil, fmt.Errorf("reading world map as JSON: the road %s of the city %s has the negative length %d", r, c.Name, r.Length)
+			case r.Capacity < 0:
+				return nil, fmt.Errorf("reading world map as JSON: the road %s of the city %s has the negative capacity %d", r, c.Name, r.Capacity)
+			}
+		}
+	}
+	return NewWorldMap(wm.Cities), nil
+}
+
+// buildCities creates the cities that live during one invasion. Every pair of
+// connected cities is linked by two channels, one for each direction of travel.
+// A one-way road has both channels too: no alien travels on the channel back,
+// but it is closed when the city at the end of the road is destroyed, so the city
+// at the start knows that the road can't be used anymore. Both cities share a
+// counter of the aliens on the road for every direction.
+func (wm *WorldMap) buildCities() []*City {
+	cities := make([]*City, len(wm.Cities))
+	for i, c := range wm.Cities {
+		cities[i] = &City{ID: c.ID, Name: c.Name}
+	}
+
+	wm.links(func(from, to int, out Road, back *Road) {
+		ch1 := make(chan Alien, 1)
+		ch2 := make(chan Alien, 1)
+		load1, load2 := new(int32), new(int32)
+		// the city at the end of a one-way road gets an entry, on which the aliens
+		// come but can't leave
+		in := Road{Direction: out.Direction.Opposite(), To: wm.Cities[from].Name}
+		var incomingLength int
+		if back != nil {
+			in = *back
+			incomingLength = back.travelTime()
+		}
+		cities[from].paths = append(cities[from].paths, Path{
+			Direction:         out.Direction,
+			To:                out.To,
+			Length:            out.travelTime(),
+			OutgoingDirection: ch1,
+			IncomingDirection: ch2,
+			Capacity:          out.Capacity,
+			incomingLength:    incomingLength,
+			oneWay:            out.OneWay,
+			outgoingLoad:      load1,
+			incomingLoad:      load2,
+		})
+		cities[from].incoming = append(cities[from].incoming, ch2)
+		cities[to].incoming = append(cities[to].incoming, ch1)
+		cities[to].paths = append(cities[to].paths, Path{
+			Direction:         in.Direction,
+			To:                in.To,
+			Length:            in.travelTime(),
+			OutgoingDirection: ch2,
+			IncomingDirection: ch1,
+			Capacity:          in.Capacity,
+			incomingLength:    out.travelTime(),
+			oneWay:            in.OneWay,
+			entry:             back == nil,
+			outgoingLoad:      load2,
+			incomingLoad:      load1,
+		})
+	})
+
+	for _, c := range cities {
+		paths := c.paths
+		sort.SliceStable(paths, func(i, j int) bool {
+			return paths[i].Direction < paths[j].Direction
+		})
+		c.roads = append([]Path(nil), paths...)
+	}
+	return cities
+}
+
+// links calls f once for every pair of connected cities with the road from one
+// city to the other and the road back, which is nil if the road is one-way. Only
+// one path is created between two cities even if there is more than one road.
+// Every pair is visited from the city with the lower ID, in the order of its
+// roads, unless only the other city has a road, because the road is one-way.
+func (wm *WorldMap) links(f func(from, to int, out Road, back *Road)) {
+	for _, c := range wm.Cities {
+		for i, r := range c.Roads {
+			to := wm.ids[r.To]
+			if to < c.ID && hasRoadTo(wm.Cities[to].Roads, c.Name) || hasRoadTo(c.Roads[:i], r.To) {
+				continue
+			}
+
+			var back *Road
+			for _, br := range wm.Cities[to].Roads {
+				if br.To == c.Name {
+					back = &br
+					break
+				}
+			}
+			f(c.ID, to, r, back)
+		}
+	}
+}
+
+func hasRoadTo(roads []Road, name string) bool {
+	for _, r := range roads {
+		if r.To == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Neighbours returns the IDs of the cities that the roads of the city with the given
+// ID lead to, in the order of the roads. The cities with only a one-way road to the
+// city are not its neighbours. Every neighbour is returned once even if there is
+// more than one road to it, because only one path is created between two cities.
+func (wm *WorldMap) Neighbours(id int) []int {
+	var neighbours []int
+	seen := map[int]bool{}
+	for _, r := range wm.Cities[id].Roads {
+		to := wm.ids[r.To]
+		if seen[to] {
+			continue
+		}
+		seen[to] = true
+		neighbours = append(neighbours, to)
+	}
+	return neighbours
+}
+
+// Traps returns the IDs of the cities with roads to them but without any road out
+// of them. Only one-way roads lead to such a city, so an alien that comes in it is
+// trapped there until the end of the invasion.
+func (wm *WorldMap) Traps() []int {
+	incoming := make([]bool, len(wm.Cities))
+	for _, c := range wm.Cities {
+		for _, r := range c.Roads {
+			incoming[wm.ids[r.To]] = true
+		}
+	}
+	var traps []int
+	for _, c := range wm.Cities {
+		if incoming[c.ID] && len(c.Roads) == 0 {
+			traps = append(traps, c.ID)
+		}
+	}
+	return traps
+}
@@ -2,9 +2,13 @@ package app
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 // Line is a struct representing a line from the file
@@ -23,7 +27,17 @@ func ReadLines(fileName string, lines chan<- Line) {
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	if err = readLines(file, lines); err != nil {
+		panic(err)
+	}
+}
+
+// readLines sends the lines of r to the channel and closes it. It returns the
+// error of the reader, for example a line that is longer than the buffer of the
+// scanner, so the world map isn't cut off silently.
+func readLines(r io.Reader, lines chan<- Line) error {
+	defer close(lines)
+	scanner := bufio.NewScanner(r)
 	scanner.Split(bufio.ScanLines)
 
 	var lineNumber int64
@@ -32,7 +46,10 @@ func ReadLines(fileName string, lines chan<- Line) {
 		line := scanner.Text()
 		lines <- Line{Text: line, Number: lineNumber}
 	}
-	close(lines)
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading the line number %d: %w", lineNumber+1, err)
+	}
+	return nil
 }
 
 // ValidateLines reads lines from a channel, validates the format,
@@ -47,6 +64,18 @@ LOOP:
 			continue
 		}
 
+		if parts[0] == "" {
+			errs <- fmt.Errorf("line number: %d has wrong format. The name of the city can't be empty. "+
+				"Expect something like 'Foo west=Bar north=Baz' got: %s\n", l.Number, l.Text)
+			continue
+		}
+
+		if strings.ContainsAny(parts[0], "=:") || strings.Contains(parts[0], "->") {
+			errs <- fmt.Errorf("line number: %d has wrong format. The name of the city can't contain '=', ':' or '->', "+
+				"because the roads to it couldn't be read. Expect something like 'Foo west=Bar north=Baz' got: %s\n", l.Number, l.Text)
+			continue
+		}
+
 		if len(parts) > 5 {
 			errs <- fmt.Errorf("line number: %d has wrong format. A line should contains a city name and maximum "+
 				"4 road that leading out of the city. Expect something like 'Foo west=Bar north=Baz' got: %s\n", l.Number, l.Text)
@@ -54,15 +83,34 @@ LOOP:
 		}
 
 		for i, road := range parts[1:] {
-			r := strings.Split(road, "=")
-			if len(r) != 2 {
-				errs <- fmt.Errorf("on line %d the road number %d has wrong format. Expected something like 'west=Baz' got %s", l.Number, i+1, road)
+			direction, end, _, ok := splitRoad(road)
+			if !ok {
+				errs <- fmt.Errorf("on line %d the road number %d has wrong format. Expected something like 'west=Baz' or 'west->Baz' got %s", l.Number, i+1, road)
 				continue LOOP
 			}
 
-			rl := strings.ToLower(r[0])
+			rl := strings.ToLower(direction)
 			if rl != "west" && rl != "north" && rl != "east" && rl != "south" {
-				errs <- fmt.Errorf("on the line %d the road number %d has wrong direction. Expected 'west/north/east/south' got %s", l.Number, i+1, r[0])
+				errs <- fmt.Errorf("on the line %d the road number %d has wrong direction. Expected 'west/north/east/south' got %s", l.Number, i+1, direction)
+				continue LOOP
+			}
+
+			to, _, _, err := parseRoadEnd(end)
+			if errors.Is(err, errWrongCapacity) {
+				errs <- fmt.Errorf("on the line %d the road number %d has wrong capacity. Expected a positive number like 'west=Baz:3:2' got %s", l.Number, i+1, road)
+				continue LOOP
+			} else if err != nil {
+				errs <- fmt.Errorf("on the line %d the road number %d has wrong length. Expected a positive number like 'west=Baz:3' got %s", l.Number, i+1, road)
+				continue LOOP
+			}
+
+			if to == "" {
+				errs <- fmt.Errorf("on the line %d the road number %d has no destination. Expected something like 'west=Baz' or 'west->Baz' got %s", l.Number, i+1, road)
+				continue LOOP
+			}
+
+			if to == parts[0] {
+				errs <- fmt.Errorf("on the line %d the road number %d leads to the city itself. Expected a road to another city got %s", l.Number, i+1, road)
 				continue LOOP
 			}
 		}
@@ -71,43 +119,132 @@ LOOP:
 	}
 }
 
-var allPathsBetweenCities map[string]Path
-
 // GenerateWorldMap creates a world map from the validated parts.
 // It reads parts from a channel, and for each part creates a city
-// with its roads, and adds it to the world map.
-func GenerateWorldMap(parts <-chan []string) map[string]City {
-	wolrdMap := map[string]City{}
-
+// with its roads, and adds it to the world map. Empty parts, cities
+// without a name, roads with a wrong format, roads without a destination
+// and roads to the city itself are skipped.
+func GenerateWorldMap(parts <-chan []string) *WorldMap {
+	var cities []CityInfo
 	for p := range parts {
-		var paths []Path
+		if len(p) == 0 || p[0] == "" {
+			continue
+		}
+		city := CityInfo{Name: p[0]}
 		for _, r := range p[1:] {
-			rp := strings.Split(r, "=")
-			outDirection := fmt.Sprintf("%s-%s", p[0], rp[1])
-			inDirection := fmt.Sprintf("%s-%s", rp[1], p[0])
-
-			path, ok := allPathsBetweenCities[outDirection]
-			if ok {
-				paths = append(paths, path)
+			direction, end, oneWay, ok := splitRoad(r)
+			if !ok {
+				// the lines are usually validated by ValidateLines
 				continue
 			}
-
-			ch1 := make(chan Alien)
-			ch2 := make(chan Alien)
-
-			p1 := Path{
-				OutgoingDirection: ch1,
-				IncomingDirection: ch2,
+			d, err := ParseDirection(direction)
+			if err != nil {
+				continue
 			}
-			allPathsBetweenCities[outDirection] = p1
-			p2 := Path{
-				OutgoingDirection: ch2,
-				IncomingDirection: ch1,
+			to, length, capacity, err := parseRoadEnd(end)
+			if err != nil || to == "" || to == city.Name {
+				continue
 			}
-			allPathsBetweenCities[inDirection] = p2
+			city.Roads = append(city.Roads, Road{Direction: d, To: to, Length: length, OneWay: oneWay, Capacity: capacity})
 		}
-		wolrdMap[p[0]] = NewCity(p[0], paths)
+		cities = append(cities, city)
 	}
 
-	return wolrdMap
+	return NewWorldMap(cities)
+}
+
+// splitRoad splits a road like "east=X2" or the one-way road "east->X2" in the
+// direction and the part after "=" or "->". ok is false if the road has none of
+// them or more than one.
+func splitRoad(road string) (direction, end string, oneWay, ok bool) {
+	if r := strings.Split(road, "="); len(r) == 2 && !strings.Contains(r[1], "->") {
+		return r[0], r[1], false, true
+	}
+	if r := strings.Split(road, "->"); len(r) == 2 && !strings.Contains(road, "=") {
+		return r[0], r[1], true, true
+	}
+	return "", "", false, false
+}
+
+// errWrongCapacity is returned by parseRoadEnd if the capacity of the road is
+// not a positive number.
+var errWrongCapacity = errors.New("wrong capacity")
+
+// parseRoadEnd splits the part of a road after "=" in the name of the city, the
+// optional length of the road and the optional capacity after it, for example
+// "X2:3" or "X2:3:2". The length is 0 if it is not given or 1, so the road is
+// written back without it like the other ordinary roads. The capacity is 0 if it
+// is not given.
+func parseRoadEnd(s string) (string, int, int, error) {
+	to, length, ok := strings.Cut(s, ":")
+	if !ok {
+		return s, 0, 0, nil
+	}
+	length, capacity, hasCapacity := strings.Cut(length, ":")
+	n, err := strconv.Atoi(length)
+	if err != nil || n < 1 {
+		return "", 0, 0, fmt.Errorf("wrong length %q of the road to %s", length, to)
+	}
+	if n == 1 {
+		n = 0
+	}
+	if !hasCapacity {
+		return to, n, 0, nil
+	}
+	c, err := strconv.Atoi(capacity)
+	if err != nil || c < 1 {
+		return "", 0, 0, fmt.Errorf("%w %q of the road to %s", errWrongCapacity, capacity, to)
+	}
+	return to, n, c, nil
+}
+
+// ParseWorldMap reads a world map in the format of the world map file from r. The
+// lines are validated by the number of workers in parallel, like the lines of the
+// world map file. It returns all errors found in the lines; the world map is nil
+// if there is at least one error. The number of workers must be positive.
+func ParseWorldMap(r io.Reader, workers int) (*WorldMap, []error) {
+	if workers < 1 {
+		return nil, []error{fmt.Errorf("the number of workers must be positive, got %d", workers)}
+	}
+	lines := make(chan Line, 1000)
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- readLines(r, lines)
+	}()
+
+	parts := make(chan []string, 1000)
+	errCh := make(chan error)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ValidateLines(lines, parts, errCh)
+		}()
+	}
+
+	var errs []error
+	errsDone := make(chan struct{})
+	go func() {
+		for e := range errCh {
+			errs = append(errs, e)
+		}
+		close(errsDone)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(parts)
+		close(errCh)
+	}()
+	wm := GenerateWorldMap(parts)
+	<-errsDone
+	if err := <-readErr; err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return wm, nil
 }
@@ -0,0 +1,107 @@
+package app_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/stretchr/testify/assert"
+)
+
+// The property tests check on many generated world maps what must hold for every
+// world map. The generator is seeded, so a failure can be reproduced by its seed.
+
+func TestPropertyGeneratedWorldMapsAreSymmetric(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			// ACTION
+			wm := randomWorldMap(rand.New(rand.NewSource(seed)))
+
+			// ASSERTION
+			assertSymmetric(t, wm)
+		})
+	}
+}
+
+func TestPropertyParseSerializeParseIsIdentity(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			// SETUP
+			// a line of the world map file must contain at least one road, so the
+			// cities without roads can't be written in the format
+			var cities []app.CityInfo
+			for _, c := range randomWorldMap(rand.New(rand.NewSource(seed))).Cities {
+				if len(c.Roads) > 0 {
+					cities = append(cities, c)
+				}
+			}
+			wm := app.NewWorldMap(cities)
+
+			// ACTION
+			parsed, errs := app.ParseWorldMap(strings.NewReader(wm.String()), 3)
+
+			// ASSERTIONS
+			assert.Empty(t, errs)
+			assert.Equal(t, wm, parsed)
+		})
+	}
+}
+
+func TestPropertyJSONRoundTripIsIdentity(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			// SETUP
+			wm := randomWorldMap(rand.New(rand.NewSource(seed)))
+			buf := bytes.NewBufferString("")
+
+			// ACTION
+			err := wm.WriteJSON(buf)
+			read, readErr := app.ReadWorldMapJSON(buf)
+
+			// ASSERTIONS
+			assert.NoError(t, err)
+			assert.NoError(t, readErr)
+			assert.Equal(t, wm, read)
+		})
+	}
+}
+
+func TestPropertyRepairIsIdempotent(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			// SETUP
+			wm := randomWorldMap(rand.New(rand.NewSource(seed)))
+
+			// ACTION
+			repaired := app.NewWorldMap(wm.Cities)
+
+			// ASSERTION
+			assert.Equal(t, wm, repaired)
+		})
+	}
+}
+
+func TestPropertyNeighboursOfAGridAreNextToEachOther(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			// SETUP
+			// the random world maps are parts of a grid, so they can be drawn exactly
+			wm := randomWorldMap(rand.New(rand.NewSource(seed)))
+
+			// ACTION
+			l := app.NewLayout(wm)
+
+			// ASSERTIONS
+			assert.Empty(t, l.Contradictions)
+			for _, c := range wm.Cities {
+				for _, r := range c.Roads {
+					to, _ := wm.CityID(r.To)
+					assert.Equal(t, 1, l.Distance(c.ID, to), "the road %s %s", c.Name, r)
+				}
+			}
+		})
+	}
+}
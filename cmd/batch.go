@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"github.com/EmilGeorgiev/alvasion/app"
+	"log"
+	"os"
+	"strings"
+)
+
+// runBatch runs many seeded invasions of the world map and stores the aggregated result.
+func runBatch(args []string) error {
+	fs, o := newFlagSet("batch")
+	runs := fs.Int("runs", 1000, "number of invasions")
+	parallel := fs.Int("parallel", 0, "number of invasions that run in parallel (0 means the number of CPUs)")
+	out := fs.String("out", "batch.json", "file where the result is stored. The format is CSV if the name ends with .csv and JSON otherwise")
+	watchdog := watchdogFlags(fs)
+	metricsAddr := fs.String("metrics-addr", "", "address to serve the metrics in the Prometheus format on while the batch runs, for example localhost:9090")
+	if err := o.parse(args); err != nil {
+		return err
+	}
+	cfg, err := o.config()
+	if err != nil {
+		return err
+	}
+
+	ps, err := placement(cfg)
+	if err != nil {
+		return err
+	}
+	tc, err := termination(cfg)
+	if err != nil {
+		return err
+	}
+	wm, err := readWorldMap(cfg)
+	if err != nil {
+		return err
+	}
+
+	m, stop, err := serveMetrics(*metricsAddr)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	s := seed(cfg)
+	log.Printf("Run %d invasions with %d aliens and seed %d.\n", *runs, cfg.NumberOfAliens, s)
+	res, err := app.RunBatch(wm, app.BatchOptions{
+		Runs:          *runs,
+		Aliens:        cfg.NumberOfAliens,
+		MaxIterations: cfg.MaxIterations,
+		Seed:          s,
+		Workers:       *parallel,
+		Placement:     ps,
+		Termination:   tc,
+		Metrics:       m,
+		Watchdog:      watchdog(),
+		HeadOn:        cfg.HeadOnCollisions,
+	})
+	if err != nil {
+		return invalidInput(err)
+	}
+
+	err = createFile(*out, func(f *os.File) error {
+		if strings.HasSuffix(*out, ".csv") {
+			return res.WriteCSV(f)
+		}
+		return res.WriteJSON(f)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("The result is stored in %s\n", *out)
+	return nil
+}
+
+// runMarkov computes analytically the probability of every city to be destroyed and
+// optionally compares it with the result of a batch of simulated invasions.
+func runMarkov(args []string) error {
+	fs, o := newFlagSet("markov")
+	iterations := fs.Int("iterations", 10, "number of iterations")
+	epsilon := fs.Float64("epsilon", 0, "drop the states with lower probability (0 means exact computation)")
+	compareRuns := fs.Int("compare-runs", 0, "number of simulated invasions to compare with (0 means no comparison)")
+	if err := o.parse(args); err != nil {
+		return err
+	}
+	cfg, err := o.config()
+	if err != nil {
+		return err
+	}
+
+	ps, err := placement(cfg)
+	if err != nil {
+		return err
+	}
+	wm, err := readWorldMap(cfg)
+	if err != nil {
+		return err
+	}
+
+	// The Markov chain starts from one placement, so a random strategy is evaluated
+	// once and the batch to compare with uses the same fixed placement.
+	s := seed(cfg)
+	aliens, err := ps.Strategy(s).Place(wm, cfg.NumberOfAliens)
+	if err != nil {
+		return invalidInput(err)
+	}
+	fixed := app.ExplicitPlacement{Cities: map[int]string{}, AllowMultiple: true}
+	for id, c := range aliens {
+		fixed.Cities[id] = wm.Cities[c].Name
+	}
+
+	log.Printf("Solve the Markov chain of %d aliens for %d iterations.\n", cfg.NumberOfAliens, *iterations)
+	res, err := app.SolveMarkov(wm, app.MarkovOptions{
+		Placement:  aliens,
+		Iterations: *iterations,
+		Epsilon:    *epsilon,
+	})
+	if err != nil {
+		return invalidInput(err)
+	}
+
+	var batch app.BatchResult
+	if *compareRuns > 0 {
+		log.Printf("Run %d invasions to compare with.\n", *compareRuns)
+		batch, err = app.RunBatch(wm, app.BatchOptions{
+			Runs:          *compareRuns,
+			Aliens:        len(aliens),
+			MaxIterations: *iterations,
+			Seed:          s,
+			Placement:     app.PlacementSpec{Kind: "file", Explicit: fixed},
+		})
+		if err != nil {
+			return invalidInput(err)
+		}
+	}
+
+	for i, c := range res.Cities {
+		if *compareRuns > 0 {
+			fmt.Printf("%s %.6f %.6f\n", c.Name, c.Probability, batch.Cities[i].Probability)
+			continue
+		}
+		fmt.Printf("%s %.6f\n", c.Name, c.Probability)
+	}
+	fmt.Printf("Dropped probability: %.6f, maximum number of states: %d\n", res.Dropped, res.MaxStates)
+
+	if *compareRuns > 0 {
+		deviations := app.CompareWithBatch(res, batch, 4)
+		for _, d := range deviations {
+			fmt.Printf("%s deviates: analytic %.6f simulated %.6f tolerance %.6f\n", d.Name, d.Analytic, d.Simulated, d.Tolerance)
+		}
+		if len(deviations) > 0 {
+			return fmt.Errorf("the simulation deviates from the analytic solution in %d cities", len(deviations))
+		}
+		fmt.Println("The simulation agrees with the analytic solution.")
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/EmilGeorgiev/alvasion/app"
+	"io"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// benchResult is the measurement of one benchmark. The results are stored as JSON,
+// so a later run can be compared with them.
+type benchResult struct {
+	Name string `json:"name"`
+	// Time is the median time of the runs.
+	Time       time.Duration `json:"time_ns"`
+	Throughput string        `json:"throughput"`
+}
+
+// runBench measures the parsing, the construction and the invasion of generated grids
+// and prints a table. With -baseline the time of every benchmark is compared with
+// the time of the same benchmark in a previous run stored with -out.
+func runBench(args []string) error {
+	fs, o := newOwnFlagSet("bench")
+	sizes := fs.String("cities", "1k,100k", "comma separated numbers of cities of the grids, for example 1k,100k,1M")
+	densities := fs.String("densities", "1,10,50,100", "comma separated percentages of the cities that have an alien at the beginning")
+	workers := fs.String("parse-workers", "1,2,4,8", "comma separated numbers of workers that validate the lines")
+	engines := fs.String("engines", "concurrent,sequential,compact,sharded", "comma separated engines of the invasion: concurrent, sequential, compact and sharded")
+	iterations := fs.Int("iterations", 10, "maximum number of iterations of every invasion")
+	runs := fs.Int("runs", 3, "number of runs of every benchmark. The median time is reported")
+	out := fs.String("out", "", "file where the results are stored as JSON (empty means they are not stored)")
+	baselinePath := fs.String("baseline", "", "results of a previous run stored with -out to compare with")
+	if err := o.parse(args); err != nil {
+		return err
+	}
+	cities, err := parseCounts(*sizes)
+	if err != nil {
+		return usageError(fmt.Errorf("wrong -cities: %w", err))
+	}
+	percents, err := parseCounts(*densities)
+	if err != nil {
+		return usageError(fmt.Errorf("wrong -densities: %w", err))
+	}
+	workerCounts, err := parseCounts(*workers)
+	if err != nil {
+		return usageError(fmt.Errorf("wrong -parse-workers: %w", err))
+	}
+	engineNames := strings.Split(*engines, ",")
+	for _, e := range engineNames {
+		if e != "concurrent" && e != "sequential" && e != "compact" && e != "sharded" {
+			return usageError(fmt.Errorf("unknown engine %q. Expected concurrent, sequential, compact or sharded", e))
+		}
+	}
+	if *runs < 1 || *iterations < 1 {
+		return usageError(fmt.Errorf("-runs and -iterations must be positive"))
+	}
+
+	baseline := map[string]time.Duration{}
+	if *baselinePath != "" {
+		if baseline, err = readBaseline(*baselinePath); err != nil {
+			return err
+		}
+	}
+
+	var results []benchResult
+	for _, n := range cities {
+		width := int(math.Ceil(math.Sqrt(float64(n))))
+		wm := app.GenerateGrid(width, (n+width-1)/width)
+		size := formatCount(n)
+		log.Printf("Benchmark the grid of %d cities.\n", len(wm.Cities))
+
+		text := wm.String()
+		lines := strings.Count(text, "\n")
+		for _, w := range workerCounts {
+			d := measure(*runs, func() {
+				app.ParseWorldMap(strings.NewReader(text), w)
+			})
+			results = append(results, benchResult{
+				Name:       fmt.Sprintf("parse/cities=%s/workers=%d", size, w),
+				Time:       d,
+				Throughput: fmt.Sprintf("%.0f lines/s", float64(lines)/d.Seconds()),
+			})
+		}
+
+		d := measure(*runs, func() {
+			app.NewWorldMap(wm.Cities)
+		})
+		results = append(results, benchResult{
+			Name:       "new-world-map/cities=" + size,
+			Time:       d,
+			Throughput: fmt.Sprintf("%.0f cities/s", float64(len(wm.Cities))/d.Seconds()),
+		})
+		d = measure(*runs, func() {
+			app.NewAlienCommander(wm, 1, app.NewSeededRandomPath(1), io.Discard, 1)
+		})
+		results = append(results, benchResult{
+			Name:       "new-commander/cities=" + size,
+			Time:       d,
+			Throughput: fmt.Sprintf("%.0f cities/s", float64(len(wm.Cities))/d.Seconds()),
+		})
+
+		g := app.NewCompactGraph(wm)
+		d = measure(*runs, func() {
+			g = app.NewCompactGraph(wm)
+		})
+		results = append(results, benchResult{
+			Name:       "new-compact-graph/cities=" + size,
+			Time:       d,
+			Throughput: fmt.Sprintf("%.0f cities/s", float64(len(wm.Cities))/d.Seconds()),
+		})
+
+		for _, p := range percents {
+			aliens := len(wm.Cities) * p / 100
+			for _, engine := range engineNames {
+				var res app.InvasionResult
+				var moves int
+				var invasionErr error
+				d := measure(*runs, func() {
+					moves = 0
+					invasion := newBenchInvasion(engine, wm, g, aliens, *iterations, &moves)
+					invasionErr = invasion.StartInvasion()
+					res = invasion.Result()
+				})
+				if invasionErr != nil {
+					return invalidInput(invasionErr)
+				}
+				results = append(results, benchResult{
+					Name: fmt.Sprintf("invasion/cities=%s/density=%d%%/engine=%s", size, p, engine),
+					Time: d,
+					Throughput: fmt.Sprintf("%.1f iterations/s, %.0f moves/s",
+						float64(res.Iterations)/d.Seconds(), float64(moves)/d.Seconds()),
+				})
+			}
+		}
+	}
+
+	if err = printBench(os.Stdout, results, baseline); err != nil {
+		return err
+	}
+	if *out != "" {
+		err = createFile(*out, func(f *os.File) error {
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "  ")
+			return enc.Encode(results)
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("The results are stored in %s\n", *out)
+	}
+	return nil
+}
+
+// newBenchInvasion creates an invasion of the engine with uniformly placed aliens
+// that counts the moves. All runs use the same seed, so they do the same work. The
+// event log is not stored, because it doesn't fit in memory for the big grids.
+func newBenchInvasion(engine string, wm *app.WorldMap, g *app.CompactGraph, aliens, iterations int, moves *int) app.Invasion {
+	r := app.NewSeededRandomPath(1)
+	opts := []app.Option{
+		app.WithPlacement(app.NewUniformPlacement(1, false)),
+		app.WithoutEventLog(),
+		app.WithEventHandler(func(e app.Event) {
+			if e.Type == app.AlienMoved {
+				*moves++
+			}
+		}),
+	}
+	switch engine {
+	case "sequential":
+		return app.NewSequentialCommander(wm, aliens, r, io.Discard, iterations, opts...)
+	case "compact":
+		return app.NewCompactCommander(g, aliens, 1, 0, io.Discard, iterations, opts...)
+	case "sharded":
+		return app.NewShardedCommander(g, app.PartitionGraph(g, runtime.NumCPU()), aliens, 1, io.Discard, iterations, opts...)
+	}
+	return app.NewAlienCommander(wm, aliens, r, io.Discard, iterations, opts...)
+}
+
+// measure runs f the number of times and returns the median time.
+func measure(runs int, f func()) time.Duration {
+	times := make([]time.Duration, runs)
+	for i := range times {
+		start := time.Now()
+		f()
+		times[i] = time.Since(start)
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i] < times[j]
+	})
+	return times[runs/2]
+}
+
+// printBench prints the results as a table. The change is the change of the time
+// against the baseline, so a positive change means slower.
+func printBench(w io.Writer, results []benchResult, baseline map[string]time.Duration) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BENCHMARK\tTIME\tTHROUGHPUT\tCHANGE")
+	for _, r := range results {
+		change := ""
+		if old, ok := baseline[r.Name]; ok && old > 0 {
+			change = fmt.Sprintf("%+.1f%%", 100*(r.Time.Seconds()/old.Seconds()-1))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Name, r.Time.Round(time.Microsecond), r.Throughput, change)
+	}
+	return tw.Flush()
+}
+
+func readBaseline(name string) (map[string]time.Duration, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+	var results []benchResult
+	if err = json.Unmarshal(data, &results); err != nil {
+		return nil, invalidInput(fmt.Errorf("reading the baseline %s: %w", name, err))
+	}
+	baseline := make(map[string]time.Duration, len(results))
+	for _, r := range results {
+		baseline[r.Name] = r.Time
+	}
+	return baseline, nil
+}
+
+// parseCounts parses a comma separated list of positive numbers with the optional
+// suffixes k (thousand) and M (million), for example "1k,100k,1M".
+func parseCounts(s string) ([]int, error) {
+	var counts []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		multiplier := 1
+		switch {
+		case strings.HasSuffix(part, "k"):
+			multiplier, part = 1000, strings.TrimSuffix(part, "k")
+		case strings.HasSuffix(part, "M"):
+			multiplier, part = 1000000, strings.TrimSuffix(part, "M")
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%q is not a positive number", part)
+		}
+		counts = append(counts, n*multiplier)
+	}
+	return counts, nil
+}
+
+// formatCount formats the number like parseCounts reads it.
+func formatCount(n int) string {
+	switch {
+	case n%1000000 == 0:
+		return strconv.Itoa(n/1000000) + "M"
+	case n%1000 == 0:
+		return strconv.Itoa(n/1000) + "k"
+	}
+	return strconv.Itoa(n)
+}
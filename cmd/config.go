@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// runConfig prints the effective config: "config print" shows the value of every
+// setting after the config file, the environment variables and the flags are applied.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return usageError(errors.New("usage: alvasion config print [flags]"))
+	}
+	_, o := newFlagSet("config print")
+	if err := o.parse(args[1:]); err != nil {
+		return err
+	}
+	cfg, err := o.config()
+	if err != nil {
+		return err
+	}
+	return cfg.Print(os.Stdout)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"log"
+)
+
+// runConvert reads the world map and stores it in another format. The format of
+// both files is chosen by their extension.
+func runConvert(args []string) error {
+	fs, o := newFlagSet("convert")
+	out := fs.String("out", "", "file where the converted world map is stored. The format is JSON if the name ends with .json")
+	if err := o.parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return usageError(errors.New("the flag -out is required"))
+	}
+	cfg, err := o.config()
+	if err != nil {
+		return err
+	}
+
+	wm, err := readWorldMap(cfg)
+	if err != nil {
+		return err
+	}
+	if err = writeWorldMap(*out, wm); err != nil {
+		return err
+	}
+	log.Printf("The world map %s is converted to %s\n", cfg.WorldMap, *out)
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"github.com/EmilGeorgiev/alvasion/app"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// runGenerate generates a grid world map.
+func runGenerate(args []string) error {
+	fs, o := newOwnFlagSet("generate")
+	width := fs.Int("width", 3, "number of cities in a row")
+	height := fs.Int("height", 3, "number of rows")
+	out := fs.String("out", "world-map.txt", "file where the world map is stored. The format is JSON if the name ends with .json")
+	if err := o.parse(args); err != nil {
+		return err
+	}
+	if *width <= 0 || *height <= 0 {
+		return usageError(errors.New("the width and the height must be positive"))
+	}
+
+	wm := app.GenerateGrid(*width, *height)
+	if err := writeWorldMap(*out, wm); err != nil {
+		return err
+	}
+	log.Printf("The world map with %d cities is stored in %s\n", len(wm.Cities), *out)
+	return nil
+}
+
+// writeWorldMap stores the world map in the file. Files with extension .json are
+// written as JSON, all other files in the format of the world map file.
+func writeWorldMap(name string, wm *app.WorldMap) error {
+	return createFile(name, func(f *os.File) error {
+		if strings.HasSuffix(name, ".json") {
+			return wm.WriteJSON(f)
+		}
+		_, err := io.WriteString(f, wm.String())
+		return err
+	})
+}
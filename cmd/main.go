@@ -2,124 +2,314 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/EmilGeorgiev/alvasion/config"
+	"github.com/EmilGeorgiev/alvasion/trace"
+	"io/fs"
 	"log"
 	"os"
-	"sync"
+	"sort"
+	"strings"
+	"time"
+)
 
-	"gopkg.in/yaml.v3"
+// Exit codes of the program.
+const (
+	exitOK = 0
+	// exitFailure is returned when the command fails, for example an output file can't be written.
+	exitFailure = 1
+	// exitUsage is returned for an unknown subcommand or wrong flags.
+	exitUsage = 2
+	// exitInvalidInput is returned when the config, the world map or the event log is not valid.
+	exitInvalidInput = 3
 )
 
-type Config struct {
-	WorldMap          string `yaml:"world_map"`
-	ValidationWorkers int    `yaml:"validation_workers"`
-	NumberOfAliens    int    `yaml:"number_of_aliens"`
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"run":      {usage: "run one invasion and store the report", run: runInvasion},
+	"validate": {usage: "validate the world map", run: runValidate},
+	"generate": {usage: "generate a grid world map", run: runGenerate},
+	"convert":  {usage: "convert a world map between the text and the JSON format", run: runConvert},
+	"render":   {usage: "render the world map before or after an invasion", run: runRender},
+	"batch":    {usage: "run many seeded invasions and aggregate their results", run: runBatch},
+	"markov":   {usage: "compute the probability of every city to be destroyed analytically", run: runMarkov},
+	"replay":   {usage: "replay the event log of an invasion", run: runReplay},
+	"config":   {usage: "print the effective config (config print)", run: runConfig},
+	"serve":    {usage: "serve the HTTP JSON API to run invasions", run: runServe},
+	"tui":      {usage: "animate an invasion in the terminal", run: runTUI},
+	"bench":    {usage: "measure the parsing and the invasion of generated grids", run: runBench},
 }
 
 func main() {
-	data, err := os.ReadFile("./config.yaml")
-	if err != nil {
-		log.Fatalf("Error reading YAML file: %s\n", err)
+	os.Exit(execute(os.Args[1:]))
+}
+
+// execute runs the subcommand in args[0] and returns the exit code. Without a
+// subcommand the invasion is run, so "go run . -aliens=6" works too.
+func execute(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		args = append([]string{"run"}, args...)
 	}
 
-	// Unmarshal YAML to the Config struct
-	var config Config
-	if err = yaml.Unmarshal(data, &config); err != nil {
-		log.Fatalf("Unable to unmarshal data: %s\n", err)
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		printUsage()
+		return exitUsage
 	}
 
-	log.Println("Generating World Map.")
-	wm, err := generateWorldMap(config)
-	if err != nil {
-		log.Fatalf(err.Error())
-	}
-	log.Println("worldMap is generated.")
-
-	log.Printf("Initialize %d number of aliens/soldiers.\n", config.NumberOfAliens)
-	aliens := make([]*app.Alien, config.NumberOfAliens)
-	wg := &sync.WaitGroup{}
-	for i := 0; i < config.NumberOfAliens; i++ {
-		aliens[i] = app.New(fmt.Sprintf("%d", i), 10000, wg)
-	}
-
-	if len(aliens) == 0 {
-		log.Println("There is not aliens")
-		return
-	}
-	index := 0
-Loop:
-	for {
-		for _, city := range wm {
-			a := aliens[index]
-			city.AddAlien(a)
-			a.Start()
-			index++
-			if index >= len(aliens) {
-				break Loop
-			}
+	err := cmd.run(args[1:])
+	var ee exitError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &ee):
+		log.Println(err)
+		return ee.code
+	default:
+		log.Println(err)
+		return exitFailure
+	}
+}
+
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: alvasion <command> [flags]")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-9s %s\n", name, commands[name].usage)
+	}
+}
+
+// exitError is an error that ends the program with a specific exit code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e exitError) Unwrap() error {
+	return e.err
+}
+
+func usageError(err error) error {
+	return exitError{code: exitUsage, err: err}
+}
+
+func invalidInput(err error) error {
+	return exitError{code: exitInvalidInput, err: err}
+}
+
+// options are the flags shared by the commands. They override the values from the config file.
+type options struct {
+	fs            *flag.FlagSet
+	configPath    string
+	mapPath       string
+	aliens        int
+	maxIterations int
+	seed          int64
+	workers       int
+	placement     string
+	multiple      bool
+	termination   string
+	headOn        bool
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	flags, o := newOwnFlagSet(name)
+	flags.StringVar(&o.configPath, "config", "config.yaml", "path to the config file")
+	flags.StringVar(&o.mapPath, "map", "", "path to the world map (overrides world_map)")
+	flags.IntVar(&o.aliens, "aliens", 0, "number of aliens (overrides number_of_aliens)")
+	flags.IntVar(&o.maxIterations, "max-iterations", 0, "maximum number of iterations (overrides max_iterations)")
+	flags.Int64Var(&o.seed, "seed", 0, "seed of the invasion (overrides seed)")
+	flags.IntVar(&o.workers, "workers", 0, "number of validation workers (overrides validation_workers)")
+	flags.StringVar(&o.placement, "placement", "", "placement of the aliens: sequential, uniform, region[:city], clustered:n or file:path (overrides placement)")
+	flags.BoolVar(&o.multiple, "multiple-per-city", false, "allow more than one alien per city (overrides multiple_aliens_per_city)")
+	flags.StringVar(&o.termination, "until", "", "condition that ends the invasion, for example 'aliens<=1 or iterations>=500' (overrides termination)")
+	flags.BoolVar(&o.headOn, "head-on", false, "aliens that leave both ends of a road in the same iteration destroy the road (overrides head_on_collisions)")
+	return flags, o
+}
+
+// newOwnFlagSet returns a flag set without the shared flags for the commands that
+// don't read the config file, so they don't accept flags that they would ignore.
+func newOwnFlagSet(name string) (*flag.FlagSet, *options) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	return flags, &options{fs: flags}
+}
+
+func (o *options) parse(args []string) error {
+	if err := o.fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
 		}
+		return usageError(err)
 	}
+	if o.fs.NArg() > 0 {
+		return usageError(fmt.Errorf("unexpected arguments: %s", strings.Join(o.fs.Args(), " ")))
+	}
+	return nil
+}
 
-	wg.Wait()
+// flagKeys maps the names of the flags to the keys of the settings they override.
+var flagKeys = map[string]string{
+	"map":               "world_map",
+	"workers":           "validation_workers",
+	"aliens":            "number_of_aliens",
+	"max-iterations":    "max_iterations",
+	"seed":              "seed",
+	"placement":         "placement",
+	"multiple-per-city": "multiple_aliens_per_city",
+	"until":             "termination",
+	"head-on":           "head_on_collisions",
+}
 
-	//log.Println("Initialize AlienCommander.")
-	//ac := app.NewAlienCommander(wm, aliens, sitrep)
-	//
-	//log.Println("Start the invasion!")
-	//ac.StartInvasion()
+// config resolves the config from the defaults, the config file, the environment
+// variables and the flags that are set, and validates it. If the flag -config is
+// not set and there is no config.yaml in the working directory, no file is read.
+func (o *options) config() (config.Config, error) {
+	path := o.configPath
+	if !o.isSet("config") {
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			path = ""
+		}
+	}
 
-	//log.Println("Generate the report")
-	//report := ac.GenerateReportForInvasion()
+	cfg, err := config.Load(path, os.LookupEnv)
+	if err != nil {
+		return config.Config{}, invalidInput(err)
+	}
 
-	//log.Println("Store the report in a file report.txt")
+	o.fs.Visit(func(f *flag.Flag) {
+		if key, ok := flagKeys[f.Name]; ok && err == nil {
+			err = cfg.Set(key, f.Value.String(), config.SourceFlag)
+		}
+	})
+	if err != nil {
+		return config.Config{}, usageError(err)
+	}
 
-	//f, err := os.OpenFile("report.txt", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
-	//if err != nil {
-	//	log.Fatalf("os.OpenFile error: %v", err)
-	//}
-	//defer f.Close()
+	if err = cfg.Validate(); err != nil {
+		return config.Config{}, invalidInput(err)
+	}
+	return cfg, nil
+}
 
-	//_, err = io.WriteString(f, report)
-	//if err != nil {
-	//	log.Fatalf("io.WriteString error: %v", err)
-	//}
-	log.Println("Finish")
+func (o *options) isSet(name string) bool {
+	var set bool
+	o.fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
-func generateWorldMap(config Config) (map[string]app.City, error) {
-	lines := make(chan app.Line, 1000)
-	go app.ReadLines(config.WorldMap, lines)
+// seed returns the seed of the invasion. A zero seed in the config means that a
+// seed is generated from the current time.
+func seed(cfg config.Config) int64 {
+	if cfg.Seed == 0 {
+		return time.Now().UnixNano()
+	}
+	return cfg.Seed
+}
 
-	errCh := make(chan error)
-	partsOfLine := make(chan []string, 1000)
-	wg := sync.WaitGroup{}
-	for i := 0; i < config.ValidationWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			app.ValidateLines(lines, partsOfLine, errCh)
-			wg.Done()
-		}()
+// placement parses the placement strategy of the config.
+func placement(cfg config.Config) (app.PlacementSpec, error) {
+	ps, err := app.ParsePlacementSpec(cfg.Placement, cfg.MultipleAliensPerCity)
+	if err != nil {
+		return app.PlacementSpec{}, invalidInput(err)
 	}
+	return ps, nil
+}
 
-	var hasErr bool
-	go func() {
-		for e := range errCh {
-			hasErr = true
-			fmt.Println(e)
+// termination parses the termination condition of the config. If it is empty the
+// default condition with the maximum number of iterations is used.
+func termination(cfg config.Config) (app.TerminationCondition, error) {
+	if cfg.Termination == "" {
+		return app.DefaultTermination(cfg.MaxIterations), nil
+	}
+	tc, err := app.ParseTermination(cfg.Termination)
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+	return tc, nil
+}
+
+// readWorldMap reads the world map from the file. Files with extension .json are
+// read as JSON, all other files in the format of the world map file.
+func readWorldMap(cfg config.Config) (*app.WorldMap, error) {
+	return readTracedWorldMap(cfg, nil)
+}
+
+// readTracedWorldMap reads the world map like readWorldMap and records the span of
+// the reading as a child of the span.
+func readTracedWorldMap(cfg config.Config, parent *trace.Span) (*app.WorldMap, error) {
+	span := parent.Child("read world map")
+	defer span.End()
+	span.Set("file", cfg.WorldMap)
+	if strings.HasSuffix(cfg.WorldMap, ".json") {
+		f, err := os.Open(cfg.WorldMap)
+		if err != nil {
+			return nil, invalidInput(err)
 		}
-	}()
+		defer f.Close()
 
-	go func() {
-		// wait until all validation workers finish their work and put
-		wg.Wait()
-		close(partsOfLine)
-	}()
-	wm := app.GenerateWorldMap(partsOfLine)
+		wm, err := app.ReadWorldMapJSON(f)
+		if err != nil {
+			return nil, invalidInput(err)
+		}
+		return wm, nil
+	}
+	return generateWorldMap(cfg, span)
+}
 
-	if hasErr {
-		return nil, errors.New("there are errors during parsing the file that contain cities and their outgoing roads")
+func generateWorldMap(cfg config.Config, parent *trace.Span) (*app.WorldMap, error) {
+	f, err := os.Open(cfg.WorldMap)
+	if err != nil {
+		return nil, invalidInput(fmt.Errorf("the world map can't be read: %w", err))
 	}
+	defer f.Close()
+
+	span := parent.Child("parse world map")
+	defer span.End()
+	span.Set("workers", cfg.ValidationWorkers)
+	wm, errs := app.ParseWorldMap(f, cfg.ValidationWorkers)
+	if len(errs) > 0 {
+		for _, e := range errs {
+			fmt.Println(e)
+		}
+		return nil, invalidInput(errors.New("there are errors during parsing the file that contain cities and their outgoing roads"))
+	}
+	span.Set("cities", len(wm.Cities))
 
 	return wm, nil
 }
+
+// createFile creates the file and calls write with it.
+func createFile(name string, write func(f *os.File) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("os.Create error: %w", err)
+	}
+	if err = write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/EmilGeorgiev/alvasion/metrics"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// serveMetrics serves the metrics of the invasions on http://addr/metrics in the
+// background. If addr is empty the metrics are not collected. The returned function
+// stops the server.
+func serveMetrics(addr string) (*app.Metrics, func(), error) {
+	if addr == "" {
+		return nil, func() {}, nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := metrics.NewRegistry()
+	m := app.NewMetrics(r)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("The metrics server failed: %s\n", err)
+		}
+	}()
+	log.Printf("Serve the metrics on http://%s/metrics\n", ln.Addr())
+
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}
+	return m, stop, nil
+}
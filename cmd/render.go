@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/EmilGeorgiev/alvasion/app"
+	"log"
+	"os"
+	"time"
+)
+
+// runRender renders the world map in the DOT language of Graphviz or as SVG. With
+// -events the cities destroyed in the event log are drawn dashed in DOT and
+// crossed out in SVG, and with -layout the cities are drawn on their places on
+// the grid. The SVG always uses the grid, shows where the aliens are at the end
+// and with -animate plays the whole invasion.
+func runRender(args []string) error {
+	fs, o := newFlagSet("render")
+	eventsPath := fs.String("events", "", "event log of an invasion of the world map")
+	format := fs.String("format", "dot", "format of the rendered world map: dot or svg")
+	out := fs.String("out", "", "file where the rendered world map is stored (default world.dot or world.svg)")
+	pinned := fs.Bool("layout", false, "pin the cities to their positions on the grid implied by the roads (dot)")
+	animate := fs.Bool("animate", false, "animate the invasion of the event log iteration by iteration (svg)")
+	step := fs.Duration("step", time.Second, "duration of one iteration of the animation (svg)")
+	if err := o.parse(args); err != nil {
+		return err
+	}
+	if *format != "dot" && *format != "svg" {
+		return usageError(fmt.Errorf("unknown format %q. Expected dot or svg", *format))
+	}
+	if *animate && (*format != "svg" || *eventsPath == "") {
+		return usageError(errors.New("the flag -animate requires -format svg and -events"))
+	}
+	if *out == "" {
+		*out = "world." + *format
+	}
+	cfg, err := o.config()
+	if err != nil {
+		return err
+	}
+
+	wm, err := readWorldMap(cfg)
+	if err != nil {
+		return err
+	}
+	var events []app.Event
+	if *eventsPath != "" {
+		if events, err = readEvents(*eventsPath); err != nil {
+			return err
+		}
+	}
+
+	var layout *app.Layout
+	if *pinned || *format == "svg" {
+		l := app.NewLayout(wm)
+		for _, c := range l.Contradictions {
+			log.Printf("The layout is approximate, because %s\n", c)
+		}
+		layout = &l
+	}
+
+	// the world map is rendered before the file is created, so a wrong event log doesn't leave an empty file
+	var buf bytes.Buffer
+	if *format == "svg" {
+		err = wm.WriteSVG(&buf, *layout, app.SVGOptions{Events: events, Animate: *animate, Step: *step})
+	} else {
+		destroyed := map[string]bool{}
+		for _, e := range events {
+			if e.Type == app.CityDestroyed {
+				destroyed[e.City] = true
+			}
+		}
+		if !*pinned {
+			layout = nil
+		}
+		err = wm.WriteDOT(&buf, destroyed, layout)
+	}
+	if err != nil {
+		return invalidInput(err)
+	}
+
+	err = createFile(*out, func(f *os.File) error {
+		_, err := buf.WriteTo(f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("The world map is rendered in %s\n", *out)
+	return nil
+}
+
+func readEvents(name string) ([]app.Event, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+	defer f.Close()
+
+	events, err := app.ReadEvents(f)
+	if err != nil {
+		return nil, invalidInput(err)
+	}
+	return events, nil
+}
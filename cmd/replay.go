@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"github.com/EmilGeorgiev/alvasion/app"
+	"io"
+	"log"
+	"os"
+)
+
+// runReplay applies the event log of an invasion to the world map and stores the report.
+func runReplay(args []string) error {
+	fs, o := newFlagSet("replay")
+	eventsPath := fs.String("events", "", "event log of an invasion of the world map")
+	reportPath := fs.String("report", "report.txt", "file where the report is stored")
+	if err := o.parse(args); err != nil {
+		return err
+	}
+	if *eventsPath == "" {
+		return usageError(errors.New("the flag -events is required"))
+	}
+	cfg, err := o.config()
+	if err != nil {
+		return err
+	}
+
+	wm, err := readWorldMap(cfg)
+	if err != nil {
+		return err
+	}
+	events, err := readEvents(*eventsPath)
+	if err != nil {
+		return err
+	}
+
+	report, err := app.Replay(wm, events, os.Stdout)
+	if err != nil {
+		return invalidInput(err)
+	}
+	err = createFile(*reportPath, func(f *os.File) error {
+		_, err := io.WriteString(f, report)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("The report is stored in %s\n", *reportPath)
+	return nil
+}
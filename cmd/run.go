@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/EmilGeorgiev/alvasion/trace"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// engineFlags are the flags of run that only some engines support, with the engines
+// that support them. The compact and sharded engines choose the paths without a
+// randomizer and only the concurrent engine has spans, a watchdog and invariant checks.
+var engineFlags = map[string][]string{
+	"trace":            {"concurrent"},
+	"check-invariants": {"concurrent"},
+	"watchdog-ticks":   {"concurrent"},
+	"watchdog-timeout": {"concurrent"},
+	"avoid-congestion": {"concurrent", "sequential"},
+	"shards":           {"compact", "sharded"},
+}
+
+// checkEngineFlags returns a usage error for the first flag that is set to another
+// value than its default, but isn't supported by the engine.
+func checkEngineFlags(fs *flag.FlagSet, engine string) error {
+	var unsupported []string
+	fs.Visit(func(f *flag.Flag) {
+		engines, ok := engineFlags[f.Name]
+		if !ok || f.Value.String() == f.DefValue {
+			return
+		}
+		for _, e := range engines {
+			if e == engine {
+				return
+			}
+		}
+		unsupported = append(unsupported, f.Name)
+	})
+	if len(unsupported) == 0 {
+		return nil
+	}
+	sort.Strings(unsupported)
+	name := unsupported[0]
+	engines := engineFlags[name]
+	supported := "the " + engines[0] + " engine"
+	if len(engines) > 1 {
+		supported = "the " + strings.Join(engines, " and ") + " engines"
+	}
+	return usageError(fmt.Errorf("-%s works only with %s, not with %s", name, supported, engine))
+}
+
+// runInvasion runs one invasion and stores the report and optionally the event log.
+func runInvasion(args []string) (err error) {
+	fs, o := newFlagSet("run")
+	reportPath := fs.String("report", "report.txt", "file where the report is stored")
+	eventsPath := fs.String("events", "", "file where the event log is stored (empty means no event log)")
+	tracePath := fs.String("trace", "", "file where the spans of the phases are stored as JSON lines, - for the standard output (empty means no tracing)")
+	engine := fs.String("engine", "concurrent", "engine that runs the invasion: concurrent, sequential (the single-threaded reference) compact or sharded (for huge maps)")
+	shards := fs.Int("shards", 0, "number of shards that process the aliens in parallel in the compact engine or the number of regions of the map in the sharded engine (0 means the number of CPUs)")
+	checkInvariants := fs.Bool("check-invariants", false, "verify the invariants of the invasion after every iteration and stop at the first violation (slower, concurrent engine)")
+	avoidCongestion := fs.Bool("avoid-congestion", false, "the aliens don't choose the full roads if another road is free (concurrent and sequential engines)")
+	watchdog := watchdogFlags(fs)
+	if err := o.parse(args); err != nil {
+		return err
+	}
+	if *engine != "concurrent" && *engine != "sequential" && *engine != "compact" && *engine != "sharded" {
+		return usageError(fmt.Errorf("unknown engine %q. Expected concurrent, sequential, compact or sharded", *engine))
+	}
+	if err = checkEngineFlags(fs, *engine); err != nil {
+		return err
+	}
+	cfg, err := o.config()
+	if err != nil {
+		return err
+	}
+
+	ps, err := placement(cfg)
+	if err != nil {
+		return err
+	}
+	tc, err := termination(cfg)
+	if err != nil {
+		return err
+	}
+
+	tracer, closeTrace, err := newTracer(*tracePath)
+	if err != nil {
+		return err
+	}
+	span := tracer.Start("run")
+	defer func() {
+		span.End()
+		if cerr := closeTrace(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}()
+
+	log.Println("Generating World Map.")
+	wm, err := readTracedWorldMap(cfg, span)
+	if err != nil {
+		return err
+	}
+	log.Println("worldMap is generated.")
+
+	log.Printf("Initialize AlienCommander with %d number of aliens/soldiers.\n", cfg.NumberOfAliens)
+	s := seed(cfg)
+	var r app.Randomizer = app.NewSeededRandomPath(s)
+	if *avoidCongestion {
+		r = app.AvoidCongestion(r)
+	}
+	span.Set("seed", s)
+	span.Set("aliens", cfg.NumberOfAliens)
+	congestion := app.NewCongestion()
+	opts := []app.Option{app.WithPlacement(ps.Strategy(s)), app.WithTermination(tc), app.WithSpan(span), app.WithWatchdog(watchdog()), app.WithEventHandler(congestion.Add)}
+	if *checkInvariants {
+		opts = append(opts, app.WithInvariantChecks())
+	}
+	if cfg.HeadOnCollisions {
+		opts = append(opts, app.WithHeadOnCollisions())
+	}
+	if *eventsPath == "" {
+		opts = append(opts, app.WithoutEventLog())
+	}
+	var ac app.Invasion
+	switch *engine {
+	case "sequential":
+		ac = app.NewSequentialCommander(wm, cfg.NumberOfAliens, r, os.Stdout, cfg.MaxIterations, opts...)
+	case "compact":
+		ac = app.NewCompactCommander(app.NewCompactGraph(wm), cfg.NumberOfAliens, s, *shards, os.Stdout, cfg.MaxIterations, opts...)
+	case "sharded":
+		n := *shards
+		if n <= 0 {
+			n = runtime.NumCPU()
+		}
+		g := app.NewCompactGraph(wm)
+		p := app.PartitionGraph(g, n)
+		log.Printf("The world map is split in %d shards. %d roads cross the borders of the shards.\n", len(p.Sizes), p.Cut)
+		ac = app.NewShardedCommander(g, p, cfg.NumberOfAliens, s, os.Stdout, cfg.MaxIterations, opts...)
+	default:
+		ac = app.NewAlienCommander(wm, cfg.NumberOfAliens, r, os.Stdout, cfg.MaxIterations, opts...)
+	}
+
+	log.Printf("Start the invasion with seed %d!\n", s)
+	if err = ac.StartInvasion(); err != nil {
+		if errors.Is(err, app.ErrDeadlock) || errors.Is(err, app.ErrLivelock) || errors.Is(err, app.ErrInvariant) {
+			return err
+		}
+		return invalidInput(err)
+	}
+	res := ac.Result()
+	fmt.Printf("There is %d soldier left. Stop the invasion!\n", len(res.SurvivingAliens))
+	fmt.Println("Number of iterations: ", res.Iterations)
+	fmt.Printf("The invasion is stopped by the condition %s\n", res.StopReason)
+	if roads := congestion.Roads(); len(roads) > 0 {
+		fmt.Println("The aliens waited for room on the full roads:")
+		for _, w := range roads {
+			fmt.Printf("  %s -> %s: %d waited, %d took the road after %.1f iterations on average and %d at most\n",
+				w.From, w.To, w.Queued, w.Departed, w.Average(), w.Longest)
+		}
+	}
+
+	log.Println("Generate the report")
+	report := ac.GenerateReportForInvasion()
+
+	log.Printf("Store the report in a file %s\n", *reportPath)
+	err = createFile(*reportPath, func(f *os.File) error {
+		_, err := io.WriteString(f, report)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if *eventsPath != "" {
+		log.Printf("Store the event log in a file %s\n", *eventsPath)
+		err = createFile(*eventsPath, func(f *os.File) error {
+			return app.WriteEvents(f, ac.Events())
+		})
+		if err != nil {
+			return err
+		}
+	}
+	log.Println("Finish")
+	return nil
+}
+
+// newTracer creates a tracer that writes the spans to the file or to the standard
+// output if the name is "-". If the name is empty the tracer is nil and records
+// nothing. The returned function closes the file and returns the first error of
+// writing the spans.
+func newTracer(name string) (*trace.Tracer, func() error, error) {
+	switch name {
+	case "":
+		return nil, func() error { return nil }, nil
+	case "-":
+		t := trace.NewTracer(os.Stdout)
+		return t, t.Err, nil
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("os.Create error: %w", err)
+	}
+	t := trace.NewTracer(f)
+	return t, func() error {
+		if err := t.Err(); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/EmilGeorgiev/alvasion/server"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"time"
+)
+
+// runServe serves the HTTP JSON API until the program is interrupted.
+func runServe(args []string) error {
+	fs, o := newFlagSet("serve")
+	addr := fs.String("addr", "localhost:8080", "address the server listens on")
+	maxConcurrent := fs.Int("max-concurrent", runtime.NumCPU(), "maximum number of invasions that run at the same time")
+	maxQueued := fs.Int("max-queued", 100, "maximum number of invasions that wait to run")
+	maxAliens := fs.Int("max-aliens", 100000, "maximum number of aliens of an invasion")
+	iterationLimit := fs.Int("iteration-limit", 1000000000, "maximum number of iterations that an invasion can set")
+	maxFinished := fs.Int("max-finished", 1000, "maximum number of invasions that are over and kept, the oldest are removed first")
+	feedBuffer := fs.Int("feed-buffer", 1024, "number of events buffered for every client of a live feed")
+	mapDir := fs.String("map-dir", "", "directory of the world maps that can be referenced by a path (empty means only uploads)")
+	watchdog := watchdogFlags(fs)
+	if err := o.parse(args); err != nil {
+		return err
+	}
+	cfg, err := o.config()
+	if err != nil {
+		return err
+	}
+
+	s := server.New(server.Options{
+		MaxConcurrent:     *maxConcurrent,
+		MaxQueued:         *maxQueued,
+		MaxFinished:       *maxFinished,
+		MapDir:            *mapDir,
+		ValidationWorkers: cfg.ValidationWorkers,
+		MaxIterations:     cfg.MaxIterations,
+		MaxAliens:         *maxAliens,
+		IterationLimit:    *iterationLimit,
+		FeedBuffer:        *feedBuffer,
+		Watchdog:          watchdog(),
+	})
+	defer s.Close()
+
+	srv := &http.Server{Addr: *addr, Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+
+	log.Printf("Serve the API on http://%s\n", *addr)
+	if err = srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	log.Println("The server is stopped.")
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/EmilGeorgiev/alvasion/tui"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runTUI runs an invasion and animates it in the terminal.
+func runTUI(args []string) error {
+	fs, o := newFlagSet("tui")
+	speed := fs.Float64("speed", 2, "number of iterations shown per second")
+	noColor := fs.Bool("no-color", false, "draw without colors")
+	if err := o.parse(args); err != nil {
+		return err
+	}
+	cfg, err := o.config()
+	if err != nil {
+		return err
+	}
+	ps, err := placement(cfg)
+	if err != nil {
+		return err
+	}
+	tc, err := termination(cfg)
+	if err != nil {
+		return err
+	}
+	wm, err := readWorldMap(cfg)
+	if err != nil {
+		return err
+	}
+
+	s := seed(cfg)
+	opts := []app.Option{app.WithPlacement(ps.Strategy(s)), app.WithTermination(tc)}
+	if cfg.HeadOnCollisions {
+		opts = append(opts, app.WithHeadOnCollisions())
+	}
+	ac := app.NewAlienCommander(wm, cfg.NumberOfAliens, app.NewSeededRandomPath(s), io.Discard, cfg.MaxIterations, opts...)
+	if err = ac.StartInvasion(); err != nil {
+		return invalidInput(err)
+	}
+
+	restore, err := tui.RawMode()
+	if err != nil {
+		log.Println("The terminal can't read single keys, press Enter after every key.")
+	} else {
+		defer restore()
+		// the deferred restore doesn't run when a signal ends the program
+		defer restoreOnSignal(restore)()
+	}
+	return tui.Play(os.Stdin, os.Stdout, tui.NewView(wm, ac.Events()), tui.Options{Speed: *speed, Color: !*noColor})
+}
+
+// restoreOnSignal restores the terminal and exits when the program is interrupted
+// or terminated. The returned function stops waiting for the signals.
+func restoreOnSignal(restore func()) func() {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			restore()
+			code := 1
+			if s, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(s)
+			}
+			os.Exit(code)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
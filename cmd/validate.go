@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"github.com/EmilGeorgiev/alvasion/app"
+	"strings"
+)
+
+// runValidate parses the world map and prints the errors in it. The roads that
+// contradict each other geometrically and the cities that the aliens can't leave,
+// because only one-way roads lead to them, are printed too, but the map is still
+// valid.
+func runValidate(args []string) error {
+	_, o := newFlagSet("validate")
+	if err := o.parse(args); err != nil {
+		return err
+	}
+	cfg, err := o.config()
+	if err != nil {
+		return err
+	}
+
+	wm, err := readWorldMap(cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("The world map %s is valid. It contains %d cities.\n", cfg.WorldMap, len(wm.Cities))
+	if c := app.NewLayout(wm).Contradictions; len(c) > 0 {
+		fmt.Printf("The roads can't be drawn on a grid exactly:\n  %s\n", strings.Join(c, "\n  "))
+	}
+	if traps := wm.Traps(); len(traps) > 0 {
+		names := make([]string, len(traps))
+		for i, id := range traps {
+			names[i] = wm.Cities[id].Name
+		}
+		fmt.Printf("The aliens can't leave the cities with only one-way roads to them:\n  %s\n", strings.Join(names, "\n  "))
+	}
+	return nil
+}
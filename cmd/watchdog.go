@@ -0,0 +1,19 @@
+package main
+
+import (
+	"flag"
+	"github.com/EmilGeorgiev/alvasion/app"
+	"os"
+	"time"
+)
+
+// watchdogFlags defines the flags of the watchdog of the invasions. The returned
+// function returns the watchdog after the flags are parsed. The diagnostics are
+// written to the standard error.
+func watchdogFlags(fs *flag.FlagSet) func() app.Watchdog {
+	ticks := fs.Int("watchdog-ticks", 100, "stop an invasion when no alien moves and no city is destroyed in this many iterations in a row although the aliens can move (0 disables it)")
+	timeout := fs.Duration("watchdog-timeout", 10*time.Second, "stop an invasion when a city doesn't reply to a command in this time (0 disables it)")
+	return func() app.Watchdog {
+		return app.Watchdog{Ticks: *ticks, Timeout: *timeout, Diagnostics: os.Stderr}
+	}
+}
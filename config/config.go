@@ -0,0 +1,235 @@
+// Package config loads the configuration of the invasion. The value of every
+// setting is resolved in this order, each step overriding the previous one:
+// the default value, the YAML config file, the ALVASION_* environment variables
+// and finally the command line flags.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of the settings.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// EnvPrefix is the prefix of the environment variables that override the settings.
+// The name of the variable is the prefix followed by the upper-cased YAML key, for
+// example ALVASION_NUMBER_OF_ALIENS.
+const EnvPrefix = "ALVASION_"
+
+// maxValidationWorkers is the maximum number of workers that validate the lines of the world map.
+const maxValidationWorkers = 1024
+
+// Config contains the settings of the invasion.
+type Config struct {
+	WorldMap          string `yaml:"world_map"`
+	ValidationWorkers int    `yaml:"validation_workers"`
+	NumberOfAliens    int    `yaml:"number_of_aliens"`
+	MaxIterations     int    `yaml:"max_iterations"`
+	// Seed of the invasion. If it is zero a seed is generated when the invasion starts.
+	Seed int64 `yaml:"seed"`
+	// Placement is the strategy that places the aliens, for example "uniform" or
+	// "region:X5". See app.ParsePlacementSpec for all strategies.
+	Placement string `yaml:"placement"`
+	// MultipleAliensPerCity allows the placement to put more than one alien in a city.
+	MultipleAliensPerCity bool `yaml:"multiple_aliens_per_city"`
+	// Termination is the condition that ends the invasion, for example
+	// "aliens<=1 or iterations>=500". If it is empty the invasion stops when there is
+	// zero or one alien left, none of the aliens can move or after max_iterations.
+	// See app.ParseTermination for all conditions.
+	Termination string `yaml:"termination"`
+	// HeadOnCollisions makes the aliens that leave the cities on both ends of a road
+	// in the same iteration fight on it and destroy the road.
+	HeadOnCollisions bool `yaml:"head_on_collisions"`
+
+	sources map[string]string
+}
+
+// Keys are the YAML keys of all settings in the order they are printed.
+var Keys = []string{"world_map", "validation_workers", "number_of_aliens", "max_iterations", "seed", "placement", "multiple_aliens_per_city", "termination", "head_on_collisions"}
+
+// Default returns the config with the default values of all settings.
+func Default() Config {
+	c := Config{
+		WorldMap:          "world-map.txt",
+		ValidationWorkers: 5,
+		NumberOfAliens:    6,
+		MaxIterations:     10000,
+		Placement:         "sequential",
+		sources:           map[string]string{},
+	}
+	for _, k := range Keys {
+		c.sources[k] = SourceDefault
+	}
+	return c
+}
+
+// Load resolves the config: it starts from the default values, applies the YAML file
+// and then the environment variables found with lookupEnv (usually os.LookupEnv).
+// If path is empty no file is read. A relative world map path in the file is
+// relative to the directory of the file. Load doesn't validate the config, so more
+// values can be set before Validate is called.
+func Load(path string, lookupEnv func(key string) (string, bool)) (Config, error) {
+	c := Default()
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, k := range Keys {
+		env := EnvPrefix + strings.ToUpper(k)
+		v, ok := lookupEnv(env)
+		if !ok {
+			continue
+		}
+		if err := c.Set(k, v, SourceEnv); err != nil {
+			return Config{}, fmt.Errorf("environment variable %s: %w", env, err)
+		}
+	}
+	return c, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading YAML file: %w", err)
+	}
+
+	var values map[string]yaml.Node
+	if err = yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("unable to unmarshal data from %s: %w", path, err)
+	}
+	for k, node := range values {
+		if !isKey(k) {
+			return fmt.Errorf("%s: unknown setting %q", path, k)
+		}
+		if err = c.Set(k, node.Value, SourceFile); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if _, ok := values["world_map"]; ok && c.WorldMap != "" && !filepath.IsAbs(c.WorldMap) {
+		c.WorldMap = filepath.Join(filepath.Dir(path), c.WorldMap)
+	}
+	return nil
+}
+
+// Set parses the value of the setting with the YAML key and records where the value comes from.
+func (c *Config) Set(key, value, source string) error {
+	var err error
+	switch key {
+	case "world_map":
+		c.WorldMap = value
+	case "validation_workers":
+		c.ValidationWorkers, err = strconv.Atoi(value)
+	case "number_of_aliens":
+		c.NumberOfAliens, err = strconv.Atoi(value)
+	case "max_iterations":
+		c.MaxIterations, err = strconv.Atoi(value)
+	case "seed":
+		c.Seed, err = strconv.ParseInt(value, 10, 64)
+	case "placement":
+		c.Placement = value
+	case "termination":
+		c.Termination = value
+	case "multiple_aliens_per_city":
+		if c.MultipleAliensPerCity, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", key, value)
+		}
+	case "head_on_collisions":
+		if c.HeadOnCollisions, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", key, value)
+		}
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s must be an integer, got %q", key, value)
+	}
+
+	if c.sources == nil {
+		c.sources = map[string]string{}
+	}
+	c.sources[key] = source
+	return nil
+}
+
+// Source returns where the value of the setting with the YAML key comes from.
+func (c Config) Source(key string) string {
+	if s, ok := c.sources[key]; ok {
+		return s
+	}
+	return SourceDefault
+}
+
+// Validate checks that all settings are in their valid ranges. It returns an error
+// that describes all wrong settings.
+func (c Config) Validate() error {
+	var problems []string
+	if c.WorldMap == "" {
+		problems = append(problems, "world_map must not be empty")
+	}
+	if c.ValidationWorkers < 1 || c.ValidationWorkers > maxValidationWorkers {
+		problems = append(problems, fmt.Sprintf("validation_workers must be between 1 and %d, got %d", maxValidationWorkers, c.ValidationWorkers))
+	}
+	if c.NumberOfAliens < 1 {
+		problems = append(problems, fmt.Sprintf("number_of_aliens must be positive, got %d", c.NumberOfAliens))
+	}
+	if c.MaxIterations < 1 {
+		problems = append(problems, fmt.Sprintf("max_iterations must be positive, got %d", c.MaxIterations))
+	}
+	if c.Seed < 0 {
+		problems = append(problems, fmt.Sprintf("seed must not be negative, got %d", c.Seed))
+	}
+	if c.Placement == "" {
+		problems = append(problems, "placement must not be empty")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Print writes the effective settings in YAML with the source of every value as a comment.
+func (c Config) Print(w io.Writer) error {
+	values := map[string]string{
+		"world_map":                strconv.Quote(c.WorldMap),
+		"validation_workers":       strconv.Itoa(c.ValidationWorkers),
+		"number_of_aliens":         strconv.Itoa(c.NumberOfAliens),
+		"max_iterations":           strconv.Itoa(c.MaxIterations),
+		"seed":                     strconv.FormatInt(c.Seed, 10),
+		"placement":                strconv.Quote(c.Placement),
+		"multiple_aliens_per_city": strconv.FormatBool(c.MultipleAliensPerCity),
+		"termination":              strconv.Quote(c.Termination),
+		"head_on_collisions":       strconv.FormatBool(c.HeadOnCollisions),
+	}
+	for _, k := range Keys {
+		if _, err := fmt.Fprintf(w, "%s: %s # %s\n", k, values[k], c.Source(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isKey(key string) bool {
+	for _, k := range Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package config_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadWithoutFileAndEnvironment(t *testing.T) {
+	// ACTION
+	actual, err := config.Load("", noEnv)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, config.Default(), actual)
+	assert.NoError(t, actual.Validate())
+}
+
+func TestLoadFromFile(t *testing.T) {
+	// SETUP
+	dir := t.TempDir()
+	path := createConfigFile(t, dir, "world_map: maps/world.txt\nvalidation_workers: 2\nnumber_of_aliens: 10\n")
+
+	// ACTION
+	actual, err := config.Load(path, noEnv)
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "maps/world.txt"), actual.WorldMap)
+	assert.Equal(t, 2, actual.ValidationWorkers)
+	assert.Equal(t, 10, actual.NumberOfAliens)
+	assert.Equal(t, 10000, actual.MaxIterations)
+	assert.Equal(t, config.SourceFile, actual.Source("number_of_aliens"))
+	assert.Equal(t, config.SourceDefault, actual.Source("max_iterations"))
+}
+
+func TestLoadEnvironmentOverridesFile(t *testing.T) {
+	// SETUP
+	path := createConfigFile(t, t.TempDir(), "number_of_aliens: 10\nseed: 5\n")
+	env := map[string]string{"ALVASION_NUMBER_OF_ALIENS": "3", "ALVASION_WORLD_MAP": "/tmp/map.txt"}
+
+	// ACTION
+	actual, err := config.Load(path, func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	})
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, 3, actual.NumberOfAliens)
+	assert.Equal(t, "/tmp/map.txt", actual.WorldMap)
+	assert.Equal(t, int64(5), actual.Seed)
+	assert.Equal(t, config.SourceEnv, actual.Source("number_of_aliens"))
+	assert.Equal(t, config.SourceFile, actual.Source("seed"))
+}
+
+func TestLoadWithWrongValues(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  string
+		env      map[string]string
+		expected string
+	}{
+		{name: "not an integer in the file", content: "number_of_aliens: many\n", expected: "number_of_aliens must be an integer, got \"many\""},
+		{name: "unknown setting", content: "aliens: 3\n", expected: "unknown setting \"aliens\""},
+		{name: "not a YAML file", content: "number_of_aliens: 3\nfoo\n", expected: "unable to unmarshal data"},
+		{name: "not a boolean in the file", content: "multiple_aliens_per_city: maybe\n", expected: "multiple_aliens_per_city must be true or false, got \"maybe\""},
+		{name: "not a boolean in the file for the collisions", content: "head_on_collisions: often\n", expected: "head_on_collisions must be true or false, got \"often\""},
+		{
+			name:     "not an integer in the environment",
+			env:      map[string]string{"ALVASION_MAX_ITERATIONS": "1e3"},
+			expected: "environment variable ALVASION_MAX_ITERATIONS: max_iterations must be an integer, got \"1e3\"",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// SETUP
+			path := createConfigFile(t, t.TempDir(), c.content)
+
+			// ACTION
+			_, err := config.Load(path, func(key string) (string, bool) {
+				v, ok := c.env[key]
+				return v, ok
+			})
+
+			// ASSERTIONS
+			assert.ErrorContains(t, err, c.expected)
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	// ACTION
+	_, err := config.Load(filepath.Join(t.TempDir(), "missing.yaml"), noEnv)
+
+	// ASSERTIONS
+	assert.ErrorContains(t, err, "error reading YAML file")
+}
+
+func TestValidate(t *testing.T) {
+	// SETUP
+	c := config.Default()
+	c.WorldMap = ""
+	c.ValidationWorkers = 0
+	c.NumberOfAliens = -1
+	c.MaxIterations = 0
+	c.Seed = -3
+	c.Placement = ""
+
+	// ACTION
+	err := c.Validate()
+
+	// ASSERTIONS
+	expected := "invalid config: world_map must not be empty; " +
+		"validation_workers must be between 1 and 1024, got 0; " +
+		"number_of_aliens must be positive, got -1; " +
+		"max_iterations must be positive, got 0; " +
+		"seed must not be negative, got -3; " +
+		"placement must not be empty"
+	assert.EqualError(t, err, expected)
+}
+
+func TestPrint(t *testing.T) {
+	// SETUP
+	c := config.Default()
+	err := c.Set("number_of_aliens", "4", config.SourceFlag)
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	printErr := c.Print(buf)
+
+	// ASSERTIONS
+	expected := "" +
+		"world_map: \"world-map.txt\" # default\n" +
+		"validation_workers: 5 # default\n" +
+		"number_of_aliens: 4 # flag\n" +
+		"max_iterations: 10000 # default\n" +
+		"seed: 0 # default\n" +
+		"placement: \"sequential\" # default\n" +
+		"multiple_aliens_per_city: false # default\n" +
+		"termination: \"\" # default\n" +
+		"head_on_collisions: false # default\n"
+	assert.NoError(t, err)
+	assert.NoError(t, printErr)
+	assert.Equal(t, expected, buf.String())
+}
+
+func noEnv(string) (string, bool) {
+	return "", false
+}
+
+func createConfigFile(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to create config file: %s", err)
+	}
+	return path
+}
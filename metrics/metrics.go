@@ -0,0 +1,257 @@
+// Package metrics keeps counters and gauges of a running process and writes them
+// in the text format of Prometheus, so long simulations can be observed while they
+// run. All metrics are safe for concurrent use.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a number that only grows.
+type Counter struct {
+	v atomic.Int64
+}
+
+// Add adds n to the counter.
+func (c *Counter) Add(n int64) {
+	c.v.Add(n)
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() int64 {
+	return c.v.Load()
+}
+
+// Gauge is a number that goes up and down.
+type Gauge struct {
+	v atomic.Int64
+}
+
+// Add adds n to the gauge. n can be negative.
+func (g *Gauge) Add(n int64) {
+	g.v.Add(n)
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v int64) {
+	g.v.Store(v)
+}
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() int64 {
+	return g.v.Load()
+}
+
+// meterWindow is the number of complete seconds the rate of a meter is averaged over.
+const meterWindow = 10
+
+// Meter counts events and measures how many of them happen per second on average
+// over the last complete seconds.
+type Meter struct {
+	total Counter
+
+	mu sync.Mutex
+	// counts contains the number of events of the second in seconds at the same index.
+	counts  [meterWindow + 1]int64
+	seconds [meterWindow + 1]int64
+	now     func() time.Time
+}
+
+// NewMeter creates a meter. now is the clock of the meter, time.Now if it is nil.
+func NewMeter(now func() time.Time) *Meter {
+	if now == nil {
+		now = time.Now
+	}
+	return &Meter{now: now}
+}
+
+// Mark records n events.
+func (m *Meter) Mark(n int64) {
+	m.total.Add(n)
+	sec := m.now().Unix()
+	i := sec % int64(len(m.counts))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seconds[i] != sec {
+		m.seconds[i] = sec
+		m.counts[i] = 0
+	}
+	m.counts[i] += n
+}
+
+// Total returns the number of all events.
+func (m *Meter) Total() int64 {
+	return m.total.Value()
+}
+
+// Rate returns the number of events per second in the last complete seconds. The
+// current second is not complete, so it is not counted.
+func (m *Meter) Rate() float64 {
+	now := m.now().Unix()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sum int64
+	for i, sec := range m.seconds {
+		if sec < now && sec >= now-meterWindow {
+			sum += m.counts[i]
+		}
+	}
+	return float64(sum) / meterWindow
+}
+
+// Sample is one value of a metric with a label.
+type Sample struct {
+	Label string
+	Value float64
+}
+
+type metric struct {
+	name, help, kind string
+	// label is the name of the label of the samples, empty if the metric has no label.
+	label   string
+	samples func() []Sample
+}
+
+// Registry contains the metrics of a process.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[m.name]; ok {
+		panic(fmt.Sprintf("metrics: the metric %s is already registered", m.name))
+	}
+	r.metrics[m.name] = m
+}
+
+func single(f func() float64) func() []Sample {
+	return func() []Sample {
+		return []Sample{{Value: f()}}
+	}
+}
+
+// Counter registers a new counter with the name.
+func (r *Registry) Counter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(metric{name: name, help: help, kind: "counter", samples: single(func() float64 {
+		return float64(c.Value())
+	})})
+	return c
+}
+
+// Gauge registers a new gauge with the name.
+func (r *Registry) Gauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(metric{name: name, help: help, kind: "gauge", samples: single(func() float64 {
+		return float64(g.Value())
+	})})
+	return g
+}
+
+// GaugeFunc registers a gauge whose value is returned by f when the metrics are written.
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	r.register(metric{name: name, help: help, kind: "gauge", samples: single(f)})
+}
+
+// GaugeVecFunc registers a gauge with one label. f returns a sample for every value
+// of the label when the metrics are written.
+func (r *Registry) GaugeVecFunc(name, help, label string, f func() []Sample) {
+	r.register(metric{name: name, help: help, kind: "gauge", label: label, samples: f})
+}
+
+// Meter registers a new meter as two metrics: the counter name_total and the gauge
+// name_per_second.
+func (r *Registry) Meter(name, help string) *Meter {
+	m := NewMeter(nil)
+	r.register(metric{name: name + "_total", help: help + ".", kind: "counter", samples: single(func() float64 {
+		return float64(m.Total())
+	})})
+	r.register(metric{name: name + "_per_second", help: help + " per second in the last " + strconv.Itoa(meterWindow) + " seconds.", kind: "gauge", samples: single(m.Rate)})
+	return m
+}
+
+// WriteText writes the metrics sorted by name in the text format of Prometheus.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.mu.Unlock()
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name < metrics[j].name
+	})
+
+	var sb strings.Builder
+	for _, m := range metrics {
+		sb.WriteString(fmt.Sprintf("# HELP %s %s\n", m.name, escape(m.help, false)))
+		sb.WriteString(fmt.Sprintf("# TYPE %s %s\n", m.name, m.kind))
+		samples := m.samples()
+		sort.Slice(samples, func(i, j int) bool {
+			return samples[i].Label < samples[j].Label
+		})
+		for _, s := range samples {
+			if m.label == "" {
+				sb.WriteString(fmt.Sprintf("%s %s\n", m.name, formatValue(s.Value)))
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("%s{%s=\"%s\"} %s\n", m.name, m.label, escape(s.Label, true), formatValue(s.Value)))
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// ServeHTTP writes the metrics, so the registry can be scraped by Prometheus.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WriteText(w)
+}
+
+func escape(s string, quoted bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quoted {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,103 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/EmilGeorgiev/alvasion/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteText(t *testing.T) {
+	// SETUP
+	r := metrics.NewRegistry()
+	c := r.Counter("b_total", "Number of b.")
+	g := r.Gauge("a", "Current a.")
+	r.GaugeFunc("c", "Half.", func() float64 { return 0.5 })
+	r.GaugeVecFunc("d", "By city.", "city", func() []metrics.Sample {
+		return []metrics.Sample{{Label: "X2", Value: 2}, {Label: `X"1`, Value: 1}}
+	})
+	c.Add(3)
+	c.Inc()
+	g.Set(7)
+	g.Add(-2)
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := r.WriteText(buf)
+
+	// ASSERTIONS
+	expected := "# HELP a Current a.\n" +
+		"# TYPE a gauge\n" +
+		"a 5\n" +
+		"# HELP b_total Number of b.\n" +
+		"# TYPE b_total counter\n" +
+		"b_total 4\n" +
+		"# HELP c Half.\n" +
+		"# TYPE c gauge\n" +
+		"c 0.5\n" +
+		"# HELP d By city.\n" +
+		"# TYPE d gauge\n" +
+		"d{city=\"X\\\"1\"} 1\n" +
+		"d{city=\"X2\"} 2\n"
+	assert.NoError(t, err)
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestRegisterTheSameNameTwice(t *testing.T) {
+	// SETUP
+	r := metrics.NewRegistry()
+	r.Counter("a_total", "a")
+
+	// ACTION & ASSERTION
+	assert.PanicsWithValue(t, "metrics: the metric a_total is already registered", func() {
+		r.Gauge("a_total", "a")
+	})
+}
+
+func TestMeterRate(t *testing.T) {
+	// SETUP
+	now := time.Unix(1000, 0)
+	m := metrics.NewMeter(func() time.Time { return now })
+
+	// ACTION
+	m.Mark(5)
+	now = now.Add(500 * time.Millisecond)
+	m.Mark(15)
+	current := m.Rate()
+	now = now.Add(time.Second)
+	m.Mark(10)
+	afterOneSecond := m.Rate()
+	now = now.Add(10 * time.Second)
+	afterElevenSeconds := m.Rate()
+
+	// ASSERTIONS
+	// the current second is not complete, so it is not counted
+	assert.Equal(t, 0.0, current)
+	assert.Equal(t, 2.0, afterOneSecond)
+	// the first second is out of the window
+	assert.Equal(t, 1.0, afterElevenSeconds)
+	assert.Equal(t, int64(30), m.Total())
+}
+
+func TestServeHTTP(t *testing.T) {
+	// SETUP
+	r := metrics.NewRegistry()
+	r.Meter("moves", "Number of moves").Mark(2)
+
+	// ACTION
+	get := httptest.NewRecorder()
+	r.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	post := httptest.NewRecorder()
+	r.ServeHTTP(post, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+
+	// ASSERTIONS
+	assert.Equal(t, http.StatusOK, get.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", get.Header().Get("Content-Type"))
+	assert.Contains(t, get.Body.String(), "# TYPE moves_total counter\nmoves_total 2\n")
+	assert.Contains(t, get.Body.String(), "# HELP moves_per_second Number of moves per second in the last 10 seconds.\n# TYPE moves_per_second gauge\n")
+	assert.Equal(t, http.StatusMethodNotAllowed, post.Code)
+}
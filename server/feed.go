@@ -0,0 +1,213 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+)
+
+// feed records the events of one invasion in its event log and passes them to
+// its subscribers while the invasion runs. Publishing never blocks: the commander calls it between the commands to
+// the cities, so a slow subscriber would stall the whole invasion. If the buffer
+// of a subscriber is full the event is dropped for it and counted instead.
+type feed struct {
+	buffer int
+
+	mu sync.Mutex
+	// events is the event log of the invasion. It is written only by publish.
+	events      *[]app.Event
+	subscribers map[*subscriber]struct{}
+	closed      bool
+}
+
+type subscriber struct {
+	items chan feedItem
+	// dropped is the number of events dropped since the last item that was sent.
+	// It is guarded by the lock of the feed.
+	dropped int
+}
+
+// feedItem is an event with the number of events that were dropped just before it.
+type feedItem struct {
+	event   app.Event
+	dropped int
+}
+
+// newFeed creates a feed that appends the published events to the event log.
+func newFeed(buffer int, events *[]app.Event) *feed {
+	return &feed{buffer: buffer, events: events, subscribers: map[*subscriber]struct{}{}}
+}
+
+// publish appends the event to the event log and sends it to the subscribers without blocking.
+func (f *feed) publish(e app.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	*f.events = append(*f.events, e)
+	for sub := range f.subscribers {
+		select {
+		case sub.items <- feedItem{event: e, dropped: sub.dropped}:
+			sub.dropped = 0
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// subscribe returns the events of the event log starting from the index and a
+// subscriber that receives the next events. An index beyond the event log is
+// clamped to its length, so the returned start is the index of the first returned
+// event. If the feed is closed, the subscriber is nil, because there are no more events.
+func (f *feed) subscribe(from int) (int, []app.Event, *subscriber) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	events := *f.events
+	if from > len(events) {
+		from = len(events)
+	}
+	past := append([]app.Event(nil), events[from:]...)
+	if f.closed {
+		return from, past, nil
+	}
+	sub := &subscriber{items: make(chan feedItem, f.buffer)}
+	f.subscribers[sub] = struct{}{}
+	return from, past, sub
+}
+
+func (f *feed) unsubscribe(sub *subscriber) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subscribers[sub]; ok {
+		delete(f.subscribers, sub)
+		close(sub.items)
+	}
+}
+
+// droppedAtEnd returns the number of events dropped after the last item sent to the subscriber.
+func (f *feed) droppedAtEnd(sub *subscriber) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return sub.dropped
+}
+
+// close tells the subscribers that there are no more events.
+func (f *feed) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for sub := range f.subscribers {
+		delete(f.subscribers, sub)
+		close(sub.items)
+	}
+}
+
+// getFeed streams the events of the invasion as Server-Sent Events. Every event
+// has the type of the invasion event and its number in the event log as ID, so a
+// client can continue after a reconnect with the header Last-Event-ID or start
+// from any event with the query parameter from. A start beyond the events so far
+// waits for the next event. If the client is too slow some events are dropped and
+// a "dropped" event tells how many. The stream ends with an "end" event that
+// contains the status of the invasion.
+func (s *Server) getFeed(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	from, err := feedStart(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	inv, ok := s.invasion(w, id)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	n, past, sub := inv.feed.subscribe(from)
+	if sub != nil {
+		defer inv.feed.unsubscribe(sub)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range past {
+		n++
+		if err = writeEvent(w, strconv.Itoa(n), string(e.Type), e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	if sub != nil {
+	STREAM:
+		for {
+			select {
+			case item, open := <-sub.items:
+				dropped := item.dropped
+				if !open {
+					dropped = inv.feed.droppedAtEnd(sub)
+				}
+				if dropped > 0 {
+					n += dropped
+					if err = writeEvent(w, "", "dropped", map[string]int{"events": dropped}); err != nil {
+						return
+					}
+				}
+				if !open {
+					break STREAM
+				}
+				n++
+				if err = writeEvent(w, strconv.Itoa(n), string(item.event.Type), item.event); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+
+	s.mu.Lock()
+	st := inv.snapshot()
+	s.mu.Unlock()
+	_ = writeEvent(w, "", "end", st)
+	flusher.Flush()
+}
+
+func feedStart(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("from")
+	if v == "" {
+		v = r.Header.Get("Last-Event-ID")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	from, err := strconv.Atoi(v)
+	if err != nil || from < 0 {
+		return 0, fmt.Errorf("the start of the feed must be a non-negative event number, got %q", v)
+	}
+	return from, nil
+}
+
+func writeEvent(w http.ResponseWriter, id, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err = fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -0,0 +1,184 @@
+package server_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/EmilGeorgiev/alvasion/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedStreamsAllEventsOfTheInvasion(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{FeedBuffer: 100000})
+	do(t, ts, http.MethodPost, "/maps", "text/plain", worldMap, nil)
+	var started server.InvasionStatus
+	do(t, ts, http.MethodPost, "/invasions", "application/json", `{"map_id":"map-1","aliens":4,"seed":3,"max_iterations":200}`, &started)
+
+	// ACTION
+	sse := readFeed(t, ts, "/invasions/"+started.ID+"/feed")
+	eventLog, err := app.ReadEvents(strings.NewReader(get(t, ts, "/invasions/"+started.ID+"/events")))
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	var events []app.Event
+	for i, e := range sse[:len(sse)-1] {
+		assert.Equal(t, strconv.Itoa(i+1), e.id)
+		var ev app.Event
+		assert.NoError(t, json.Unmarshal([]byte(e.data), &ev))
+		assert.Equal(t, string(ev.Type), e.event)
+		events = append(events, ev)
+	}
+	assert.Equal(t, eventLog, events)
+
+	end := sse[len(sse)-1]
+	var st server.InvasionStatus
+	assert.Equal(t, "end", end.event)
+	assert.NoError(t, json.Unmarshal([]byte(end.data), &st))
+	assert.Equal(t, server.StatusFinished, st.Status)
+}
+
+func TestFeedOfAFinishedInvasionStartsFromTheEvent(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{})
+	do(t, ts, http.MethodPost, "/maps", "text/plain", worldMap, nil)
+	var started server.InvasionStatus
+	do(t, ts, http.MethodPost, "/invasions", "application/json", `{"map_id":"map-1","aliens":4,"seed":3,"max_iterations":200}`, &started)
+	waitUntilOver(t, ts, started.ID)
+	eventLog, _ := app.ReadEvents(strings.NewReader(get(t, ts, "/invasions/"+started.ID+"/events")))
+
+	// ACTION
+	sse := readFeed(t, ts, "/invasions/"+started.ID+"/feed?from=5")
+
+	// ASSERTIONS
+	assert.Len(t, sse, len(eventLog)-5+1)
+	assert.Equal(t, "6", sse[0].id)
+	assert.Equal(t, "end", sse[len(sse)-1].event)
+}
+
+func TestFeedStartingBeyondTheEventsContinuesWithTheNextEvent(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{FeedBuffer: 1000000})
+	do(t, ts, http.MethodPost, "/maps", "text/plain", worldMap, nil)
+	// the invasion never stops by itself, because the city doesn't exist
+	req := `{"map_id":"map-1","aliens":2,"seed":1,"max_iterations":20000,"termination":"city_destroyed=Foo"}`
+	var started server.InvasionStatus
+	do(t, ts, http.MethodPost, "/invasions", "application/json", req, &started)
+
+	// ACTION
+	sse := readFeed(t, ts, "/invasions/"+started.ID+"/feed?from=1000000000")
+	eventLog, _ := app.ReadEvents(strings.NewReader(get(t, ts, "/invasions/"+started.ID+"/events")))
+
+	// ASSERTIONS
+	assert.Equal(t, "end", sse[len(sse)-1].event)
+	events := sse[:len(sse)-1]
+	if !assert.NotEmpty(t, events, "the invasion is over before the client subscribes") {
+		return
+	}
+	first, err := strconv.Atoi(events[0].id)
+	assert.NoError(t, err)
+	for i, e := range events {
+		assert.Equal(t, strconv.Itoa(first+i), e.id)
+	}
+	assert.Equal(t, strconv.Itoa(len(eventLog)), events[len(events)-1].id)
+}
+
+func TestSlowFeedClientDoesNotStallTheInvasion(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{FeedBuffer: 1})
+	do(t, ts, http.MethodPost, "/maps", "text/plain", worldMap, nil)
+	// the invasion never stops by itself, because the city doesn't exist
+	req := `{"map_id":"map-1","aliens":2,"seed":1,"max_iterations":20000,"termination":"city_destroyed=Foo"}`
+	var started server.InvasionStatus
+	do(t, ts, http.MethodPost, "/invasions", "application/json", req, &started)
+	resp, err := ts.Client().Get(ts.URL + "/invasions/" + started.ID + "/feed")
+	if err != nil {
+		t.Fatalf("failed to subscribe to the feed: %s", err)
+	}
+	defer resp.Body.Close()
+
+	// ACTION
+	// the client doesn't read the feed until the invasion is over
+	finished := waitUntilOver(t, ts, started.ID)
+	sse := parseFeed(t, resp.Body)
+	eventLog, _ := app.ReadEvents(strings.NewReader(get(t, ts, "/invasions/"+started.ID+"/events")))
+
+	// ASSERTIONS
+	assert.Equal(t, server.StatusFinished, finished.Status)
+	assert.Equal(t, int64(20000), finished.Iterations)
+	var received, dropped int
+	for _, e := range sse {
+		switch e.event {
+		case "dropped":
+			var d map[string]int
+			assert.NoError(t, json.Unmarshal([]byte(e.data), &d))
+			dropped += d["events"]
+		case "end":
+		default:
+			received++
+		}
+	}
+	assert.Equal(t, len(eventLog), received+dropped)
+	assert.Equal(t, "end", sse[len(sse)-1].event)
+}
+
+func TestFeedWithWrongStart(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{})
+
+	// ACTION
+	var body map[string]string
+	code := do(t, ts, http.MethodGet, "/invasions/invasion-1/feed?from=-1", "", "", &body)
+
+	// ASSERTIONS
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "the start of the feed must be a non-negative event number, got \"-1\"", body["error"])
+}
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+func readFeed(t *testing.T, ts *httptest.Server, path string) []sseEvent {
+	resp, err := ts.Client().Get(ts.URL + path)
+	if err != nil {
+		t.Fatalf("failed to subscribe to the feed: %s", err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	return parseFeed(t, resp.Body)
+}
+
+// parseFeed reads Server-Sent Events until the end of the stream.
+func parseFeed(t *testing.T, r io.Reader) []sseEvent {
+	var events []sseEvent
+	var e sseEvent
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			events = append(events, e)
+			e = sseEvent{}
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("failed to read the feed: %s", err)
+	}
+	return events
+}
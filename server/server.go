@@ -0,0 +1,720 @@
+// Package server exposes the invasions over a local HTTP JSON API. World maps are
+// uploaded or referenced by a path, invasions are started with parameters, run in
+// the background with bounded concurrency and are tracked by their ID:
+//
+//	POST   /maps                     upload a world map (text or JSON), returns its ID
+//	GET    /maps/{id}                the world map as JSON
+//	DELETE /maps/{id}                delete the world map
+//	POST   /invasions                start an invasion, returns its status
+//	GET    /invasions                the status of all invasions
+//	GET    /invasions/{id}           the status of the invasion
+//	DELETE /invasions/{id}           delete the invasion that is over
+//	POST   /invasions/{id}/cancel    cancel the invasion
+//	GET    /invasions/{id}/report    the report of the finished invasion
+//	GET    /invasions/{id}/events    the event log of the finished invasion (JSON lines)
+//	GET    /invasions/{id}/feed      the live events of the invasion (Server-Sent Events)
+//	GET    /metrics                  the metrics of the invasions (Prometheus text format)
+//
+// The invasions that are over are kept until they are deleted or until there are
+// more than Options.MaxFinished of them, then the oldest are removed.
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/EmilGeorgiev/alvasion/metrics"
+)
+
+// Statuses of an invasion.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusFinished  = "finished"
+	StatusCancelled = "cancelled"
+	StatusFailed    = "failed"
+)
+
+// maxUploadBytes is the maximum size of an uploaded world map.
+const maxUploadBytes = 64 << 20
+
+// Options configures the server.
+type Options struct {
+	// MaxConcurrent is the maximum number of invasions that run at the same time.
+	MaxConcurrent int
+	// MaxQueued is the maximum number of invasions that wait to run. More invasions are rejected.
+	MaxQueued int
+	// MaxFinished is the maximum number of invasions that are over and kept with
+	// their report and event log. If there are more the oldest are removed.
+	MaxFinished int
+	// MapDir is the directory of the world maps that can be referenced by a path.
+	// If it is empty the world maps can only be uploaded.
+	MapDir string
+	// ValidationWorkers is the number of workers that validate the lines of an uploaded world map.
+	ValidationWorkers int
+	// MaxIterations is the maximum number of iterations of an invasion that doesn't set it.
+	MaxIterations int
+	// MaxAliens is the maximum number of aliens of an invasion. Every alien runs in
+	// its own goroutine, so a request can't start an unlimited number of them.
+	MaxAliens int
+	// IterationLimit is the maximum number of iterations that an invasion can set.
+	IterationLimit int
+	// FeedBuffer is the number of events buffered for every subscriber of a live
+	// feed. If a subscriber is slower, the events that don't fit are dropped for it.
+	FeedBuffer int
+	// Metrics is the registry of the metrics served on /metrics. If it is nil a new
+	// registry is used. The metrics of the invasions are registered in it.
+	Metrics *metrics.Registry
+	// Watchdog fails the invasions that don't make progress instead of letting
+	// them occupy a slot forever. The zero value checks nothing.
+	Watchdog app.Watchdog
+}
+
+// InvasionRequest contains the parameters of an invasion. Exactly one of MapID
+// and MapPath must be set.
+type InvasionRequest struct {
+	// MapID is the ID of an uploaded world map.
+	MapID string `json:"map_id,omitempty"`
+	// MapPath is the path of a world map relative to the map directory of the server.
+	MapPath               string `json:"map_path,omitempty"`
+	Aliens                int    `json:"aliens"`
+	MaxIterations         int    `json:"max_iterations,omitempty"`
+	Seed                  int64  `json:"seed,omitempty"`
+	Placement             string `json:"placement,omitempty"`
+	MultipleAliensPerCity bool   `json:"multiple_aliens_per_city,omitempty"`
+	Termination           string `json:"termination,omitempty"`
+	HeadOnCollisions      bool   `json:"head_on_collisions,omitempty"`
+}
+
+// InvasionStatus describes an invasion.
+type InvasionStatus struct {
+	ID      string          `json:"id"`
+	Status  string          `json:"status"`
+	Request InvasionRequest `json:"request"`
+	// Seed is the seed that is used, also if the request doesn't set it.
+	Seed            int64      `json:"seed"`
+	Iterations      int64      `json:"iterations"`
+	DestroyedCities []string   `json:"destroyed_cities,omitempty"`
+	SurvivingAliens []int      `json:"surviving_aliens,omitempty"`
+	StopReason      string     `json:"stop_reason,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	Created         time.Time  `json:"created"`
+	Started         *time.Time `json:"started,omitempty"`
+	Finished        *time.Time `json:"finished,omitempty"`
+}
+
+// MapInfo describes an uploaded world map.
+type MapInfo struct {
+	ID     string `json:"id"`
+	Cities int    `json:"cities"`
+}
+
+// Server serves the HTTP API. It must be closed with Close.
+type Server struct {
+	opts    Options
+	slots   chan struct{}
+	metrics *app.Metrics
+
+	mu        sync.Mutex
+	maps      map[string]*app.WorldMap
+	invasions map[string]*invasion
+	queued    int
+	finished  int
+	nextMap   int
+	nextRun   int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type invasion struct {
+	seq        int
+	status     InvasionStatus
+	iterations atomic.Int64
+	cancel     context.CancelFunc
+	report     string
+	// events is the event log. The feed appends to it while the invasion runs and
+	// it is read without the lock of the feed only after the invasion is over.
+	events []app.Event
+	feed   *feed
+}
+
+// New creates a server. The zero values of the options are replaced with one
+// invasion at a time, 100 queued invasions, 1000 finished invasions, 5 validation
+// workers, 10000 iterations, a feed buffer of 1024 events and a new metrics registry.
+func New(opts Options) *Server {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 1
+	}
+	if opts.MaxQueued <= 0 {
+		opts.MaxQueued = 100
+	}
+	if opts.MaxFinished <= 0 {
+		opts.MaxFinished = 1000
+	}
+	if opts.ValidationWorkers <= 0 {
+		opts.ValidationWorkers = 5
+	}
+	if opts.MaxIterations <= 0 {
+		opts.MaxIterations = 10000
+	}
+	if opts.MaxAliens <= 0 {
+		opts.MaxAliens = 100000
+	}
+	if opts.IterationLimit <= 0 {
+		opts.IterationLimit = 1000000000
+	}
+	if opts.FeedBuffer <= 0 {
+		opts.FeedBuffer = 1024
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = metrics.NewRegistry()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		opts:      opts,
+		slots:     make(chan struct{}, opts.MaxConcurrent),
+		metrics:   app.NewMetrics(opts.Metrics),
+		maps:      map[string]*app.WorldMap{},
+		invasions: map[string]*invasion{},
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	opts.Metrics.GaugeFunc("alvasion_queued_invasions", "Number of invasions that wait to run.", func() float64 {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return float64(s.queued)
+	})
+	return s
+}
+
+// Close cancels all invasions and waits until they stop.
+func (s *Server) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "maps":
+		s.route(w, r, http.MethodPost, s.uploadMap)
+	case len(parts) == 2 && parts[0] == "maps":
+		if r.Method == http.MethodDelete {
+			s.deleteMap(w, parts[1])
+			return
+		}
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { s.getMap(w, parts[1]) })
+	case len(parts) == 1 && parts[0] == "invasions":
+		if r.Method == http.MethodGet {
+			s.listInvasions(w)
+			return
+		}
+		s.route(w, r, http.MethodPost, s.startInvasion)
+	case len(parts) == 2 && parts[0] == "invasions":
+		if r.Method == http.MethodDelete {
+			s.deleteInvasion(w, parts[1])
+			return
+		}
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { s.getInvasion(w, parts[1]) })
+	case len(parts) == 3 && parts[0] == "invasions" && parts[2] == "cancel":
+		s.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) { s.cancelInvasion(w, parts[1]) })
+	case len(parts) == 3 && parts[0] == "invasions" && parts[2] == "report":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { s.getReport(w, parts[1]) })
+	case len(parts) == 3 && parts[0] == "invasions" && parts[2] == "events":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { s.getEvents(w, parts[1]) })
+	case len(parts) == 3 && parts[0] == "invasions" && parts[2] == "feed":
+		s.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) { s.getFeed(w, r, parts[1]) })
+	case len(parts) == 1 && parts[0] == "metrics":
+		s.route(w, r, http.MethodGet, s.opts.Metrics.ServeHTTP)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("there is no resource %s", r.URL.Path))
+	}
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request, method string, h http.HandlerFunc) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed for %s", r.Method, r.URL.Path))
+		return
+	}
+	h(w, r)
+}
+
+// uploadMap stores the world map in the body. The body is read as JSON if the
+// content type is application/json and in the format of the world map file otherwise.
+func (s *Server) uploadMap(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	wm, err := s.parseMap(body, strings.HasPrefix(r.Header.Get("Content-Type"), "application/json"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.nextMap++
+	id := fmt.Sprintf("map-%d", s.nextMap)
+	s.maps[id] = wm
+	s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, MapInfo{ID: id, Cities: len(wm.Cities)})
+}
+
+func (s *Server) parseMap(r io.Reader, isJSON bool) (*app.WorldMap, error) {
+	wm, err := s.readMap(r, isJSON)
+	if err != nil {
+		return nil, err
+	}
+	if len(wm.Cities) == 0 {
+		return nil, errors.New("the world map is empty")
+	}
+	return wm, nil
+}
+
+func (s *Server) readMap(r io.Reader, isJSON bool) (*app.WorldMap, error) {
+	if isJSON {
+		return app.ReadWorldMapJSON(r)
+	}
+
+	// the body is read completely, so an error of the body is not lost in the pipeline
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading world map: %w", err)
+	}
+	wm, errs := app.ParseWorldMap(bytes.NewReader(data), s.opts.ValidationWorkers)
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = strings.TrimSpace(e.Error())
+		}
+		sort.Strings(msgs)
+		return nil, errors.New(strings.Join(msgs, "; "))
+	}
+	return wm, nil
+}
+
+func (s *Server) getMap(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	wm, ok := s.maps[id]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("there is no world map with ID %s", id))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = wm.WriteJSON(w)
+}
+
+// deleteMap removes the uploaded world map. The invasions that already use it are not affected.
+func (s *Server) deleteMap(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	_, ok := s.maps[id]
+	delete(s.maps, id)
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("there is no world map with ID %s", id))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) startInvasion(w http.ResponseWriter, r *http.Request) {
+	var req InvasionRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUploadBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("wrong invasion request: %w", err))
+		return
+	}
+
+	wm, opts, err := s.prepare(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	seed := req.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	maxIterations := req.MaxIterations
+	if maxIterations == 0 {
+		maxIterations = s.opts.MaxIterations
+	}
+
+	s.mu.Lock()
+	if s.queued >= s.opts.MaxQueued {
+		s.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("there are already %d invasions waiting to run", s.opts.MaxQueued))
+		return
+	}
+	s.queued++
+	s.nextRun++
+	ctx, cancel := context.WithCancel(s.ctx)
+	inv := &invasion{
+		seq: s.nextRun,
+		status: InvasionStatus{
+			ID:      fmt.Sprintf("invasion-%d", s.nextRun),
+			Status:  StatusQueued,
+			Request: req,
+			Seed:    seed,
+			Created: time.Now(),
+		},
+		cancel: cancel,
+	}
+	inv.feed = newFeed(s.opts.FeedBuffer, &inv.events)
+	s.invasions[inv.status.ID] = inv
+	status := inv.status
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.run(ctx, inv, wm, req.Aliens, maxIterations, seed, opts)
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// prepare checks the request and returns the world map and the options of the commander.
+func (s *Server) prepare(req InvasionRequest) (*app.WorldMap, invasionOptions, error) {
+	var opts invasionOptions
+	if req.Aliens < 1 {
+		return nil, opts, fmt.Errorf("aliens must be positive, got %d", req.Aliens)
+	}
+	if req.Aliens > s.opts.MaxAliens {
+		return nil, opts, fmt.Errorf("aliens must not be more than %d, got %d", s.opts.MaxAliens, req.Aliens)
+	}
+	if req.MaxIterations < 0 {
+		return nil, opts, fmt.Errorf("max_iterations must not be negative, got %d", req.MaxIterations)
+	}
+	if req.MaxIterations > s.opts.IterationLimit {
+		return nil, opts, fmt.Errorf("max_iterations must not be more than %d, got %d", s.opts.IterationLimit, req.MaxIterations)
+	}
+	if req.Seed < 0 {
+		return nil, opts, fmt.Errorf("seed must not be negative, got %d", req.Seed)
+	}
+
+	if strings.HasPrefix(req.Placement, "file:") {
+		// the files of the server must not be read by the clients
+		return nil, opts, errors.New("the placement from a file is not supported by the API")
+	}
+	var err error
+	if opts.placement, err = app.ParsePlacementSpec(req.Placement, req.MultipleAliensPerCity); err != nil {
+		return nil, opts, err
+	}
+	if req.Termination != "" {
+		if opts.termination, err = app.ParseTermination(req.Termination); err != nil {
+			return nil, opts, err
+		}
+	}
+	opts.headOn = req.HeadOnCollisions
+
+	wm, err := s.worldMap(req)
+	return wm, opts, err
+}
+
+type invasionOptions struct {
+	placement   app.PlacementSpec
+	termination app.TerminationCondition
+	headOn      bool
+}
+
+func (s *Server) worldMap(req InvasionRequest) (*app.WorldMap, error) {
+	switch {
+	case req.MapID != "" && req.MapPath != "":
+		return nil, errors.New("only one of map_id and map_path must be set")
+	case req.MapID != "":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		wm, ok := s.maps[req.MapID]
+		if !ok {
+			return nil, fmt.Errorf("there is no world map with ID %s", req.MapID)
+		}
+		return wm, nil
+	case req.MapPath != "":
+		if s.opts.MapDir == "" {
+			return nil, errors.New("the world maps can't be referenced by a path, because the server has no map directory")
+		}
+		if p := filepath.Clean(req.MapPath); filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("the path %s must be relative and inside the map directory", req.MapPath)
+		}
+		f, err := os.Open(filepath.Join(s.opts.MapDir, req.MapPath))
+		if err != nil {
+			return nil, fmt.Errorf("the world map can't be read: %w", err)
+		}
+		defer f.Close()
+		return s.parseMap(f, strings.HasSuffix(req.MapPath, ".json"))
+	default:
+		return nil, errors.New("one of map_id and map_path must be set")
+	}
+}
+
+// run waits for a free slot and runs the invasion.
+func (s *Server) run(ctx context.Context, inv *invasion, wm *app.WorldMap, aliens, maxIterations int, seed int64, opts invasionOptions) {
+	defer s.wg.Done()
+	defer inv.cancel()
+	// the feed is closed after the final status is set, so the subscribers receive it
+	defer inv.feed.close()
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+	}
+	if ctx.Err() != nil {
+		// cancelled while waiting, also if a slot became free at the same time
+		s.mu.Lock()
+		s.queued--
+		inv.status.Status = StatusCancelled
+		now := time.Now()
+		inv.status.Finished = &now
+		s.over()
+		s.mu.Unlock()
+		return
+	}
+
+	s.mu.Lock()
+	s.queued--
+	inv.status.Status = StatusRunning
+	now := time.Now()
+	inv.status.Started = &now
+	s.mu.Unlock()
+
+	tc := opts.termination
+	if tc == nil {
+		tc = app.DefaultTermination(maxIterations)
+	}
+	options := []app.Option{
+		app.WithPlacement(opts.placement.Strategy(seed)),
+		app.WithTermination(tracked{ctx: ctx, condition: tc, iterations: &inv.iterations}),
+		app.WithEventHandler(inv.feed.publish),
+		app.WithMetrics(s.metrics),
+		app.WithWatchdog(s.opts.Watchdog),
+	}
+	if opts.headOn {
+		options = append(options, app.WithHeadOnCollisions())
+	}
+	var res app.InvasionResult
+	var report string
+	err := func() (err error) {
+		// a panic of the invasion fails it instead of the whole server
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("the invasion panicked: %v", r)
+			}
+		}()
+		ac := app.NewAlienCommander(wm, aliens, app.NewSeededRandomPath(seed), io.Discard, maxIterations, options...)
+		if err = ac.StartInvasion(); err != nil {
+			return err
+		}
+		res, report = ac.Result(), ac.GenerateReportForInvasion()
+		return nil
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.over()
+	finished := time.Now()
+	inv.status.Finished = &finished
+	if err != nil {
+		inv.status.Status = StatusFailed
+		inv.status.Error = err.Error()
+		return
+	}
+
+	inv.report = report
+	inv.status.Status = StatusFinished
+	if ctx.Err() != nil {
+		inv.status.Status = StatusCancelled
+	}
+	inv.status.DestroyedCities = res.DestroyedCities
+	inv.status.SurvivingAliens = res.SurvivingAliens
+	inv.status.StopReason = res.StopReason
+	inv.iterations.Store(int64(res.Iterations))
+}
+
+// over counts an invasion that is over and removes the oldest invasions that are
+// over if there are more than MaxFinished. It must be called with the lock of the server.
+func (s *Server) over() {
+	s.finished++
+	if s.finished <= s.opts.MaxFinished {
+		return
+	}
+	var oldest []*invasion
+	for _, inv := range s.invasions {
+		if inv.isOver() {
+			oldest = append(oldest, inv)
+		}
+	}
+	sort.Slice(oldest, func(i, j int) bool {
+		return oldest[i].seq < oldest[j].seq
+	})
+	for _, inv := range oldest[:len(oldest)-s.opts.MaxFinished] {
+		delete(s.invasions, inv.status.ID)
+	}
+	s.finished = s.opts.MaxFinished
+}
+
+// tracked wraps the termination condition of an invasion: it records the progress
+// of the invasion and stops it when it is cancelled.
+type tracked struct {
+	ctx        context.Context
+	condition  app.TerminationCondition
+	iterations *atomic.Int64
+}
+
+func (t tracked) Met(s app.InvasionState) (string, bool) {
+	t.iterations.Store(int64(s.Iterations))
+	if t.ctx.Err() != nil {
+		return "cancelled", true
+	}
+	return t.condition.Met(s)
+}
+
+func (t tracked) String() string {
+	return t.condition.String()
+}
+
+func (s *Server) listInvasions(w http.ResponseWriter) {
+	s.mu.Lock()
+	invasions := make([]*invasion, 0, len(s.invasions))
+	for _, inv := range s.invasions {
+		invasions = append(invasions, inv)
+	}
+	sort.Slice(invasions, func(i, j int) bool {
+		return invasions[i].seq < invasions[j].seq
+	})
+	statuses := make([]InvasionStatus, len(invasions))
+	for i, inv := range invasions {
+		statuses[i] = inv.snapshot()
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// isOver reports whether the invasion is finished, cancelled or failed. It must be
+// called with the lock of the server.
+func (inv *invasion) isOver() bool {
+	return inv.status.Status != StatusQueued && inv.status.Status != StatusRunning
+}
+
+// snapshot returns the current status. It must be called with the lock of the server.
+func (inv *invasion) snapshot() InvasionStatus {
+	st := inv.status
+	st.Iterations = inv.iterations.Load()
+	return st
+}
+
+func (s *Server) invasion(w http.ResponseWriter, id string) (*invasion, bool) {
+	inv, ok := s.invasions[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("there is no invasion with ID %s", id))
+	}
+	return inv, ok
+}
+
+func (s *Server) getInvasion(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	inv, ok := s.invasion(w, id)
+	var st InvasionStatus
+	if ok {
+		st = inv.snapshot()
+	}
+	s.mu.Unlock()
+	if ok {
+		writeJSON(w, http.StatusOK, st)
+	}
+}
+
+func (s *Server) cancelInvasion(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	inv, ok := s.invasion(w, id)
+	var st InvasionStatus
+	if ok {
+		inv.cancel()
+		st = inv.snapshot()
+	}
+	s.mu.Unlock()
+	if ok {
+		writeJSON(w, http.StatusAccepted, st)
+	}
+}
+
+// deleteInvasion removes the invasion with its report and event log. An invasion
+// that is queued or running must be cancelled first.
+func (s *Server) deleteInvasion(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invasion(w, id)
+	if !ok {
+		return
+	}
+	if !inv.isOver() {
+		writeError(w, http.StatusConflict, fmt.Errorf("the invasion %s is %s", id, inv.status.Status))
+		return
+	}
+	delete(s.invasions, id)
+	s.finished--
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// done returns the invasion if it is over and writes a conflict if it is still queued or running.
+func (s *Server) done(w http.ResponseWriter, id string) (*invasion, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invasion(w, id)
+	if !ok {
+		return nil, false
+	}
+	switch inv.status.Status {
+	case StatusQueued, StatusRunning:
+		writeError(w, http.StatusConflict, fmt.Errorf("the invasion %s is %s", id, inv.status.Status))
+		return nil, false
+	case StatusFailed:
+		writeError(w, http.StatusConflict, fmt.Errorf("the invasion %s failed: %s", id, inv.status.Error))
+		return nil, false
+	}
+	return inv, true
+}
+
+func (s *Server) getReport(w http.ResponseWriter, id string) {
+	inv, ok := s.done(w, id)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, inv.report)
+}
+
+func (s *Server) getEvents(w http.ResponseWriter, id string) {
+	inv, ok := s.done(w, id)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	_ = app.WriteEvents(w, inv.events)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	// the termination conditions contain < and >
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
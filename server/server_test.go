@@ -0,0 +1,376 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/EmilGeorgiev/alvasion/server"
+	"github.com/stretchr/testify/assert"
+)
+
+const worldMap = "" +
+	"C0 south=C3 east=C1\n" +
+	"C1 south=C4 east=C2 west=C0\n" +
+	"C2 south=C5 west=C1\n" +
+	"C3 north=C0 east=C4\n" +
+	"C4 north=C1 east=C5 west=C3\n" +
+	"C5 north=C2 west=C4\n"
+
+func TestRunInvasionAndDownloadReportAndEvents(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{MaxConcurrent: 2})
+	var m server.MapInfo
+	code := do(t, ts, http.MethodPost, "/maps", "text/plain", worldMap, &m)
+	assert.Equal(t, http.StatusCreated, code)
+
+	// ACTION
+	var started server.InvasionStatus
+	code = do(t, ts, http.MethodPost, "/invasions", "application/json", `{"map_id":"`+m.ID+`","aliens":4,"seed":3,"max_iterations":50}`, &started)
+	finished := waitUntilOver(t, ts, started.ID)
+	report := get(t, ts, "/invasions/"+started.ID+"/report")
+	events, err := app.ReadEvents(strings.NewReader(get(t, ts, "/invasions/"+started.ID+"/events")))
+
+	// ASSERTIONS
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, server.MapInfo{ID: "map-1", Cities: 6}, m)
+	assert.Equal(t, server.StatusFinished, finished.Status)
+	assert.NotEmpty(t, finished.StopReason)
+	assert.NoError(t, err)
+
+	// the same invasion run directly produces the same report and event log
+	wm, _ := app.ParseWorldMap(strings.NewReader(worldMap), 1)
+	ac := app.NewAlienCommander(wm, 4, app.NewSeededRandomPath(3), io.Discard, 50)
+	assert.NoError(t, ac.StartInvasion())
+	assert.Equal(t, ac.GenerateReportForInvasion(), report)
+	assert.Equal(t, ac.Events(), events)
+	assert.Equal(t, ac.Result().DestroyedCities, finished.DestroyedCities)
+}
+
+func TestUploadWrongWorldMap(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{})
+
+	// ACTION
+	var body map[string]string
+	code := do(t, ts, http.MethodPost, "/maps", "text/plain", "C0 south=C3\nC1\n", &body)
+
+	// ASSERTIONS
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, body["error"], "line number: 2 has wrong format")
+}
+
+func TestUploadEmptyWorldMap(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{name: "text", contentType: "text/plain", body: ""},
+		{name: "JSON", contentType: "application/json", body: `{"cities":[]}`},
+	}
+
+	ts := newTestServer(t, server.Options{})
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// ACTION
+			var body map[string]string
+			code := do(t, ts, http.MethodPost, "/maps", c.contentType, c.body, &body)
+
+			// ASSERTIONS
+			assert.Equal(t, http.StatusBadRequest, code)
+			assert.Equal(t, "the world map is empty", body["error"])
+		})
+	}
+}
+
+func TestUploadWorldMapAsJSON(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{})
+
+	// ACTION
+	var m server.MapInfo
+	code := do(t, ts, http.MethodPost, "/maps", "application/json", `{"cities":[{"name":"X1","roads":[{"direction":"east","to":"X2"}]}]}`, &m)
+	stored := get(t, ts, "/maps/"+m.ID)
+
+	// ASSERTIONS
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, 2, m.Cities)
+	assert.Contains(t, stored, `"name": "X2"`)
+}
+
+func TestStartInvasionWithMapFromTheMapDirectory(t *testing.T) {
+	// SETUP
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "world.txt"), []byte(worldMap), 0644))
+	ts := newTestServer(t, server.Options{MapDir: dir})
+
+	// ACTION
+	var started server.InvasionStatus
+	code := do(t, ts, http.MethodPost, "/invasions", "application/json", `{"map_path":"world.txt","aliens":2,"seed":1}`, &started)
+	var outside map[string]string
+	outsideCode := do(t, ts, http.MethodPost, "/invasions", "application/json", `{"map_path":"../world.txt","aliens":2}`, &outside)
+
+	// ASSERTIONS
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, server.StatusFinished, waitUntilOver(t, ts, started.ID).Status)
+	assert.Equal(t, http.StatusBadRequest, outsideCode)
+	assert.Equal(t, "the path ../world.txt must be relative and inside the map directory", outside["error"])
+}
+
+func TestStartInvasionWithWrongRequest(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{name: "unknown map", body: `{"map_id":"map-9","aliens":2}`, expected: "there is no world map with ID map-9"},
+		{name: "no map", body: `{"aliens":2}`, expected: "one of map_id and map_path must be set"},
+		{name: "no aliens", body: `{"map_id":"map-1"}`, expected: "aliens must be positive, got 0"},
+		{name: "too many aliens", body: `{"map_id":"map-1","aliens":11}`, expected: "aliens must not be more than 10, got 11"},
+		{name: "too many iterations", body: `{"map_id":"map-1","aliens":2,"max_iterations":1001}`, expected: "max_iterations must not be more than 1000, got 1001"},
+		{name: "wrong termination", body: `{"map_id":"map-1","aliens":2,"termination":"soon"}`, expected: "unknown condition \"soon\""},
+		{name: "placement from a file", body: `{"map_id":"map-1","aliens":2,"placement":"file:/etc/passwd"}`, expected: "the placement from a file is not supported by the API"},
+		{name: "unknown field", body: `{"map_id":"map-1","soldiers":2}`, expected: "unknown field \"soldiers\""},
+		{name: "no JSON", body: `aliens=2`, expected: "wrong invasion request"},
+	}
+
+	ts := newTestServer(t, server.Options{MapDir: t.TempDir(), MaxAliens: 10, IterationLimit: 1000})
+	do(t, ts, http.MethodPost, "/maps", "text/plain", worldMap, nil)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// ACTION
+			var body map[string]string
+			code := do(t, ts, http.MethodPost, "/invasions", "application/json", c.body, &body)
+
+			// ASSERTIONS
+			assert.Equal(t, http.StatusBadRequest, code)
+			assert.Contains(t, body["error"], c.expected)
+		})
+	}
+}
+
+func TestCancelInvasion(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{MaxConcurrent: 1})
+	do(t, ts, http.MethodPost, "/maps", "text/plain", worldMap, nil)
+	// the invasion never stops by itself, because the city doesn't exist
+	req := `{"map_id":"map-1","aliens":2,"seed":1,"max_iterations":1000000000,"termination":"city_destroyed=Foo"}`
+	var running, queued server.InvasionStatus
+	do(t, ts, http.MethodPost, "/invasions", "application/json", req, &running)
+	do(t, ts, http.MethodPost, "/invasions", "application/json", req, &queued)
+
+	// ACTION
+	var queuedStatus server.InvasionStatus
+	do(t, ts, http.MethodGet, "/invasions/"+queued.ID, "", "", &queuedStatus)
+	var conflict map[string]string
+	conflictCode := do(t, ts, http.MethodGet, "/invasions/"+running.ID+"/report", "", "", &conflict)
+	do(t, ts, http.MethodPost, "/invasions/"+queued.ID+"/cancel", "", "", nil)
+	cancelCode := do(t, ts, http.MethodPost, "/invasions/"+running.ID+"/cancel", "", "", nil)
+	cancelled := waitUntilOver(t, ts, running.ID)
+	cancelledQueued := waitUntilOver(t, ts, queued.ID)
+
+	// ASSERTIONS
+	assert.Equal(t, server.StatusQueued, queuedStatus.Status)
+	assert.Equal(t, http.StatusConflict, conflictCode)
+	assert.Contains(t, conflict["error"], "is running")
+	assert.Equal(t, http.StatusAccepted, cancelCode)
+	assert.Equal(t, server.StatusCancelled, cancelled.Status)
+	assert.Equal(t, "cancelled", cancelled.StopReason)
+	assert.Equal(t, server.StatusCancelled, cancelledQueued.Status)
+	assert.Nil(t, cancelledQueued.Started)
+}
+
+func TestTooManyQueuedInvasions(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{MaxConcurrent: 1, MaxQueued: 1})
+	do(t, ts, http.MethodPost, "/maps", "text/plain", worldMap, nil)
+	req := `{"map_id":"map-1","aliens":2,"seed":1,"max_iterations":1000000000,"termination":"city_destroyed=Foo"}`
+	var running server.InvasionStatus
+	do(t, ts, http.MethodPost, "/invasions", "application/json", req, &running)
+	waitUntil(t, ts, running.ID, server.StatusRunning)
+	do(t, ts, http.MethodPost, "/invasions", "application/json", req, nil)
+
+	// ACTION
+	code := do(t, ts, http.MethodPost, "/invasions", "application/json", req, nil)
+	var all []server.InvasionStatus
+	do(t, ts, http.MethodGet, "/invasions", "", "", &all)
+
+	// ASSERTIONS
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Len(t, all, 2)
+	assert.Equal(t, "invasion-1", all[0].ID)
+	assert.Equal(t, "invasion-2", all[1].ID)
+}
+
+func TestDeleteMapAndInvasion(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{MaxConcurrent: 1})
+	do(t, ts, http.MethodPost, "/maps", "text/plain", worldMap, nil)
+	var finished server.InvasionStatus
+	do(t, ts, http.MethodPost, "/invasions", "application/json", `{"map_id":"map-1","aliens":2,"seed":1}`, &finished)
+	waitUntilOver(t, ts, finished.ID)
+	// the invasion never stops by itself, because the city doesn't exist
+	req := `{"map_id":"map-1","aliens":2,"seed":1,"max_iterations":1000000000,"termination":"city_destroyed=Foo"}`
+	var running server.InvasionStatus
+	do(t, ts, http.MethodPost, "/invasions", "application/json", req, &running)
+	waitUntil(t, ts, running.ID, server.StatusRunning)
+
+	// ACTION
+	deleteMap := do(t, ts, http.MethodDelete, "/maps/map-1", "", "", nil)
+	deleteMapAgain := do(t, ts, http.MethodDelete, "/maps/map-1", "", "", nil)
+	getMap := do(t, ts, http.MethodGet, "/maps/map-1", "", "", nil)
+	deleteFinished := do(t, ts, http.MethodDelete, "/invasions/"+finished.ID, "", "", nil)
+	getFinished := do(t, ts, http.MethodGet, "/invasions/"+finished.ID, "", "", nil)
+	var conflict map[string]string
+	deleteRunning := do(t, ts, http.MethodDelete, "/invasions/"+running.ID, "", "", &conflict)
+	do(t, ts, http.MethodPost, "/invasions/"+running.ID+"/cancel", "", "", nil)
+	waitUntilOver(t, ts, running.ID)
+	deleteCancelled := do(t, ts, http.MethodDelete, "/invasions/"+running.ID, "", "", nil)
+	var all []server.InvasionStatus
+	do(t, ts, http.MethodGet, "/invasions", "", "", &all)
+
+	// ASSERTIONS
+	assert.Equal(t, http.StatusNoContent, deleteMap)
+	assert.Equal(t, http.StatusNotFound, deleteMapAgain)
+	assert.Equal(t, http.StatusNotFound, getMap)
+	assert.Equal(t, http.StatusNoContent, deleteFinished)
+	assert.Equal(t, http.StatusNotFound, getFinished)
+	assert.Equal(t, http.StatusConflict, deleteRunning)
+	assert.Contains(t, conflict["error"], "is running")
+	assert.Equal(t, http.StatusNoContent, deleteCancelled)
+	assert.Empty(t, all)
+}
+
+func TestOldestFinishedInvasionsAreRemoved(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{MaxFinished: 2})
+	do(t, ts, http.MethodPost, "/maps", "text/plain", worldMap, nil)
+
+	// ACTION
+	for i := 0; i < 4; i++ {
+		var started server.InvasionStatus
+		do(t, ts, http.MethodPost, "/invasions", "application/json", `{"map_id":"map-1","aliens":2,"seed":1}`, &started)
+		waitUntilOver(t, ts, started.ID)
+	}
+	var all []server.InvasionStatus
+	do(t, ts, http.MethodGet, "/invasions", "", "", &all)
+	removed := do(t, ts, http.MethodGet, "/invasions/invasion-1/report", "", "", nil)
+
+	// ASSERTIONS
+	if assert.Len(t, all, 2) {
+		assert.Equal(t, "invasion-3", all[0].ID)
+		assert.Equal(t, "invasion-4", all[1].ID)
+	}
+	assert.Equal(t, http.StatusNotFound, removed)
+}
+
+func TestMetrics(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{})
+	do(t, ts, http.MethodPost, "/maps", "text/plain", worldMap, nil)
+	var started server.InvasionStatus
+	do(t, ts, http.MethodPost, "/invasions", "application/json", `{"map_id":"map-1","aliens":4,"seed":3,"max_iterations":50}`, &started)
+	finished := waitUntilOver(t, ts, started.ID)
+
+	// ACTION
+	text := get(t, ts, "/metrics")
+
+	// ASSERTIONS
+	assert.Contains(t, text, "\nalvasion_running_invasions 0\n")
+	assert.Contains(t, text, "\nalvasion_queued_invasions 0\n")
+	assert.Contains(t, text, "\nalvasion_active_aliens 0\n")
+	assert.Contains(t, text, fmt.Sprintf("\nalvasion_destroyed_cities_total %d\n", len(finished.DestroyedCities)))
+	assert.Contains(t, text, fmt.Sprintf("\nalvasion_iterations_total %d\n", finished.Iterations))
+}
+
+func TestUnknownResourceAndMethod(t *testing.T) {
+	// SETUP
+	ts := newTestServer(t, server.Options{})
+
+	// ACTION
+	notFound := do(t, ts, http.MethodGet, "/invasions/invasion-7", "", "", nil)
+	notAllowed := do(t, ts, http.MethodDelete, "/maps", "", "", nil)
+	unknown := do(t, ts, http.MethodGet, "/aliens", "", "", nil)
+
+	// ASSERTIONS
+	assert.Equal(t, http.StatusNotFound, notFound)
+	assert.Equal(t, http.StatusMethodNotAllowed, notAllowed)
+	assert.Equal(t, http.StatusNotFound, unknown)
+}
+
+func newTestServer(t *testing.T, opts server.Options) *httptest.Server {
+	s := server.New(opts)
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	return ts
+}
+
+// do sends the request and decodes the JSON response into out if it is not nil.
+func do(t *testing.T, ts *httptest.Server, method, path, contentType, body string, out interface{}) int {
+	req, err := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %s", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("failed to decode response of %s %s: %s", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func get(t *testing.T, ts *httptest.Server, path string) string {
+	resp, err := ts.Client().Get(ts.URL + path)
+	if err != nil {
+		t.Fatalf("failed to send request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %s", err)
+	}
+	return string(data)
+}
+
+func waitUntilOver(t *testing.T, ts *httptest.Server, id string) server.InvasionStatus {
+	return waitUntil(t, ts, id, server.StatusFinished, server.StatusCancelled, server.StatusFailed)
+}
+
+func waitUntil(t *testing.T, ts *httptest.Server, id string, statuses ...string) server.InvasionStatus {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var st server.InvasionStatus
+		do(t, ts, http.MethodGet, "/invasions/"+id, "", "", &st)
+		for _, s := range statuses {
+			if st.Status == s {
+				return st
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("the invasion %s is not %v after 10 seconds", id, statuses)
+	return server.InvasionStatus{}
+}
@@ -0,0 +1,136 @@
+// Package trace records spans: named and timed pieces of work with attributes that
+// form a tree, in the spirit of OpenTelemetry. The ended spans are exported as JSON
+// lines to a writer, for example a file or the standard output, so the time spent
+// in every phase of a program can be seen without a profiler.
+//
+// A nil *Tracer and a nil *Span are valid and record nothing, so the code can be
+// instrumented unconditionally.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Tracer creates the root spans of one trace and exports all spans of it.
+type Tracer struct {
+	traceID string
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewTracer creates a tracer that writes every ended span to w as one JSON line.
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{traceID: newID(16), enc: json.NewEncoder(w)}
+}
+
+// Start starts a root span.
+func (t *Tracer) Start(name string) *Span {
+	if t == nil {
+		return nil
+	}
+	return &Span{tracer: t, record: record{TraceID: t.traceID, SpanID: newID(8), Name: name, Start: time.Now()}}
+}
+
+// Err returns the first error of writing the spans.
+func (t *Tracer) Err() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+func (t *Tracer) export(r record) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return
+	}
+	if err := t.enc.Encode(r); err != nil {
+		t.err = fmt.Errorf("exporting span %s: %w", r.Name, err)
+	}
+}
+
+// Span is one piece of work. It is exported when it ends. The methods of a span
+// can be called from many goroutines.
+type Span struct {
+	tracer *Tracer
+
+	mu     sync.Mutex
+	record record
+	ended  bool
+}
+
+// record is a span as it is exported.
+type record struct {
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Name       string                 `json:"name"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Duration   time.Duration          `json:"duration_ns"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Child starts a span that is a part of the work of the span.
+func (s *Span) Child(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	t := s.tracer
+	return &Span{tracer: t, record: record{TraceID: t.traceID, SpanID: newID(8), ParentID: s.record.SpanID, Name: name, Start: time.Now()}}
+}
+
+// Set sets the attribute of the span. The value must be encodable as JSON. The
+// attributes set after the span ends are ignored.
+func (s *Span) Set(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	if s.record.Attributes == nil {
+		s.record.Attributes = map[string]interface{}{}
+	}
+	s.record.Attributes[key] = value
+}
+
+// End ends the span and exports it. Calling End more than once has no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.record.End = time.Now()
+	s.record.Duration = s.record.End.Sub(s.record.Start)
+	r := s.record
+	s.mu.Unlock()
+	s.tracer.export(r)
+}
+
+func newID(bytes int) string {
+	b := make([]byte, bytes)
+	if _, err := rand.Read(b); err != nil {
+		// the IDs only have to be unique in one trace, the time is good enough
+		return fmt.Sprintf("%0*x", 2*bytes, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
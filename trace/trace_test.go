@@ -0,0 +1,79 @@
+package trace_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+type span struct {
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id"`
+	Name       string                 `json:"name"`
+	Duration   int64                  `json:"duration_ns"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+func TestSpansFormATree(t *testing.T) {
+	// SETUP
+	buf := bytes.NewBufferString("")
+	tracer := trace.NewTracer(buf)
+
+	// ACTION
+	root := tracer.Start("run")
+	child := root.Child("read world map")
+	child.Set("file", "world-map.txt")
+	child.Set("cities", 9)
+	child.End()
+	child.End()
+	child.Set("ignored", true)
+	root.End()
+
+	// ASSERTIONS
+	spans := readSpans(t, buf.String())
+	assert.NoError(t, tracer.Err())
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "read world map", spans[0].Name)
+	assert.Equal(t, "run", spans[1].Name)
+	assert.Equal(t, spans[1].SpanID, spans[0].ParentID)
+	assert.Empty(t, spans[1].ParentID)
+	assert.Equal(t, spans[0].TraceID, spans[1].TraceID)
+	assert.Len(t, spans[0].TraceID, 32)
+	assert.Len(t, spans[0].SpanID, 16)
+	assert.Equal(t, map[string]interface{}{"file": "world-map.txt", "cities": 9.0}, spans[0].Attributes)
+	assert.GreaterOrEqual(t, spans[1].Duration, spans[0].Duration)
+}
+
+func TestNilTracerRecordsNothing(t *testing.T) {
+	// SETUP
+	var tracer *trace.Tracer
+
+	// ACTION
+	root := tracer.Start("run")
+	child := root.Child("iteration")
+	child.Set("iteration", 1)
+	child.End()
+	root.End()
+
+	// ASSERTIONS
+	assert.Nil(t, root)
+	assert.Nil(t, child)
+	assert.NoError(t, tracer.Err())
+}
+
+func readSpans(t *testing.T, text string) []span {
+	var spans []span
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		var s span
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			t.Fatalf("failed to decode span %q: %s", line, err)
+		}
+		spans = append(spans, s)
+	}
+	return spans
+}
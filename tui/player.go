@@ -0,0 +1,135 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Limits of the speed of the animation in iterations per second.
+const (
+	minSpeed = 0.25
+	maxSpeed = 64
+)
+
+// clearScreen moves the cursor to the top left corner and clears the terminal.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// Options configures the animation.
+type Options struct {
+	// Speed is the number of iterations shown per second.
+	Speed float64
+	// Color draws the destroyed cities and the aliens in color.
+	Color bool
+}
+
+// Play animates the view on out and reads the controls from in, one key at a time:
+//
+//	space or p   pause and resume
+//	n or .       show the next iteration and pause
+//	+ and -      double and halve the speed
+//	q            quit
+//
+// If in has no more input (it is not a terminal) the animation plays until the
+// last iteration and Play returns. Otherwise Play returns when q is pressed.
+func Play(in io.Reader, out io.Writer, v *View, opts Options) error {
+	speed := opts.Speed
+	if speed < minSpeed {
+		speed = minSpeed
+	}
+	if speed > maxSpeed {
+		speed = maxSpeed
+	}
+
+	keys := make(chan byte)
+	done := make(chan struct{})
+	defer close(done)
+	go readKeys(in, keys, done)
+
+	var paused bool
+	interactive := true
+	ticker := time.NewTicker(interval(speed))
+	defer ticker.Stop()
+	for {
+		if err := draw(out, v, speed, paused, opts.Color); err != nil {
+			return err
+		}
+		if !interactive && v.Done() {
+			return nil
+		}
+
+		select {
+		case k, ok := <-keys:
+			if !ok {
+				// without input the animation only plays
+				keys, interactive, paused = nil, false, false
+				continue
+			}
+			switch k {
+			case 'q', 'Q':
+				return nil
+			case ' ', 'p', 'P':
+				paused = !paused
+			case 'n', 'N', '.':
+				paused = true
+				v.Step()
+			case '+', '=':
+				if speed*2 <= maxSpeed {
+					speed *= 2
+					ticker.Reset(interval(speed))
+				}
+			case '-', '_':
+				if speed/2 >= minSpeed {
+					speed /= 2
+					ticker.Reset(interval(speed))
+				}
+			}
+		case <-ticker.C:
+			if !paused {
+				v.Step()
+			}
+		}
+	}
+}
+
+func interval(speed float64) time.Duration {
+	return time.Duration(float64(time.Second) / speed)
+}
+
+// readKeys sends the keys read from in until the end of the input or until done is closed.
+func readKeys(in io.Reader, keys chan<- byte, done <-chan struct{}) {
+	defer close(keys)
+	r := bufio.NewReader(in)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		select {
+		case keys <- b:
+		case <-done:
+			return
+		}
+	}
+}
+
+func draw(out io.Writer, v *View, speed float64, paused, color bool) error {
+	if _, err := io.WriteString(out, clearScreen); err != nil {
+		return err
+	}
+	if err := v.Render(out, color); err != nil {
+		return err
+	}
+
+	state := "playing"
+	switch {
+	case v.Done():
+		state = "finished"
+	case paused:
+		state = "paused"
+	}
+	_, err := fmt.Fprintf(out, "\nIteration %d/%d  speed %g/s  %s\nspace: pause  n: step  +/-: speed  q: quit\n",
+		v.Iteration(), v.Iterations(), speed, state)
+	return err
+}
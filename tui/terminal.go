@@ -0,0 +1,34 @@
+package tui
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// RawMode switches the terminal of stdin to read every key without waiting for
+// Enter and without echo. It uses stty, so it works on Unix-like systems only.
+// The returned function restores the previous mode, it can be called more than once.
+func RawMode() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = stty("cbreak", "-echo"); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			_, _ = stty(strings.TrimSpace(saved))
+		})
+	}, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
@@ -0,0 +1,258 @@
+// Package tui animates an invasion in the terminal. The cities are drawn on the
+// grid of their layout, the aliens move iteration by iteration, the destroyed
+// cities are crossed out and the roads to them are closed.
+package tui
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+)
+
+// ANSI escape codes used to draw the view.
+const (
+	red    = "\x1b[31m"
+	yellow = "\x1b[33m"
+	reset  = "\x1b[0m"
+)
+
+// View is the state of the world at one iteration of an invasion. It is built
+// from the event log, so it can be moved forward one iteration at a time.
+type View struct {
+	wm     *app.WorldMap
+	layout app.Layout
+	at     map[app.Position]int
+	// iterations contains the events of every iteration. The events of the index 0
+	// happen before the first iteration: the aliens are placed in the cities.
+	iterations [][]app.Event
+	current    int
+	destroyed  []bool
+	aliens     [][]int // city ID -> IDs of the aliens in the city
+	// roads are the destroyed roads keyed by the IDs of the cities on their ends in
+	// both orders.
+	roads map[[2]int]bool
+}
+
+// NewView creates the view of the invasion described by the events before its first iteration.
+func NewView(wm *app.WorldMap, events []app.Event) *View {
+	layout := app.NewLayout(wm)
+	v := &View{
+		wm:         wm,
+		layout:     layout,
+		at:         layout.At(),
+		iterations: [][]app.Event{nil},
+		destroyed:  make([]bool, len(wm.Cities)),
+		aliens:     make([][]int, len(wm.Cities)),
+		roads:      map[[2]int]bool{},
+	}
+	for _, e := range events {
+		for len(v.iterations) <= e.Iteration {
+			v.iterations = append(v.iterations, nil)
+		}
+		v.iterations[e.Iteration] = append(v.iterations[e.Iteration], e)
+	}
+	v.apply(v.iterations[0])
+	return v
+}
+
+// Iteration returns the number of iterations shown.
+func (v *View) Iteration() int {
+	return v.current
+}
+
+// Iterations returns the number of iterations of the invasion.
+func (v *View) Iterations() int {
+	return len(v.iterations) - 1
+}
+
+// Done reports whether the last iteration is shown.
+func (v *View) Done() bool {
+	return v.current >= v.Iterations()
+}
+
+// Step moves the view to the next iteration. It returns false if the last iteration is already shown.
+func (v *View) Step() bool {
+	if v.Done() {
+		return false
+	}
+	v.current++
+	v.apply(v.iterations[v.current])
+	return true
+}
+
+func (v *View) apply(events []app.Event) {
+	for _, e := range events {
+		switch e.Type {
+		case app.AlienPlaced:
+			v.add(e.City, e.Aliens)
+		case app.AlienMoved:
+			v.remove(e.From, e.Aliens)
+			v.add(e.To, e.Aliens)
+		case app.CityDestroyed:
+			v.remove(e.City, e.Aliens)
+			if id, ok := v.wm.CityID(e.City); ok {
+				v.destroyed[id] = true
+			}
+		case app.AlienLost:
+			v.remove(e.City, e.Aliens)
+		case app.RoadDestroyed:
+			// the aliens moved to the cities on the ends of the road before they met
+			v.remove(e.From, e.Aliens)
+			v.remove(e.To, e.Aliens)
+			from, ok1 := v.wm.CityID(e.From)
+			to, ok2 := v.wm.CityID(e.To)
+			if ok1 && ok2 {
+				v.roads[[2]int{from, to}] = true
+				v.roads[[2]int{to, from}] = true
+			}
+		}
+	}
+}
+
+func (v *View) add(city string, aliens []int) {
+	id, ok := v.wm.CityID(city)
+	if !ok {
+		return
+	}
+	v.aliens[id] = append(v.aliens[id], aliens...)
+	sort.Ints(v.aliens[id])
+}
+
+func (v *View) remove(city string, aliens []int) {
+	id, ok := v.wm.CityID(city)
+	if !ok {
+		return
+	}
+	left := v.aliens[id][:0]
+	for _, a := range v.aliens[id] {
+		if !contains(aliens, a) {
+			left = append(left, a)
+		}
+	}
+	v.aliens[id] = left
+}
+
+func contains(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Render draws the cities on their grid. Every city takes two lines: its name and
+// the aliens in it. A destroyed city is marked with x and the roads to it and the
+// destroyed roads are drawn as closed. With color the destroyed cities are red and the aliens yellow.
+func (v *View) Render(w io.Writer, color bool) error {
+	width := 5
+	for _, c := range v.wm.Cities {
+		if len(c.Name)+1 > width {
+			width = len(c.Name) + 1
+		}
+	}
+	paint := func(s, code string) string {
+		if !color || strings.TrimSpace(s) == "" {
+			return s
+		}
+		return code + s + reset
+	}
+
+	var sb strings.Builder
+	for y := 0; y < v.layout.Height; y++ {
+		var names, aliens, roads strings.Builder
+		for x := 0; x < v.layout.Width; x++ {
+			id, ok := v.at[app.Position{X: x, Y: y}]
+			if !ok {
+				names.WriteString(strings.Repeat(" ", width+3))
+				aliens.WriteString(strings.Repeat(" ", width+3))
+				roads.WriteString(strings.Repeat(" ", width+3))
+				continue
+			}
+
+			name := v.wm.Cities[id].Name
+			if v.destroyed[id] {
+				names.WriteString(paint(pad("x"+name, width), red))
+			} else {
+				names.WriteString(pad(" "+name, width))
+			}
+			names.WriteString(v.road(id, app.East, "───", "──>", "<──", "─x─", "   "))
+			aliens.WriteString(paint(pad(" "+v.alienList(id, width-1), width), yellow))
+			aliens.WriteString("   ")
+			roads.WriteString(pad(" "+v.road(id, app.South, "│", "v", "^", "x", " "), width+3))
+		}
+		sb.WriteString(strings.TrimRight(names.String(), " ") + "\n")
+		sb.WriteString(strings.TrimRight(aliens.String(), " ") + "\n")
+		if y < v.layout.Height-1 {
+			sb.WriteString(strings.TrimRight(roads.String(), " ") + "\n")
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// road returns how the road from the city in the direction is drawn: open, forward
+// or backward if it is one-way from or to the city, closed because one of the
+// cities or the road is destroyed, or none if there is no road to the neighbour on
+// the grid.
+func (v *View) road(id int, d app.Direction, open, forward, backward, closed, none string) string {
+	nb, ok := v.at[v.layout.Positions[id].Step(d)]
+	if !ok {
+		return none
+	}
+	// the road is drawn if one of the cities has a road in the direction of the
+	// other one and one-way if the other city has no road back at all
+	var drawn, out, back bool
+	for _, r := range v.wm.Cities[id].Roads {
+		if r.To == v.wm.Cities[nb].Name {
+			out = true
+			drawn = drawn || r.Direction == d
+		}
+	}
+	for _, r := range v.wm.Cities[nb].Roads {
+		if r.To == v.wm.Cities[id].Name {
+			back = true
+			drawn = drawn || r.Direction == d.Opposite()
+		}
+	}
+	switch {
+	case !drawn:
+		return none
+	case v.destroyed[id] || v.destroyed[nb] || v.roads[[2]int{id, nb}]:
+		return closed
+	case !back:
+		return forward
+	case !out:
+		return backward
+	}
+	return open
+}
+
+// alienList returns the IDs of the aliens in the city like "a1 a4" or the number
+// of aliens if the IDs don't fit in the width.
+func (v *View) alienList(id, width int) string {
+	if len(v.aliens[id]) == 0 {
+		return ""
+	}
+	names := make([]string, len(v.aliens[id]))
+	for i, a := range v.aliens[id] {
+		names[i] = fmt.Sprintf("a%d", a)
+	}
+	list := strings.Join(names, " ")
+	if len(list) > width {
+		list = fmt.Sprintf("%d al.", len(v.aliens[id]))
+	}
+	return list
+}
+
+// pad pads s with spaces to the width in runes.
+func pad(s string, width int) string {
+	n := len([]rune(s))
+	if n >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-n)
+}
@@ -0,0 +1,121 @@
+package tui_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/EmilGeorgiev/alvasion/app"
+	"github.com/EmilGeorgiev/alvasion/tui"
+	"github.com/stretchr/testify/assert"
+)
+
+// events of an invasion of a 2x2 grid: alien 0 moves from X1 to X2 and destroys
+// it together with alien 1, alien 2 stays in X3.
+var events = []app.Event{
+	{Type: app.AlienPlaced, City: "X1", Aliens: []int{0}},
+	{Type: app.AlienPlaced, City: "X2", Aliens: []int{1}},
+	{Type: app.AlienPlaced, City: "X3", Aliens: []int{2}},
+	{Iteration: 1, Type: app.AlienMoved, From: "X1", To: "X2", Aliens: []int{0}},
+	{Iteration: 1, Type: app.CityDestroyed, City: "X2", Aliens: []int{0, 1}},
+	{Iteration: 1, Type: app.IterationFinished},
+}
+
+func TestRenderBeforeTheFirstIteration(t *testing.T) {
+	// SETUP
+	v := tui.NewView(app.GenerateGrid(2, 2), events)
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := v.Render(buf, false)
+
+	// ASSERTIONS
+	expected := "" +
+		" X1  ─── X2\n" +
+		" a0      a1\n" +
+		" │       │\n" +
+		" X3  ─── X4\n" +
+		" a2\n"
+	assert.NoError(t, err)
+	assert.Equal(t, expected, buf.String())
+	assert.Equal(t, 0, v.Iteration())
+	assert.Equal(t, 1, v.Iterations())
+}
+
+func TestRenderAfterTheCityIsDestroyed(t *testing.T) {
+	// SETUP
+	v := tui.NewView(app.GenerateGrid(2, 2), events)
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	stepped := v.Step()
+	err := v.Render(buf, false)
+
+	// ASSERTIONS
+	expected := "" +
+		" X1  ─x─xX2\n" +
+		"\n" +
+		" │       x\n" +
+		" X3  ─── X4\n" +
+		" a2\n"
+	assert.True(t, stepped)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, buf.String())
+	assert.True(t, v.Done())
+	assert.False(t, v.Step())
+}
+
+func TestRenderOneWayRoads(t *testing.T) {
+	// SETUP
+	// the aliens can go around the grid only clockwise
+	wm := app.NewWorldMap([]app.CityInfo{
+		{Name: "X1", Roads: []app.Road{{Direction: app.East, To: "X2", OneWay: true}}},
+		{Name: "X2", Roads: []app.Road{{Direction: app.South, To: "X4", OneWay: true}}},
+		{Name: "X3", Roads: []app.Road{{Direction: app.North, To: "X1", OneWay: true}}},
+		{Name: "X4", Roads: []app.Road{{Direction: app.West, To: "X3", OneWay: true}}},
+	})
+	v := tui.NewView(wm, nil)
+	buf := bytes.NewBufferString("")
+
+	// ACTION
+	err := v.Render(buf, false)
+
+	// ASSERTIONS
+	expected := "" +
+		" X1  ──> X2\n" +
+		"\n" +
+		" ^       v\n" +
+		" X3  <── X4\n" +
+		"\n"
+	assert.NoError(t, err)
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestPlayWithoutInputPlaysUntilTheEnd(t *testing.T) {
+	// SETUP
+	v := tui.NewView(app.GenerateGrid(2, 2), events)
+	out := bytes.NewBufferString("")
+
+	// ACTION
+	err := tui.Play(strings.NewReader(""), out, v, tui.Options{Speed: 64})
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.True(t, v.Done())
+	assert.Contains(t, out.String(), "Iteration 1/1  speed 64/s  finished")
+}
+
+func TestPlayStepsAndQuits(t *testing.T) {
+	// SETUP
+	v := tui.NewView(app.GenerateGrid(2, 2), events)
+	out := bytes.NewBufferString("")
+
+	// ACTION
+	err := tui.Play(strings.NewReader("+n+q"), out, v, tui.Options{Speed: 0.25})
+
+	// ASSERTIONS
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v.Iteration())
+	assert.Contains(t, out.String(), "Iteration 0/1  speed 0.5/s  playing")
+	assert.Contains(t, out.String(), "Iteration 1/1  speed 1/s  finished")
+}